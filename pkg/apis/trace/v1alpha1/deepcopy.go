@@ -0,0 +1,112 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies the receiver into out.
+func (in *TraceJob) DeepCopyInto(out *TraceJob) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy creates a new TraceJob copying the receiver.
+func (in *TraceJob) DeepCopy() *TraceJob {
+	if in == nil {
+		return nil
+	}
+	out := new(TraceJob)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *TraceJob) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *TraceJobSpec) DeepCopyInto(out *TraceJobSpec) {
+	*out = *in
+	if in.ProgramArgs != nil {
+		out.ProgramArgs = make([]string, len(in.ProgramArgs))
+		copy(out.ProgramArgs, in.ProgramArgs)
+	}
+	if in.WaitForProcess != nil {
+		out.WaitForProcess = new(metav1.Duration)
+		*out.WaitForProcess = *in.WaitForProcess
+	}
+	if in.TTL != nil {
+		out.TTL = new(int32)
+		*out.TTL = *in.TTL
+	}
+	if in.Resources != nil {
+		out.Resources = in.Resources.DeepCopy()
+	}
+}
+
+// DeepCopy creates a new TraceJobSpec copying the receiver.
+func (in *TraceJobSpec) DeepCopy() *TraceJobSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TraceJobSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *TraceJobStatus) DeepCopyInto(out *TraceJobStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		out.StartTime = in.StartTime.DeepCopy()
+	}
+}
+
+// DeepCopy creates a new TraceJobStatus copying the receiver.
+func (in *TraceJobStatus) DeepCopy() *TraceJobStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TraceJobStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the receiver into out.
+func (in *TraceJobList) DeepCopyInto(out *TraceJobList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]TraceJob, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy creates a new TraceJobList copying the receiver.
+func (in *TraceJobList) DeepCopy() *TraceJobList {
+	if in == nil {
+		return nil
+	}
+	out := new(TraceJobList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *TraceJobList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
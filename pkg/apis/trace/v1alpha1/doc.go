@@ -0,0 +1,3 @@
+// Package v1alpha1 contains the TraceJob custom resource, letting traces be declared
+// as Kubernetes objects and reconciled into trace jobs by the kubectl-trace controller.
+package v1alpha1
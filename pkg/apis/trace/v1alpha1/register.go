@@ -0,0 +1,37 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// GroupName is the API group of the kubectl-trace custom resources.
+	GroupName = "trace.iovisor.org"
+	// Version is the API version of the kubectl-trace custom resources.
+	Version = "v1alpha1"
+	// Kind is the kind of the TraceJob custom resource.
+	Kind = "TraceJob"
+	// Resource is the plural name of the TraceJob custom resource.
+	Resource = "tracejobs"
+)
+
+var (
+	// SchemeGroupVersion is the group version used to register these objects.
+	SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: Version}
+	// SchemeGroupVersionResource identifies the TraceJob resource for dynamic clients.
+	SchemeGroupVersionResource = SchemeGroupVersion.WithResource(Resource)
+
+	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes)
+	AddToScheme   = SchemeBuilder.AddToScheme
+)
+
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(SchemeGroupVersion,
+		&TraceJob{},
+		&TraceJobList{},
+	)
+	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
+	return nil
+}
@@ -0,0 +1,112 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TraceJob declares a trace to run in the cluster.
+type TraceJob struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TraceJobSpec   `json:"spec"`
+	Status TraceJobStatus `json:"status,omitempty"`
+}
+
+// TraceJobSpec describes what to trace and how, mirroring the flags of kubectl trace run.
+type TraceJobSpec struct {
+	// Resource to trace, as given to kubectl trace run: NODE, node/NAME, pod/NAME, deploy/NAME...
+	Resource string `json:"resource"`
+	// Container to trace, required when the target pod has more than one container.
+	Container string `json:"container,omitempty"`
+	// TargetNamespace is where the target resource lives, defaults to the namespace of the TraceJob.
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+	// Tracer is the tracing system to use: bpftrace, bcc, rbspy or fake.
+	Tracer string `json:"tracer,omitempty"`
+	// ProcessSelector selects the traced process in the target container.
+	ProcessSelector string `json:"processSelector,omitempty"`
+	// WaitForProcess is how long the trace waits for a process matching ProcessSelector to appear.
+	WaitForProcess *metav1.Duration `json:"waitForProcess,omitempty"`
+	// Output is where the tracing output is sent.
+	Output string `json:"output,omitempty"`
+	// Program is the bpftrace program, or the program to execute for the other tracers.
+	Program string `json:"program"`
+	// ProgramArgs are passed on to the program.
+	ProgramArgs []string `json:"programArgs,omitempty"`
+	// ServiceAccount used by the trace job pod.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// ImageNameTag is the trace runner image.
+	ImageNameTag string `json:"imageNameTag,omitempty"`
+	// InitImageNameTag is the image fetching linux headers, when FetchHeaders is set.
+	InitImageNameTag string `json:"initImageNameTag,omitempty"`
+	// FetchHeaders tells whether to fetch linux headers before tracing.
+	FetchHeaders bool `json:"fetchHeaders,omitempty"`
+	// Deadline is the maximum time the trace is allowed to run, in seconds.
+	Deadline int64 `json:"deadline,omitempty"`
+	// DeadlineGracePeriod is the time left to print maps after the deadline, in seconds.
+	DeadlineGracePeriod int64 `json:"deadlineGracePeriod,omitempty"`
+	// TTL is the time the trace job is kept once finished, in seconds.
+	TTL *int32 `json:"ttl,omitempty"`
+	// Resources are the requests and limits of the trace containers, the missing ones taking the defaults.
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// SecurityProfile tells which privileges the trace container is given, privileged or restricted-bpf.
+	SecurityProfile string `json:"securityProfile,omitempty"`
+	// GoogleAppSecret is a secret holding a google service account key, used for GCS outputs.
+	GoogleAppSecret string `json:"googleAppSecret,omitempty"`
+	// AWSCredentialsSecret is a secret holding the AWS_* environment variables, used for S3 outputs.
+	AWSCredentialsSecret string `json:"awsCredentialsSecret,omitempty"`
+	// HTTPHeadersSecret is a secret whose keys and values are headers of the requests of HTTP outputs.
+	HTTPHeadersSecret string `json:"httpHeadersSecret,omitempty"`
+	// HTTPUploadFormat is how HTTP outputs are posted, tar or multipart.
+	HTTPUploadFormat string `json:"httpUploadFormat,omitempty"`
+	// Format is the format of the output of bpftrace, text or json to stream its events to EventsSink.
+	Format string `json:"format,omitempty"`
+	// EventsSink is where the events of bpftrace are sent with the json format: stdout, file://,
+	// otlp+http(s):// or kafka+http(s):// URL.
+	EventsSink string `json:"eventsSink,omitempty"`
+}
+
+// TraceJobPhase is a label for the state of a TraceJob.
+type TraceJobPhase string
+
+// These are the valid phases of a TraceJob.
+const (
+	// TraceJobPending means the trace job has not been created yet.
+	TraceJobPending TraceJobPhase = "Pending"
+	// TraceJobRunning means the trace job has active pods.
+	TraceJobRunning TraceJobPhase = "Running"
+	// TraceJobCompleted means the trace job completed successfully.
+	TraceJobCompleted TraceJobPhase = "Completed"
+	// TraceJobFailed means the trace job failed, or could not be created.
+	TraceJobFailed TraceJobPhase = "Failed"
+	// TraceJobUnknown means the state of the trace job could not be determined.
+	TraceJobUnknown TraceJobPhase = "Unknown"
+)
+
+// TraceJobStatus is the observed state of a TraceJob.
+type TraceJobStatus struct {
+	// Phase of the trace.
+	Phase TraceJobPhase `json:"phase,omitempty"`
+	// TraceID is the ID of the trace created for this TraceJob.
+	TraceID types.UID `json:"traceID,omitempty"`
+	// JobName is the name of the job running the trace.
+	JobName string `json:"jobName,omitempty"`
+	// Node the trace runs on.
+	Node string `json:"node,omitempty"`
+	// StartTime of the job running the trace.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// Message explains the phase, eg why the trace could not be created.
+	Message string `json:"message,omitempty"`
+	// ObservedGeneration is the generation of the spec the status refers to.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// TraceJobList is a list of TraceJobs.
+type TraceJobList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []TraceJob `json:"items"`
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"sync"
 	"time"
 
+	"github.com/iovisor/kubectl-trace/pkg/logs"
 	"github.com/iovisor/kubectl-trace/pkg/meta"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -112,6 +114,74 @@ func (a *Attacher) Attach(selector, namespace string) {
 	<-a.ctx.Done()
 }
 
+// AttachJobs attaches to the output of several trace jobs at once, prefixing each line with the
+// name of the pod it comes from. Since a single terminal can't be shared among many traces, the
+// traces are attached without stdin and without a TTY.
+func (a *Attacher) AttachJobs(traceJobIDs []types.UID, namespace string) {
+	var lock sync.Mutex
+	for _, id := range traceJobIDs {
+		go a.attachOutput(fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, id), namespace, &lock)
+	}
+	<-a.ctx.Done()
+}
+
+func (a *Attacher) attachOutput(selector, namespace string, lock *sync.Mutex) {
+	err := wait.ExponentialBackoff(wait.Backoff{
+		Duration: time.Second * 1,
+		Factor:   0.01,
+		Jitter:   0.0,
+		Steps:    100,
+	}, func() (bool, error) {
+		pl, err := a.CoreV1Client.Pods(namespace).List(context.Background(), metav1.ListOptions{
+			LabelSelector: selector,
+		})
+
+		if err != nil {
+			return false, err
+		}
+
+		if len(pl.Items) == 0 {
+			return false, nil
+		}
+		pod := &pl.Items[0]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			return false, fmt.Errorf(podPhaseNotAcceptedError, pod.Status.Phase)
+		}
+
+		if len(pod.Spec.Containers) != 1 {
+			return false, fmt.Errorf(invalidPodContainersSizeError)
+		}
+
+		restClient := a.CoreV1Client.RESTClient().(*restclient.RESTClient)
+		req := restClient.Post().
+			Resource("pods").
+			Name(pod.Name).
+			Namespace(pod.Namespace).
+			SubResource("attach")
+		req.VersionedParams(&corev1.PodAttachOptions{
+			Container: pod.Spec.Containers[0].Name,
+			Stdin:     false,
+			Stdout:    true,
+			Stderr:    false,
+			TTY:       false,
+		}, scheme.ParameterCodec)
+
+		out := logs.NewPrefixWriter(a.IOStreams.Out, fmt.Sprintf("[%s] ", pod.Name), lock)
+		defer out.Flush()
+
+		att := &defaultRemoteAttach{}
+		err = att.Attach("POST", req.URL(), a.Config, nil, out, nil, false, nil)
+		if err != nil {
+			return false, nil
+		}
+		return true, nil
+	})
+
+	if err != nil {
+		fmt.Fprintln(a.IOStreams.ErrOut, err)
+	}
+}
+
 type attach struct {
 	restClient    *restclient.RESTClient
 	podName       string
@@ -28,6 +28,9 @@ var (
 	# Attach to a trace using its id
 	%[1]s trace attach 5594d7e1-0b78-11e9-b7f1-40a3cc632df1
 
+	# Attach to the output of all the traces of a group
+	%[1]s trace attach --group 7f5a7fa9-ee3c-11e8-9e7a-8c164500a77e
+
 	# Attach to a trace in a namespace using its name
 	%[1]s trace attach kubectl-trace-d5842929-0b78-11e9-a9fa-40a3cc632df1 -n mynamespace
 `
@@ -38,6 +41,7 @@ type AttachOptions struct {
 	genericclioptions.IOStreams
 	traceID      *types.UID
 	traceName    *string
+	traceGroup   string
 	namespace    string
 	clientConfig *rest.Config
 }
@@ -54,7 +58,7 @@ func NewAttachCommand(factory cmdutil.Factory, streams genericclioptions.IOStrea
 	o := NewAttachOptions(streams)
 
 	cmd := &cobra.Command{
-		Use:                   "attach (TRACE_ID | TRACE_NAME)",
+		Use:                   "attach (TRACE_ID | TRACE_NAME | --group TRACE_GROUP)",
 		DisableFlagsInUseLine: true,
 		Short:                 attachShort,
 		Long:                  attachLong,                             // Wrap with templates.LongDesc()
@@ -74,12 +78,21 @@ func NewAttachCommand(factory cmdutil.Factory, streams genericclioptions.IOStrea
 		},
 	}
 
+	cmd.Flags().StringVar(&o.traceGroup, "group", o.traceGroup, "Attach to the output of all the traces belonging to a group")
+
 	return cmd
 }
 
 func (o *AttachOptions) Validate(cmd *cobra.Command, args []string) error {
 	switch len(args) {
+	case 0:
+		if o.traceGroup == "" {
+			return fmt.Errorf("(TRACE_ID | TRACE_NAME | --group TRACE_GROUP) is a required argument for the attach command")
+		}
 	case 1:
+		if o.traceGroup != "" {
+			return fmt.Errorf("specify either a trace or a trace group, not both")
+		}
 		if meta.IsObjectName(args[0]) {
 			o.traceName = &args[0]
 		} else {
@@ -88,7 +101,7 @@ func (o *AttachOptions) Validate(cmd *cobra.Command, args []string) error {
 		}
 		break
 	default:
-		return fmt.Errorf("(TRACE_ID | TRACE_NAME) is a required argument for the attach command")
+		return fmt.Errorf("(TRACE_ID | TRACE_NAME | --group TRACE_GROUP) is a required argument for the attach command")
 	}
 
 	return nil
@@ -128,8 +141,9 @@ func (o *AttachOptions) Run() error {
 	}
 
 	tf := tracejob.TraceJobFilter{
-		Name: o.traceName,
-		ID:   o.traceID,
+		Name:  o.traceName,
+		ID:    o.traceID,
+		Group: groupFilter(o.traceGroup),
 	}
 
 	jobs, err := tc.GetJob(tf)
@@ -142,12 +156,21 @@ func (o *AttachOptions) Run() error {
 		return fmt.Errorf("no trace found with the provided criteria")
 	}
 
-	job := jobs[0]
-
 	ctx := context.Background()
 	ctx = signals.WithStandardSignals(ctx)
 	a := attacher.NewAttacher(coreClient, o.clientConfig, o.IOStreams)
 	a.WithContext(ctx)
+
+	if o.traceGroup != "" {
+		ids := []types.UID{}
+		for _, j := range jobs {
+			ids = append(ids, j.ID)
+		}
+		a.AttachJobs(ids, o.namespace)
+		return nil
+	}
+
+	job := jobs[0]
 	a.AttachJob(job.ID, job.Namespace)
 	return nil
 }
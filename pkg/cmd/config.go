@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/iovisor/kubectl-trace/pkg/config"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	configShort = `Manage the defaults of kubectl trace run` // Wrap with i18n.T()
+	configLong  = `Manage the configuration file holding the defaults of kubectl trace run, ~/.kube/kubectl-trace.yaml unless $KUBECTL_TRACE_CONFIG is set.
+
+The top level values of the file apply to every trace, and the values of the active profile take precedence over them.
+The active profile is the one bound to the current kubeconfig context, or else the current profile.
+Flags given to kubectl trace run always take precedence over the configuration file.`
+
+	configExamples = `
+  # Show the configuration file
+  %[1]s trace config view
+
+  # Use a custom tracerunner image for every trace
+  %[1]s trace config set imageName quay.io/myorg/kubectl-trace-runner:latest
+
+  # Fetch the linux headers in the traces of the prod profile
+  %[1]s trace config set fetchHeaders true --profile prod
+
+  # Use the prod profile by default
+  %[1]s trace config use-profile prod
+
+  # Use the prod profile whenever the prod-cluster kubeconfig context is in use
+  %[1]s trace config use-profile prod --context-name prod-cluster`
+
+	configSetKeys = fmt.Sprintf("KEY is one of %s.", strings.Join(config.Keys(), ", "))
+)
+
+// NewConfigCommand provides the config command and its view, set and use-profile subcommands.
+func NewConfigCommand(factory cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "config SUBCOMMAND",
+		Short:   configShort,
+		Long:    configLong,                             // Wrap with templates.LongDesc()
+		Example: fmt.Sprintf(configExamples, "kubectl"), // Wrap with templates.Examples()
+		Run: func(c *cobra.Command, args []string) {
+			c.Help()
+		},
+	}
+
+	cmd.AddCommand(newConfigViewCommand(factory, streams))
+	cmd.AddCommand(newConfigSetCommand(streams))
+	cmd.AddCommand(newConfigUseProfileCommand(streams))
+	return cmd
+}
+
+func newConfigViewCommand(factory cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	effective := false
+	cmd := &cobra.Command{
+		Use:   "view [--effective]",
+		Short: "Show the configuration file, or the defaults in use with --effective",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			var view interface{}
+			if effective {
+				defaults, err := configDefaults(factory, c)
+				if err != nil {
+					return err
+				}
+				view = defaults
+			} else {
+				cfg, err := config.Load(config.DefaultPath())
+				if err != nil {
+					return err
+				}
+				view = cfg
+			}
+
+			data, err := yaml.Marshal(view)
+			if err != nil {
+				return err
+			}
+			_, err = streams.Out.Write(data)
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&effective, "effective", effective, "Show the defaults in use for the current kubeconfig context, once the active profile is applied")
+	return cmd
+}
+
+func newConfigSetCommand(streams genericclioptions.IOStreams) *cobra.Command {
+	profile := ""
+	cmd := &cobra.Command{
+		Use:   "set KEY VALUE [--profile NAME]",
+		Short: "Set a default at the top level of the configuration file, or in a profile",
+		Long:  "Set a default at the top level of the configuration file, or in a profile created if needed. An empty VALUE unsets the default.\n\n" + configSetKeys,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(c *cobra.Command, args []string) error {
+			path := config.DefaultPath()
+			cfg, err := config.Load(path)
+			if err != nil {
+				return err
+			}
+
+			if profile == "" {
+				if err := cfg.Set(args[0], args[1]); err != nil {
+					return err
+				}
+			} else {
+				p := cfg.Profiles[profile]
+				if err := p.Set(args[0], args[1]); err != nil {
+					return err
+				}
+				if cfg.Profiles == nil {
+					cfg.Profiles = map[string]config.Profile{}
+				}
+				cfg.Profiles[profile] = p
+			}
+
+			if err := cfg.Save(path); err != nil {
+				return err
+			}
+			fmt.Fprintf(streams.Out, "%s set in %s\n", args[0], path)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&profile, "profile", profile, "Profile in which the default is set")
+	return cmd
+}
+
+func newConfigUseProfileCommand(streams genericclioptions.IOStreams) *cobra.Command {
+	contextName := ""
+	cmd := &cobra.Command{
+		Use:   "use-profile NAME [--context-name CONTEXT]",
+		Short: "Set the current profile, or the profile of a kubeconfig context",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			path := config.DefaultPath()
+			cfg, err := config.Load(path)
+			if err != nil {
+				return err
+			}
+
+			name := args[0]
+			if _, ok := cfg.Profiles[name]; !ok {
+				return fmt.Errorf("profile %s not found in %s", name, path)
+			}
+			if contextName == "" {
+				cfg.CurrentProfile = name
+			} else {
+				if cfg.ContextProfiles == nil {
+					cfg.ContextProfiles = map[string]string{}
+				}
+				cfg.ContextProfiles[contextName] = name
+			}
+
+			if err := cfg.Save(path); err != nil {
+				return err
+			}
+			if contextName == "" {
+				fmt.Fprintf(streams.Out, "switched to profile %s\n", name)
+			} else {
+				fmt.Fprintf(streams.Out, "context %s uses profile %s\n", contextName, name)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&contextName, "context-name", contextName, "Kubeconfig context using the profile")
+	return cmd
+}
+
+// configDefaults returns the defaults of the configuration file for the current kubeconfig context.
+func configDefaults(factory cmdutil.Factory, cmd *cobra.Command) (config.Profile, error) {
+	cfg, err := config.Load(config.DefaultPath())
+	if err != nil {
+		return config.Profile{}, err
+	}
+
+	// The raw kubeconfig does not account for the --context flag.
+	context := ""
+	if f := cmd.Flag("context"); f != nil && f.Changed {
+		context = f.Value.String()
+	} else if raw, err := factory.ToRawKubeConfigLoader().RawConfig(); err == nil {
+		context = raw.CurrentContext
+	}
+	return cfg.Defaults(context)
+}
+
+func formatIntPtr(i *int64) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.FormatInt(*i, 10)
+}
+
+func formatInt32Ptr(i *int32) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.FormatInt(int64(*i), 10)
+}
+
+func formatBoolPtr(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
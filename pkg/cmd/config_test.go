@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestApplyRunDefaults(t *testing.T) {
+	cmd := NewRunCommand(nil, genericclioptions.NewTestIOStreamsDiscard())
+	require.NoError(t, cmd.ParseFlags([]string{"--imagename=runner:flag"}))
+
+	deadline := int64(60)
+	fetchHeaders := true
+	require.NoError(t, applyRunDefaults(cmd, config.Profile{
+		ImageName:      "runner:config",
+		ServiceAccount: "tracer",
+		Deadline:       &deadline,
+		FetchHeaders:   &fetchHeaders,
+		MemoryLimit:    "2Gi",
+	}))
+
+	assert.Equal(t, "runner:flag", cmd.Flag("imagename").Value.String())
+	assert.Equal(t, "tracer", cmd.Flag("serviceaccount").Value.String())
+	assert.Equal(t, "60", cmd.Flag("deadline").Value.String())
+	assert.Equal(t, "true", cmd.Flag("fetch-headers").Value.String())
+	assert.Equal(t, "2Gi", cmd.Flag("memory-limit").Value.String())
+	assert.Equal(t, "default", cmd.Flag("serviceaccount").DefValue)
+}
+
+func TestConfigCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubectl-trace.yaml")
+	t.Setenv(config.PathEnvVar, path)
+
+	run := func(args ...string) (string, error) {
+		streams, _, out, _ := genericclioptions.NewTestIOStreams()
+		cmd := NewConfigCommand(nil, streams)
+		cmd.SetArgs(args)
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	_, err := run("set", "serviceAccount", "tracer")
+	require.NoError(t, err)
+	_, err = run("set", "deadline", "600", "--profile", "prod")
+	require.NoError(t, err)
+	_, err = run("set", "deadline", "soon", "--profile", "prod")
+	assert.EqualError(t, err, `invalid value "soon" for deadline, must be an integer`)
+
+	_, err = run("use-profile", "staging")
+	assert.EqualError(t, err, "profile staging not found in "+path)
+	out, err := run("use-profile", "prod", "--context-name", "prod-cluster")
+	require.NoError(t, err)
+	assert.Equal(t, "context prod-cluster uses profile prod\n", out)
+
+	out, err = run("view")
+	require.NoError(t, err)
+	assert.Equal(t, `contextProfiles:
+  prod-cluster: prod
+profiles:
+  prod:
+    deadline: 600
+serviceAccount: tracer
+`, out)
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/iovisor/kubectl-trace/pkg/controller"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+var (
+	controllerShort = `Reconcile TraceJob resources into running traces` // Wrap with i18n.T()
+	controllerLong  = `Run a controller creating a trace for each TraceJob custom resource, and reporting the state of the trace in its status.
+
+The TraceJob custom resource definition must be installed in the cluster, see deploy/crd.yaml.
+The controller runs until interrupted, traces keep running when it is stopped.`
+
+	controllerExamples = `
+  # Reconcile the TraceJobs of the current namespace
+  %[1]s trace controller
+
+  # Reconcile the TraceJobs of all the namespaces
+  %[1]s trace controller --all-namespaces
+
+  # Reconcile TraceJobs using a custom tracerunner image by default
+  %[1]s trace controller --imagename=quay.io/myorg/kubectl-trace-runner:latest`
+
+	workersNotPositiveErrString = "workers must be a positive number"
+)
+
+// ControllerOptions ...
+type ControllerOptions struct {
+	genericclioptions.IOStreams
+	ResourceBuilderFlags *genericclioptions.ResourceBuilderFlags
+
+	namespace           string
+	allNamespaces       bool
+	workers             int
+	imageName           string
+	initImageName       string
+	deadline            int64
+	deadlineGracePeriod int64
+
+	clientConfig *rest.Config
+}
+
+// NewControllerOptions provides an instance of ControllerOptions with default values.
+func NewControllerOptions(streams genericclioptions.IOStreams) *ControllerOptions {
+	rbFlags := &genericclioptions.ResourceBuilderFlags{}
+	rbFlags.WithAllNamespaces(false)
+
+	return &ControllerOptions{
+		IOStreams:            streams,
+		ResourceBuilderFlags: rbFlags,
+
+		workers:             2,
+		imageName:           ImageName + ":" + ImageTag,
+		initImageName:       InitImageName + ":" + InitImageTag,
+		deadline:            int64(DefaultDeadline),
+		deadlineGracePeriod: int64(DefaultDeadlineGracePeriod),
+	}
+}
+
+// NewControllerCommand provides the controller command wrapping ControllerOptions.
+func NewControllerCommand(factory cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewControllerOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:     "controller",
+		Short:   controllerShort,
+		Long:    controllerLong,                             // Wrap with templates.LongDesc()
+		Example: fmt.Sprintf(controllerExamples, "kubectl"), // Wrap with templates.Examples()
+		Args:    cobra.NoArgs,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	o.ResourceBuilderFlags.AddFlags(cmd.Flags())
+	cmd.Flags().IntVar(&o.workers, "workers", o.workers, "Number of TraceJobs reconciled concurrently")
+	cmd.Flags().StringVar(&o.imageName, "imagename", o.imageName, "Tracerunner image for the TraceJobs not specifying one")
+	cmd.Flags().StringVar(&o.initImageName, "init-imagename", o.initImageName, "Init container image for the TraceJobs not specifying one")
+	cmd.Flags().Int64Var(&o.deadline, "deadline", o.deadline, "Deadline in seconds for the TraceJobs not specifying one")
+	cmd.Flags().Int64Var(&o.deadlineGracePeriod, "deadline-grace-period", o.deadlineGracePeriod, "Deadline grace period in seconds for the TraceJobs not specifying one")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating ControllerOptions accordingly.
+func (o *ControllerOptions) Validate(cmd *cobra.Command, args []string) error {
+	if o.workers < 1 {
+		return fmt.Errorf(workersNotPositiveErrString)
+	}
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *ControllerOptions) Complete(factory cmdutil.Factory, cmd *cobra.Command, args []string) error {
+	// Prepare namespace
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	if cmd.Flag("all-namespaces").Changed {
+		o.allNamespaces = *o.ResourceBuilderFlags.AllNamespaces
+		if o.allNamespaces {
+			o.namespace = ""
+		}
+	}
+
+	// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Run executes the controller command.
+func (o *ControllerOptions) Run() error {
+	clientset, err := kubernetes.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	c := controller.New(clientset, dynamicClient, controller.Options{
+		Namespace:           o.namespace,
+		ImageNameTag:        o.imageName,
+		InitImageNameTag:    o.initImageName,
+		Deadline:            o.deadline,
+		DeadlineGracePeriod: o.deadlineGracePeriod,
+	})
+
+	ctx := signals.WithStandardSignals(context.Background())
+	if o.allNamespaces {
+		fmt.Fprintln(o.Out, "reconciling tracejobs in all namespaces")
+	} else {
+		fmt.Fprintf(o.Out, "reconciling tracejobs in namespace %s\n", o.namespace)
+	}
+	return c.Run(ctx, o.workers)
+}
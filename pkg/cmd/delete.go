@@ -25,6 +25,9 @@ var (
   # Delete a specific bpftrace program by name
   %[1]s trace delete kubectl-trace-1bb3ae39-efe8-11e8-9f29-8c164500a77e
 
+  # Delete all the bpftrace programs of a group
+  %[1]s trace delete --group 7f5a7fa9-ee3c-11e8-9e7a-8c164500a77e
+
   # Delete all bpftrace programs in a specific namespace
   %[1]s trace delete -n myns --all
 
@@ -38,6 +41,7 @@ type DeleteOptions struct {
 	ResourceBuilderFlags *genericclioptions.ResourceBuilderFlags
 	traceID              *types.UID
 	traceName            *string
+	traceGroup           string
 	namespace            string
 	clientConfig         *rest.Config
 	all                  bool
@@ -82,6 +86,7 @@ func NewDeleteCommand(factory cmdutil.Factory, streams genericclioptions.IOStrea
 	}
 
 	o.ResourceBuilderFlags.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&o.traceGroup, "group", o.traceGroup, "Delete all the traces belonging to a group")
 
 	return cmd
 }
@@ -125,8 +130,8 @@ func (o *DeleteOptions) Complete(factory cmdutil.Factory, cmd *cobra.Command, ar
 		return err
 	}
 
-	if o.traceID == nil && o.traceName == nil && o.all == false {
-		return fmt.Errorf("when no trace id or trace name are specified you must specify --all=true to delete all the traces")
+	if o.traceID == nil && o.traceName == nil && o.traceGroup == "" && o.all == false {
+		return fmt.Errorf("when no trace id, trace name or trace group are specified you must specify --all=true to delete all the traces")
 	}
 	return nil
 }
@@ -150,8 +155,9 @@ func (o *DeleteOptions) Run() error {
 	tc.WithOutStream(o.Out)
 
 	tf := tracejob.TraceJobFilter{
-		Name: o.traceName,
-		ID:   o.traceID,
+		Name:  o.traceName,
+		ID:    o.traceID,
+		Group: groupFilter(o.traceGroup),
 	}
 
 	err = tc.DeleteJobs(tf)
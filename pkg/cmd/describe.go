@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/iovisor/kubectl-trace/pkg/describe"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+var (
+	describeShort = `Show the details of a trace` // Wrap with i18n.T()
+	describeLong  = `Show the details of a trace: what it traces and how, the state of its job and pods,
+the reasons its containers are waiting or terminated, the events about them, and its program.`
+
+	describeExamples = `
+  # Describe a trace using its id
+  %[1]s trace describe 656ee75a-ee3c-11e8-9e7a-8c164500a77e
+
+  # Describe a trace using its name, in a specific namespace
+  %[1]s trace describe kubectl-trace-656ee75a-ee3c-11e8-9e7a-8c164500a77e -n myns`
+)
+
+// DescribeOptions ...
+type DescribeOptions struct {
+	genericclioptions.IOStreams
+	traceID      *types.UID
+	traceName    *string
+	namespace    string
+	clientConfig *rest.Config
+}
+
+// NewDescribeOptions provides an instance of DescribeOptions with default values.
+func NewDescribeOptions(streams genericclioptions.IOStreams) *DescribeOptions {
+	return &DescribeOptions{
+		IOStreams: streams,
+	}
+}
+
+// NewDescribeCommand provides the describe command wrapping DescribeOptions.
+func NewDescribeCommand(factory cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewDescribeOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "describe (TRACE_ID | TRACE_NAME)",
+		DisableFlagsInUseLine: true,
+		Short:                 describeShort,
+		Long:                  describeLong,                             // Wrap with templates.LongDesc()
+		Example:               fmt.Sprintf(describeExamples, "kubectl"), // Wrap with templates.Examples()
+		Args:                  cobra.ExactArgs(1),
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating DescribeOptions accordingly.
+func (o *DescribeOptions) Validate(cmd *cobra.Command, args []string) error {
+	if meta.IsObjectName(args[0]) {
+		o.traceName = &args[0]
+	} else {
+		tid := types.UID(args[0])
+		o.traceID = &tid
+	}
+
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *DescribeOptions) Complete(factory cmdutil.Factory, cmd *cobra.Command, args []string) error {
+	// Prepare namespace
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Run executes the describe command.
+func (o *DescribeOptions) Run() error {
+	clientset, err := kubernetes.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := tracejob.NewTraceJobClient(clientset, o.namespace)
+	jobs, err := tc.GetJob(tracejob.TraceJobFilter{
+		Name: o.traceName,
+		ID:   o.traceID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(jobs) == 0 {
+		return fmt.Errorf("no trace found with the provided criterias")
+	}
+
+	return describe.NewDescriber(clientset).Describe(jobs[0], o.Out)
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+var (
+	gcShort = `Delete finished and orphaned traces` // Wrap with i18n.T()
+	gcLong  = `Delete the trace jobs which finished longer ago than the retention window, along with their configuration.
+
+Trace configurations older than the retention window whose job does not exist anymore are deleted too.
+Running traces are never deleted.`
+
+	gcExamples = `
+  # Delete the traces of the current namespace which finished more than a day ago
+  %[1]s trace gc
+
+  # Show what would be deleted in all the namespaces with a retention of one hour
+  %[1]s trace gc --all-namespaces --retention=1h --dry-run`
+
+	retentionNegativeErrString = "retention cannot be negative"
+)
+
+// GcOptions ...
+type GcOptions struct {
+	genericclioptions.IOStreams
+	ResourceBuilderFlags *genericclioptions.ResourceBuilderFlags
+
+	retention     time.Duration
+	dryRun        bool
+	namespace     string
+	allNamespaces bool
+
+	clientConfig *rest.Config
+}
+
+// NewGcOptions provides an instance of GcOptions with default values.
+func NewGcOptions(streams genericclioptions.IOStreams) *GcOptions {
+	rbFlags := &genericclioptions.ResourceBuilderFlags{}
+	rbFlags.WithAllNamespaces(false)
+
+	return &GcOptions{
+		IOStreams:            streams,
+		ResourceBuilderFlags: rbFlags,
+
+		retention: 24 * time.Hour,
+	}
+}
+
+// NewGcCommand provides the gc command wrapping GcOptions.
+func NewGcCommand(factory cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewGcOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:     "gc [--retention DURATION] [--dry-run]",
+		Short:   gcShort,
+		Long:    gcLong,                             // Wrap with templates.LongDesc()
+		Example: fmt.Sprintf(gcExamples, "kubectl"), // Wrap with templates.Examples()
+		Args:    cobra.NoArgs,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	o.ResourceBuilderFlags.AddFlags(cmd.Flags())
+	cmd.Flags().DurationVar(&o.retention, "retention", o.retention, "How long finished traces are kept, eg 30m or 24h")
+	cmd.Flags().BoolVar(&o.dryRun, "dry-run", o.dryRun, "Only print the traces which would be deleted")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating GcOptions accordingly.
+func (o *GcOptions) Validate(cmd *cobra.Command, args []string) error {
+	if o.retention < 0 {
+		return fmt.Errorf(retentionNegativeErrString)
+	}
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *GcOptions) Complete(factory cmdutil.Factory, cmd *cobra.Command, args []string) error {
+	// Prepare namespace
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	if cmd.Flag("all-namespaces").Changed {
+		o.allNamespaces = *o.ResourceBuilderFlags.AllNamespaces
+		if o.allNamespaces {
+			o.namespace = ""
+		}
+	}
+
+	// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Run executes the gc command.
+func (o *GcOptions) Run() error {
+	clientset, err := kubernetes.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := tracejob.NewTraceJobClient(clientset, o.namespace)
+	tc.WithOutStream(o.Out)
+	return tc.GarbageCollect(o.retention, o.dryRun)
+}
@@ -3,18 +3,24 @@ package cmd
 import (
 	"fmt"
 	"io"
+	"strings"
 	"text/tabwriter"
 	"time"
 
+	"github.com/iovisor/kubectl-trace/pkg/apis/trace/v1alpha1"
 	"github.com/iovisor/kubectl-trace/pkg/meta"
 	"github.com/iovisor/kubectl-trace/pkg/tracejob"
 	"github.com/spf13/cobra"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/kubectl/pkg/cmd/get"
 	cmdutil "k8s.io/kubectl/pkg/cmd/util"
 
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
 	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
@@ -35,11 +41,27 @@ var (
   # Get only a specific trace in a specific namespace
   %[1]s trace get 656ee75a-ee3c-11e8-9e7a-8c164500a77e -n myns
 
+  # Get all the traces of a group
+  %[1]s trace get --group 7f5a7fa9-ee3c-11e8-9e7a-8c164500a77e
+
+  # Get the aggregated status of every group of traces in a namespace
+  %[1]s trace get --groups -n myns
+
   # Get all traces in all namespaces
-  %[1]s trace get --all-namespaces`
+  %[1]s trace get --all-namespaces
+
+  # Get all traces in a namespace with their tracer, target, process selector, output and deadline
+  %[1]s trace get -n myns -o wide
+
+  # Get a specific trace as JSON
+  %[1]s trace get 656ee75a-ee3c-11e8-9e7a-8c164500a77e -o json
+
+  # Get the name and the node of all traces in a namespace
+  %[1]s trace get -n myns -o custom-columns=NAME:.metadata.name,NODE:.status.node`
 
-	argumentsErr     = fmt.Sprintf("at most one argument for %s command", getCommand)
-	missingTargetErr = "specify either a TRACE_ID or a namespace or all namespaces"
+	argumentsErr          = fmt.Sprintf("at most one argument for %s command", getCommand)
+	missingTargetErr      = "specify either a TRACE_ID or a namespace or all namespaces"
+	groupsOutputErrString = "--groups only supports the default output format"
 )
 
 // GetOptions ...
@@ -55,6 +77,14 @@ type GetOptions struct {
 	clientConfig  *rest.Config
 	traceID       *types.UID
 	traceName     *string
+	traceGroup    string
+	groups        bool
+
+	outputFormat       string
+	noHeaders          bool
+	printFlags         *genericclioptions.PrintFlags
+	customColumnsFlags *get.CustomColumnsPrintFlags
+	printer            printers.ResourcePrinter
 }
 
 // NewGetOptions provides an instance of GetOptions with default values.
@@ -65,6 +95,8 @@ func NewGetOptions(streams genericclioptions.IOStreams) *GetOptions {
 	return &GetOptions{
 		ResourceBuilderFlags: rbFlags,
 		IOStreams:            streams,
+		printFlags:           genericclioptions.NewPrintFlags(""),
+		customColumnsFlags:   get.NewCustomColumnsPrintFlags(),
 	}
 }
 
@@ -94,6 +126,12 @@ func NewGetCommand(factory cmdutil.Factory, streams genericclioptions.IOStreams)
 	}
 
 	o.ResourceBuilderFlags.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&o.traceGroup, "group", o.traceGroup, "Get the traces belonging to a group")
+	cmd.Flags().BoolVar(&o.groups, "groups", o.groups, "Get the aggregated status of groups of traces, rather than single traces")
+	cmd.Flags().StringVarP(&o.outputFormat, "output", "o", o.outputFormat, fmt.Sprintf("Output format. One of: (%s).", strings.Join(o.allowedFormats(), ", ")))
+	cmd.Flags().BoolVar(&o.noHeaders, "no-headers", o.noHeaders, "When using the default, wide or custom-column output format, don't print headers.")
+	o.printFlags.JSONYamlPrintFlags.AddFlags(cmd)
+	o.printFlags.TemplatePrinterFlags.AddFlags(cmd)
 
 	return cmd
 }
@@ -110,6 +148,10 @@ func (o *GetOptions) Validate(cmd *cobra.Command, args []string) error {
 		break
 	}
 
+	if o.groups && o.outputFormat != "" {
+		return fmt.Errorf(groupsOutputErrString)
+	}
+
 	return nil
 }
 
@@ -134,6 +176,12 @@ func (o *GetOptions) Complete(factory cmdutil.Factory, cmd *cobra.Command, args
 		return err
 	}
 
+	// Prepare printer
+	o.printer, err = o.toPrinter()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -156,8 +204,9 @@ func (o *GetOptions) Run() error {
 	tc.WithOutStream(o.Out)
 
 	tf := tracejob.TraceJobFilter{
-		Name: o.traceName,
-		ID:   o.traceID,
+		Name:  o.traceName,
+		ID:    o.traceID,
+		Group: groupFilter(o.traceGroup),
 	}
 
 	jobs, err := tc.GetJob(tf)
@@ -166,34 +215,169 @@ func (o *GetOptions) Run() error {
 		return err
 	}
 
-	// TODO: support other output formats via the o flag, like json, yaml. Not sure if a good idea, trace is not a resource in k8s
-	jobsTablePrint(o.Out, jobs)
-	return nil
+	if o.groups {
+		groupsTablePrint(o.Out, tracejob.GroupTraceJobs(jobs))
+		return nil
+	}
+
+	// A trace asked for explicitly is printed on its own, like kubectl get does for a named resource.
+	if (o.traceID != nil || o.traceName != nil) && len(jobs) == 1 {
+		return o.printer.PrintObj(jobs[0].Object(), o.Out)
+	}
+	return o.printer.PrintObj(tracejob.ObjectList(jobs), o.Out)
 }
 
-// TODO(fntlnz): This needs better printing, perhaps we could use the humanreadable table from k8s itself
-// to be consistent with the main project.
-func jobsTablePrint(o io.Writer, jobs []tracejob.TraceJob) {
-	format := "%s \t %s \t %s \t %s \t %s\t"
-	if len(jobs) == 0 {
-		fmt.Println("No resources found.")
-		return
+// allowedFormats returns the output formats supported by the get command.
+func (o *GetOptions) allowedFormats() []string {
+	formats := []string{"wide"}
+	formats = append(formats, o.printFlags.AllowedFormats()...)
+	return append(formats, o.customColumnsFlags.AllowedFormats()...)
+}
+
+// toPrinter returns the printer for the output format: the trace table by default and
+// for the wide output, and the standard kubectl printers for the other formats.
+func (o *GetOptions) toPrinter() (printers.ResourcePrinter, error) {
+	switch o.outputFormat {
+	case "", "wide":
+		return &traceTablePrinter{wide: o.outputFormat == "wide", noHeaders: o.noHeaders}, nil
+	}
+
+	o.customColumnsFlags.NoHeaders = o.noHeaders
+	if o.printFlags.TemplatePrinterFlags.TemplateArgument != nil {
+		o.customColumnsFlags.TemplateArgument = *o.printFlags.TemplatePrinterFlags.TemplateArgument
+	}
+	if p, err := o.customColumnsFlags.ToPrinter(o.outputFormat); !genericclioptions.IsNoCompatiblePrinterError(err) {
+		return p, err
+	}
+
+	o.printFlags.OutputFormat = &o.outputFormat
+	p, err := o.printFlags.ToPrinter()
+	if genericclioptions.IsNoCompatiblePrinterError(err) {
+		return nil, genericclioptions.NoCompatiblePrinterError{OutputFormat: &o.outputFormat, AllowedFormats: o.allowedFormats()}
+	}
+	if err != nil {
+		return nil, err
 	}
+
+	if o.outputFormat == "name" {
+		// The name printer does not print lists, print their traces one by one like kubectl get does.
+		return printers.ResourcePrinterFunc(func(obj runtime.Object, w io.Writer) error {
+			if !apimeta.IsListType(obj) {
+				return p.PrintObj(obj, w)
+			}
+			items, err := apimeta.ExtractList(obj)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				if err := p.PrintObj(item, w); err != nil {
+					return err
+				}
+			}
+			return nil
+		}), nil
+	}
+	return p, nil
+}
+
+// groupFilter returns the group to filter traces on, if any.
+func groupFilter(group string) *types.UID {
+	if group == "" {
+		return nil
+	}
+	gid := types.UID(group)
+	return &gid
+}
+
+// traceTablePrinter prints traces as a table, the wide table adds the details of what each trace does.
+type traceTablePrinter struct {
+	wide      bool
+	noHeaders bool
+}
+
+// PrintObj prints a TraceJob or a TraceJobList.
+func (p *traceTablePrinter) PrintObj(obj runtime.Object, o io.Writer) error {
+	var traces []v1alpha1.TraceJob
+	switch t := obj.(type) {
+	case *v1alpha1.TraceJob:
+		traces = []v1alpha1.TraceJob{*t}
+	case *v1alpha1.TraceJobList:
+		traces = t.Items
+	default:
+		return fmt.Errorf("unexpected object type %T", obj)
+	}
+
+	if len(traces) == 0 {
+		fmt.Fprintln(o, "No resources found.")
+		return nil
+	}
+
+	columns := []string{"NAMESPACE", "NODE", "NAME", "STATUS", "AGE"}
+	if p.wide {
+		columns = append(columns, "TRACER", "TARGET", "CONTAINER", "SELECTOR", "OUTPUT", "DEADLINE")
+	}
+	format := strings.Repeat("%s \t ", len(columns)-1) + "%s\t"
+
 	// initialize tabwriter
 	w := new(tabwriter.Writer)
 	// minwidth, tabwidth, padding, padchar, flags
 	w.Init(o, 8, 8, 0, '\t', 0)
 	defer w.Flush()
 
-	// TODO(fntlnz): Do the status and age fields, we don't have a way to get them now, so reporting
-	// them as missing.
-	fmt.Fprintf(w, format, "NAMESPACE", "NODE", "NAME", "STATUS", "AGE")
-	for _, j := range jobs {
-		status := j.Status
-		if status == "" {
-			status = tracejob.TraceJobUnknown
+	if !p.noHeaders {
+		fmt.Fprintf(w, format+"\n", stringsToValues(columns)...)
+	}
+	for _, t := range traces {
+		row := []string{t.Namespace, t.Status.Node, t.Name, string(t.Status.Phase), translateTimestampSince(t.Status.StartTime)}
+		if p.wide {
+			row = append(row,
+				valueOrNone(t.Spec.Tracer),
+				valueOrNone(t.Spec.Resource),
+				valueOrNone(t.Spec.Container),
+				valueOrNone(t.Spec.ProcessSelector),
+				valueOrNone(t.Spec.Output),
+				deadlineString(t.Spec.Deadline))
 		}
-		fmt.Fprintf(w, "\n"+format, j.Namespace, j.Target.Node, j.Name, status, translateTimestampSince(j.StartTime))
+		fmt.Fprintf(w, format+"\n", stringsToValues(row)...)
+	}
+	return nil
+}
+
+func stringsToValues(s []string) []interface{} {
+	values := make([]interface{}, len(s))
+	for i := range s {
+		values[i] = s[i]
+	}
+	return values
+}
+
+func valueOrNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
+
+func deadlineString(seconds int64) string {
+	if seconds == 0 {
+		return "<none>"
+	}
+	return duration.HumanDuration(time.Duration(seconds) * time.Second)
+}
+
+func groupsTablePrint(o io.Writer, groups []tracejob.TraceGroup) {
+	format := "%s \t %s \t %d \t %d \t %d \t %d \t %s \t %s\t"
+	if len(groups) == 0 {
+		fmt.Fprintln(o, "No resources found.")
+		return
+	}
+	w := new(tabwriter.Writer)
+	w.Init(o, 8, 8, 0, '\t', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "%s \t %s \t %s \t %s \t %s \t %s \t %s \t %s\t", "NAMESPACE", "GROUP", "TRACES", "RUNNING", "COMPLETED", "FAILED", "STATUS", "AGE")
+	for _, g := range groups {
+		fmt.Fprintf(w, "\n"+format, g.Namespace, g.ID, g.Traces, g.Running, g.Completed, g.Failed, g.Status(), translateTimestampSince(g.StartTime))
 	}
 	fmt.Fprintf(w, "\n")
 }
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/apis/trace/v1alpha1"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func testTraceJobs() []tracejob.TraceJob {
+	return []tracejob.TraceJob{
+		{
+			Name:            "kubectl-trace-1",
+			ID:              "1",
+			Namespace:       "default",
+			Tracer:          "bpftrace",
+			ProcessSelector: "exe=ruby",
+			Output:          "stdout",
+			Deadline:        3600,
+			Status:          tracejob.TraceJobRunning,
+			Target:          tracejob.TraceJobTarget{Node: "node-a", Pod: "api-1", Container: "app"},
+		},
+		{
+			Name:      "kubectl-trace-2",
+			ID:        "2",
+			Namespace: "default",
+			Tracer:    "bpftrace",
+			Output:    "stdout",
+			Target:    tracejob.TraceJobTarget{Node: "node-b"},
+		},
+	}
+}
+
+func printTraceJobs(t *testing.T, output string) string {
+	o := NewGetOptions(genericclioptions.NewTestIOStreamsDiscard())
+	o.outputFormat = output
+	printer, err := o.toPrinter()
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, printer.PrintObj(tracejob.ObjectList(testTraceJobs()), &out))
+	return out.String()
+}
+
+func TestGetPrintTable(t *testing.T) {
+	out := printTraceJobs(t, "")
+	assert.Contains(t, out, "NAMESPACE")
+	assert.Contains(t, out, "kubectl-trace-1")
+	assert.Contains(t, out, "Running")
+	assert.Contains(t, out, "Unknown")
+	assert.NotContains(t, out, "TRACER")
+}
+
+func TestGetPrintWide(t *testing.T) {
+	out := printTraceJobs(t, "wide")
+	assert.Contains(t, out, "TRACER")
+	assert.Contains(t, out, "pod/api-1")
+	assert.Contains(t, out, "node/node-b")
+	assert.Contains(t, out, "exe=ruby")
+	assert.Contains(t, out, "60m")
+}
+
+func TestGetPrintJSON(t *testing.T) {
+	out := printTraceJobs(t, "json")
+
+	list := v1alpha1.TraceJobList{}
+	require.NoError(t, json.Unmarshal([]byte(out), &list))
+	assert.Equal(t, "TraceJobList", list.Kind)
+	require.Len(t, list.Items, 2)
+	assert.Equal(t, "pod/api-1", list.Items[0].Spec.Resource)
+	assert.Equal(t, v1alpha1.TraceJobRunning, list.Items[0].Status.Phase)
+}
+
+func TestGetPrintCustomColumns(t *testing.T) {
+	out := printTraceJobs(t, "custom-columns=NAME:.metadata.name,NODE:.status.node")
+	assert.Equal(t, "NAME              NODE\nkubectl-trace-1   node-a\nkubectl-trace-2   node-b\n", out)
+}
+
+func TestGetPrintName(t *testing.T) {
+	out := printTraceJobs(t, "name")
+	assert.Equal(t, "tracejob.trace.iovisor.org/kubectl-trace-1\ntracejob.trace.iovisor.org/kubectl-trace-2\n", out)
+}
+
+func TestGetUnknownOutput(t *testing.T) {
+	o := NewGetOptions(genericclioptions.NewTestIOStreamsDiscard())
+	o.outputFormat = "xml"
+	_, err := o.toPrinter()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "wide")
+}
@@ -28,6 +28,9 @@ var (
   # Follow logs
   %[1]s trace logs kubectl-trace-d5842929-0b78-11e9-a9fa-40a3cc632df1 -f
 
+  # Logs from all the traces of a group
+  %[1]s trace logs --group 7f5a7fa9-ee3c-11e8-9e7a-8c164500a77e
+
   # Add timestamp to logs
   %[1]s trace logs kubectl-trace-d5842929-0b78-11e9-a9fa-40a3cc632df1 --timestamp
 `
@@ -38,6 +41,7 @@ type LogOptions struct {
 	genericclioptions.IOStreams
 	traceID      *types.UID
 	traceName    *string
+	traceGroup   string
 	namespace    string
 	clientConfig *rest.Config
 	follow       bool
@@ -58,13 +62,13 @@ func NewLogCommand(factory cmdutil.Factory, streams genericclioptions.IOStreams)
 	o := NewLogOptions(streams)
 
 	cmd := &cobra.Command{
-		Use:                   "logs (TRACE_ID | TRACE_NAME) [-f]",
+		Use:                   "logs (TRACE_ID | TRACE_NAME | --group TRACE_GROUP) [-f]",
 		DisableFlagsInUseLine: true,
 		Aliases:               []string{"log"},
 		Short:                 logShort,
 		Long:                  logLong,                             // Wrap with templates.LongDesc()
 		Example:               fmt.Sprintf(logExamples, "kubectl"), // Wrap with templates.Examples()
-		Args:                  cobra.ExactArgs(1),
+		Args:                  cobra.MaximumNArgs(1),
 		PreRunE: func(c *cobra.Command, args []string) error {
 			return o.Validate(c, args)
 		},
@@ -82,11 +86,23 @@ func NewLogCommand(factory cmdutil.Factory, streams genericclioptions.IOStreams)
 
 	cmd.Flags().BoolVarP(&o.follow, "follow", "f", o.follow, "Specify if the logs should be streamed")
 	cmd.Flags().BoolVar(&o.timestamps, "timestamps", o.timestamps, "Include timestamps on each line in the log output")
+	cmd.Flags().StringVar(&o.traceGroup, "group", o.traceGroup, "Print the logs of all the traces belonging to a group")
 	return cmd
 }
 
 // Validate validates the arguments and flags populating LogOptions accordingly.
 func (o *LogOptions) Validate(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		if o.traceGroup == "" {
+			return fmt.Errorf("(TRACE_ID | TRACE_NAME | --group TRACE_GROUP) is a required argument for the logs command")
+		}
+		return nil
+	}
+
+	if o.traceGroup != "" {
+		return fmt.Errorf("specify either a trace or a trace group, not both")
+	}
+
 	if meta.IsObjectName(args[0]) {
 		o.traceName = &args[0]
 	} else {
@@ -126,6 +142,12 @@ func (o *LogOptions) Run() error {
 		return err
 	}
 
+	nl := logs.NewLogs(client, o.IOStreams)
+
+	if o.traceGroup != "" {
+		return nl.RunGroup(types.UID(o.traceGroup), o.namespace, o.follow, o.timestamps)
+	}
+
 	tc := &tracejob.TraceJobClient{
 		JobClient: jobsClient.Jobs(o.namespace),
 	}
@@ -147,7 +169,6 @@ func (o *LogOptions) Run() error {
 
 	job := jobs[0]
 
-	nl := logs.NewLogs(client, o.IOStreams)
 	nl.Run(job.ID, job.Namespace, o.follow, o.timestamps)
 	return nil
 }
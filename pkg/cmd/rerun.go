@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/iovisor/kubectl-trace/pkg/attacher"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+var (
+	rerunShort = `Run a previous trace again` // Wrap with i18n.T()
+	rerunLong  = `Create a new trace running the program of a previous trace, with the same tracer, arguments, process selector and output.
+
+The new trace targets the pod or node of the previous trace, unless another target is given.
+The previous trace must still exist: finished traces are deleted once their TTL is over, an hour by default,
+so run the traces you want to run again later with a longer --ttl.
+The traces whose output was downloaded to a local path cannot be run again, since nobody would download it.`
+
+	rerunExamples = `
+  # Run a trace again, on the same pod or node
+  %[1]s trace rerun 656ee75a-ee3c-11e8-9e7a-8c164500a77e
+
+  # Run a trace again on another pod, and attach to it
+  %[1]s trace rerun kubectl-trace-656ee75a-ee3c-11e8-9e7a-8c164500a77e --target pod/caturday-566d99889-8glv9 -a
+
+  # Run a trace again on another pod, in a specific namespace and container
+  %[1]s trace rerun 656ee75a-ee3c-11e8-9e7a-8c164500a77e --target pod/api-7d5c9 --target-namespace apps -c app
+
+  # Run a trace again on a node
+  %[1]s trace rerun 656ee75a-ee3c-11e8-9e7a-8c164500a77e --target node/kubernetes-node-emt8.c.myproject.internal`
+
+	rerunTargetFlagsErrString = "--container and --target-namespace can only be used along with --target"
+	rerunNotFoundErrString    = "no trace %s found, finished traces are deleted once their TTL is over, run them with a longer --ttl to run them again later"
+	rerunLocalOutputErrString = "trace %s downloaded its output to the local path %s, only traces with the stdout output or an uploaded output can be run again"
+)
+
+// RerunOptions ...
+type RerunOptions struct {
+	genericclioptions.IOStreams
+
+	traceID         *types.UID
+	traceName       *string
+	target          string
+	container       string
+	targetNamespace string
+	attach          bool
+
+	namespace    string
+	clientConfig *rest.Config
+}
+
+// NewRerunOptions provides an instance of RerunOptions with default values.
+func NewRerunOptions(streams genericclioptions.IOStreams) *RerunOptions {
+	return &RerunOptions{
+		IOStreams: streams,
+	}
+}
+
+// NewRerunCommand provides the rerun command wrapping RerunOptions.
+func NewRerunCommand(factory cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewRerunOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "rerun (TRACE_ID | TRACE_NAME) [--target TYPE/NAME] [-c CONTAINER] [--attach]",
+		DisableFlagsInUseLine: true,
+		Short:                 rerunShort,
+		Long:                  rerunLong,                             // Wrap with templates.LongDesc()
+		Example:               fmt.Sprintf(rerunExamples, "kubectl"), // Wrap with templates.Examples()
+		Args:                  cobra.ExactArgs(1),
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				fmt.Fprintln(o.ErrOut, err.Error())
+				return nil
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&o.target, "target", o.target, "Pod or node to trace instead of the target of the previous trace, as TYPE/NAME like for the run command")
+	cmd.Flags().StringVarP(&o.container, "container", "c", o.container, "Specify the container of the new target")
+	cmd.Flags().StringVar(&o.targetNamespace, "target-namespace", o.targetNamespace, "Namespace in which the new target pod exists (if applicable). Defaults to the namespace argument passed to kubectl.")
+	cmd.Flags().BoolVarP(&o.attach, "attach", "a", o.attach, "Whether or not to attach to the trace program once it is created")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating RerunOptions accordingly.
+func (o *RerunOptions) Validate(cmd *cobra.Command, args []string) error {
+	if o.target == "" && (o.container != "" || o.targetNamespace != "") {
+		return fmt.Errorf(rerunTargetFlagsErrString)
+	}
+
+	if meta.IsObjectName(args[0]) {
+		o.traceName = &args[0]
+	} else {
+		tid := types.UID(args[0])
+		o.traceID = &tid
+	}
+
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *RerunOptions) Complete(factory cmdutil.Factory, cmd *cobra.Command, args []string) error {
+	// Prepare namespace
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	if o.targetNamespace == "" {
+		o.targetNamespace = o.namespace
+	}
+
+	// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Run executes the rerun command.
+func (o *RerunOptions) Run() error {
+	clientset, err := kubernetes.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tj, err := o.rerun(clientset)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(o.IOStreams.Out, "trace %s created\n", tj.ID)
+
+	if o.attach {
+		ctx := signals.WithStandardSignals(context.Background())
+		a := attacher.NewAttacher(clientset.CoreV1(), o.clientConfig, o.IOStreams)
+		a.WithContext(ctx)
+		a.AttachJob(tj.ID, tj.Namespace)
+	}
+
+	return nil
+}
+
+// rerun creates the new trace job, after running the same checks as the run command.
+func (o *RerunOptions) rerun(clientset kubernetes.Interface) (*tracejob.TraceJob, error) {
+	tc := tracejob.NewTraceJobClient(clientset, o.namespace)
+	jobs, err := tc.GetJob(tracejob.TraceJobFilter{
+		Name: o.traceName,
+		ID:   o.traceID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(jobs) == 0 {
+		trace := ""
+		if o.traceName != nil {
+			trace = *o.traceName
+		} else if o.traceID != nil {
+			trace = string(*o.traceID)
+		}
+		return nil, fmt.Errorf(rerunNotFoundErrString, trace)
+	}
+	previous := jobs[0]
+
+	// Local outputs are downloaded by the run command that created the trace, nobody would download them now.
+	if previous.Output != "" && (previous.Output[0] == '/' || previous.Output[0] == '.') {
+		return nil, fmt.Errorf(rerunLocalOutputErrString, previous.ID, previous.Output)
+	}
+
+	// Without a new target, the target of the previous trace is resolved again,
+	// since its pod may have been rescheduled or its container restarted.
+	resource, container, targetNamespace := o.target, o.container, o.targetNamespace
+	if resource == "" {
+		resource = previous.Target.Resource()
+		container = previous.Target.Container
+		if previous.Target.Namespace != "" {
+			targetNamespace = previous.Target.Namespace
+		}
+	}
+	if resource == "" {
+		return nil, fmt.Errorf("the target of trace %s is unknown, specify one with --target", previous.ID)
+	}
+
+	// The node of the target must have room for the resources the new trace job requests.
+	targets, err := tracejob.ResolveTraceJobTargets(clientset, resource, container, targetNamespace, tracejob.TargetSelection{
+		Policy:     tracejob.SelectFirst,
+		Requests:   previous.Resources.Requests,
+		NotStarted: previous.WaitForProcess > 0,
+	})
+	if err != nil {
+		return nil, err
+	}
+	target := targets[0]
+
+	// The program may not fit the new target, eg when it uses $container_pid and a node is traced.
+	if previous.Tracer == bpftrace {
+		if err := tracejob.CheckProgram(previous.Program, target.PodUID != ""); err != nil {
+			return nil, fmt.Errorf("invalid bpftrace program: %v", err)
+		}
+	}
+
+	tj := rerunTraceJob(previous, target)
+	if _, err := tc.CreateJob(tj); err != nil {
+		return nil, err
+	}
+	return &tj, nil
+}
+
+// rerunTraceJob returns a new trace job doing what previous did, on target.
+func rerunTraceJob(previous tracejob.TraceJob, target tracejob.TraceJobTarget) tracejob.TraceJob {
+	juid := uuid.NewUUID()
+	return tracejob.TraceJob{
+		Name:                 fmt.Sprintf("%s%s", meta.ObjectNamePrefix, string(juid)),
+		Namespace:            previous.Namespace,
+		ServiceAccount:       previous.ServiceAccount,
+		ID:                   juid,
+		Target:               target,
+		ProcessSelector:      previous.ProcessSelector,
+		WaitForProcess:       previous.WaitForProcess,
+		Tracer:               previous.Tracer,
+		Output:               previous.Output,
+		Program:              previous.Program,
+		ProgramArgs:          previous.ProgramArgs,
+		GoogleAppSecret:      previous.GoogleAppSecret,
+		AWSCredentialsSecret: previous.AWSCredentialsSecret,
+		HTTPHeadersSecret:    previous.HTTPHeadersSecret,
+		HTTPUploadFormat:     previous.HTTPUploadFormat,
+		Format:               previous.Format,
+		EventsSink:           previous.EventsSink,
+		ImageNameTag:         previous.ImageNameTag,
+		InitImageNameTag:     previous.InitImageNameTag,
+		FetchHeaders:         previous.FetchHeaders,
+		Deadline:             previous.Deadline,
+		DeadlineGracePeriod:  previous.DeadlineGracePeriod,
+		TTL:                  previous.TTL,
+		Resources:            previous.Resources,
+		SecurityProfile:      previous.SecurityProfile,
+		Patch:                previous.Patch,
+		PatchType:            previous.PatchType,
+	}
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/errors"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRerunTraceJob(t *testing.T) {
+	previous := tracejob.TraceJob{
+		Name:                "kubectl-trace-1",
+		ID:                  "1",
+		Group:               "group",
+		Namespace:           "default",
+		ServiceAccount:      "tracer",
+		Tracer:              "bpftrace",
+		Target:              tracejob.TraceJobTarget{Node: "node-a", Pod: "api-1"},
+		ProcessSelector:     "exe=ruby",
+		Output:              "stdout",
+		Program:             "kprobe:do_sys_open { @[comm] = count(); }",
+		ProgramArgs:         []string{"1"},
+		ImageNameTag:        "runner:latest",
+		Deadline:            600,
+		DeadlineGracePeriod: 30,
+		Status:              tracejob.TraceJobCompleted,
+	}
+	target := tracejob.TraceJobTarget{Node: "node-b", Pod: "api-2", PodUID: "api-2-uid"}
+
+	tj := rerunTraceJob(previous, target)
+
+	assert.NotEqual(t, previous.ID, tj.ID)
+	assert.Equal(t, meta.ObjectNamePrefix+string(tj.ID), tj.Name)
+	assert.Empty(t, tj.Group)
+	assert.Empty(t, tj.Status)
+	assert.Equal(t, target, tj.Target)
+
+	// Everything else is what the previous trace did.
+	tj.Name, tj.ID, tj.Target = previous.Name, previous.ID, previous.Target
+	previous.Group, previous.Status = "", ""
+	assert.Equal(t, previous, tj)
+}
+
+func rerunTestNode(name, cpu string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"kubernetes.io/hostname": name},
+		},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourcePods: resource.MustParse("110"),
+				corev1.ResourceCPU:  resource.MustParse(cpu),
+			},
+		},
+	}
+}
+
+func TestRerun(t *testing.T) {
+	clientset := fakeclientset.NewSimpleClientset(rerunTestNode("node-a", "4"), rerunTestNode("node-small", "1"))
+	tc := tracejob.NewTraceJobClient(clientset, "default")
+	previous := tracejob.TraceJob{
+		Name:      "kubectl-trace-1",
+		ID:        "1",
+		Namespace: "default",
+		Tracer:    "bpftrace",
+		Target:    tracejob.TraceJobTarget{Node: "node-a"},
+		Output:    "stdout",
+		Program:   "kprobe:do_sys_open { @[comm] = count(); }",
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")},
+		},
+	}
+	_, err := tc.CreateJob(previous)
+	require.NoError(t, err)
+
+	id := types.UID("1")
+	o := &RerunOptions{traceID: &id, namespace: "default", targetNamespace: "default"}
+	tj, err := o.rerun(clientset)
+	require.NoError(t, err)
+	assert.Equal(t, "node-a", tj.Target.Node)
+	assert.Equal(t, "2", tj.Resources.Requests.Cpu().String())
+
+	// The patch of the previous trace is kept on its job, it is not read again from a file.
+	previous.ID, previous.Name = "4", "kubectl-trace-4"
+	previous.Patch, previous.PatchType = "spec:\n  backoffLimit: 3\n", "merge"
+	_, err = tc.CreateJob(previous)
+	require.NoError(t, err)
+	id = "4"
+	tj, err = o.rerun(clientset)
+	require.NoError(t, err)
+	assert.Equal(t, previous.Patch, tj.Patch)
+	job, err := tc.JobClient.Get(context.Background(), tj.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), *job.Spec.BackoffLimit)
+	previous.Patch, previous.PatchType = "", ""
+	id = "1"
+
+	// The requests of the previous trace are checked against the node of the new target.
+	o.target = "node/node-small"
+	_, err = o.rerun(clientset)
+	assert.True(t, errors.IsUnallocatableTargetError(err))
+	assert.Equal(t, errors.CheckInsufficientCPU, errors.FailedCheck(err))
+
+	// The program is checked for the new target like the run command does.
+	previous.ID, previous.Name = "2", "kubectl-trace-2"
+	previous.Program = "uprobe:/proc/$container_pid/exe:main { @ = count(); }"
+	_, err = tc.CreateJob(previous)
+	require.NoError(t, err)
+	id = "2"
+	o.target = ""
+	_, err = o.rerun(clientset)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid bpftrace program")
+
+	// Downloaded outputs would be lost, nobody downloads them.
+	previous.ID, previous.Name, previous.Output = "3", "kubectl-trace-3", "./out"
+	previous.Program = "BEGIN {}"
+	_, err = tc.CreateJob(previous)
+	require.NoError(t, err)
+	id = "3"
+	_, err = o.rerun(clientset)
+	assert.EqualError(t, err, "trace 3 downloaded its output to the local path ./out, only traces with the stdout output or an uploaded output can be run again")
+}
+
+func TestRerunDeletedTrace(t *testing.T) {
+	clientset := fakeclientset.NewSimpleClientset(rerunTestNode("node-a", "4"))
+	tc := tracejob.NewTraceJobClient(clientset, "default")
+	_, err := tc.CreateJob(tracejob.TraceJob{
+		Name:      "kubectl-trace-1",
+		ID:        "1",
+		Namespace: "default",
+		Tracer:    "bpftrace",
+		Target:    tracejob.TraceJobTarget{Node: "node-a"},
+		Output:    "stdout",
+		Program:   "BEGIN {}",
+	})
+	require.NoError(t, err)
+
+	// The job of the previous trace was deleted once its TTL was over.
+	require.NoError(t, clientset.BatchV1().Jobs("default").Delete(context.Background(), "kubectl-trace-1", metav1.DeleteOptions{}))
+
+	name := "kubectl-trace-1"
+	o := &RerunOptions{traceName: &name, namespace: "default", targetNamespace: "default"}
+	_, err = o.rerun(clientset)
+	assert.EqualError(t, err, "no trace kubectl-trace-1 found, finished traces are deleted once their TTL is over, run them with a longer --ttl to run them again later")
+}
@@ -3,17 +3,29 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"strings"
+	"time"
 
 	"github.com/iovisor/kubectl-trace/pkg/attacher"
+	"github.com/iovisor/kubectl-trace/pkg/config"
 	"github.com/iovisor/kubectl-trace/pkg/downloader"
+	"github.com/iovisor/kubectl-trace/pkg/events"
 	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/scripts"
 	"github.com/iovisor/kubectl-trace/pkg/signals"
 	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/iovisor/kubectl-trace/pkg/upload"
 	"github.com/spf13/cobra"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
 	"k8s.io/client-go/kubernetes"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
@@ -36,6 +48,15 @@ var (
 	DefaultDeadlineGracePeriod = 30
 )
 
+const (
+	// dryRunNone creates the trace right away.
+	dryRunNone = "none"
+	// dryRunClient prints the manifests of the trace instead of creating it.
+	dryRunClient = "client"
+	// dryRunServer checks the program with bpftrace --dry-run on the target before creating the trace.
+	dryRunServer = "server"
+)
+
 var (
 	runShort = `Execute a bpftrace program on resources` // Wrap with i18n.T()
 
@@ -52,6 +73,24 @@ var (
   %[1]s trace run pod/nginx -c nginx -e "tracepoint:syscalls:sys_enter_* { @[probe] = count(); }"
   %[1]s trace run pod/nginx nginx -e "tracepoint:syscalls:sys_enter_* { @[probe] = count(); }"
 
+  # Run a bpftrace inline program on every pod of a deployment, each trace being part of the same group
+  %[1]s trace run deploy/nginx --pod-selection=all -e "tracepoint:syscalls:sys_enter_* { @[probe] = count(); }"
+
+  # Run a bpftrace inline program on up to 3 pods matching a label selector, picked at random
+  %[1]s trace run -l app=checkout --pod-selection=random --max-targets=3 -e "tracepoint:syscalls:sys_enter_* { @[probe] = count(); }"
+
+  # Run a bpftrace inline program on every node of a node pool
+  %[1]s trace run nodes -l pool=batch -e "tracepoint:syscalls:sys_enter_* { @[probe] = count(); }"
+
+  # Run a bpftrace inline program on a pod of a statefulset
+  %[1]s trace run sts/postgres -e "tracepoint:syscalls:sys_enter_fsync { @[comm] = count(); }"
+
+  # Run the tcp-retransmits script of the library on a pod, with its port parameter set to 443
+  %[1]s trace run pod/nginx --script tcp-retransmits --set port=443
+
+  # Print the job and config map of a trace as YAML instead of creating them
+  %[1]s trace run pod/nginx -e "tracepoint:syscalls:sys_enter_* { @[probe] = count(); }" --dry-run=client --output-format yaml
+
   # Run a bpftrace inline program on a pod container with a custom image for the init container responsible to fetch linux headers
   %[1]s trace run pod/nginx nginx -e "tracepoint:syscalls:sys_enter_* { @[probe] = count(); } --init-imagename=quay.io/custom-init-image-name --fetch-headers"
 
@@ -62,16 +101,32 @@ var (
 	usageString                            = "(POD | TYPE/NAME)"
 	requiredArgErrString                   = fmt.Sprintf("%s is a required argument for the %s command", usageString, runCommand)
 	containerAsArgOrFlagErrString          = "specify container inline as argument or via its flag"
+	selectorWithResourceErrString          = "specify the pods to trace either via a TYPE/NAME argument or via a selector, not both"
+	containerWithNodesErrString            = "a container cannot be specified when selecting nodes"
+	maxTargetsNegativeErrString            = "max-targets cannot be negative"
+	ttlNegativeErrString                   = "ttl cannot be negative"
+	waitForProcessNegativeErrString        = "wait-for-process cannot be negative"
+	waitForProcessWithNodesErrString       = "--wait-for-process can only be used when tracing pods, as it waits for a process of their container"
 	bpftraceMissingErrString               = "the bpftrace program is mandatory"
-	bpftraceDoubleErrString                = "specify the bpftrace program either via an external file or via a literal string, not both"
+	bpftraceDoubleErrString                = "specify the bpftrace program either via an external file, a literal string or a script, not more than one"
+	scriptWithoutBpftraceErrString         = "scripts can only be used with the bpftrace tracer"
+	setWithoutScriptErrString              = "to use --set you must also specify the --script argument"
 	bpftraceEmptyErrString                 = "the bpftrace programm cannot be empty"
 	bpftracePatchWithoutTypeErrString      = "to use --patch you must also specify the --patch-type argument"
 	bpftracePatchTypeWithoutPatchErrString = "to use --patch-type you must specify the --patch argument"
 	tracerNotFound                         = "unknown tracer %s"
 	tracerNeededForSelectorErrString       = "tracer must be specified when specifying selector"
 	tracerNeededForOutputErrString         = "tracer must be specified when specifying output"
-
-	pidProcessSelectorRequiredForTracer = "a pid process selector must be specified for tracer %s"
+	dryRunUnknownErrString                 = "unknown dry run strategy %s, must be one of none, client, server"
+	dryRunAttachErrString                  = "--attach cannot be used with --dry-run=client, as no trace is created"
+	outputFormatWithoutDryRunErrString     = "to use --output-format you must also specify --dry-run=client"
+	outputFormatUnknownErrString           = "unknown output format %s, must be one of yaml, json"
+	dryRunWithoutBpftraceErrString         = "a dry run can only be done with the bpftrace tracer"
+	httpUploadFormatUnknownErrString       = "unknown http upload format %s, must be one of tar, multipart"
+	httpUploadFormatWithoutHTTPErrString   = "to use --http-upload-format the output must be a http:// or https:// URL"
+	formatUnknownErrString                 = "unknown format %s, must be one of text, json"
+	jsonFormatWithoutBpftraceErrString     = "the json format can only be used with the bpftrace tracer"
+	eventsSinkWithoutJSONErrString         = "to use --events-sink you must also specify --format=json"
 )
 
 // RunOptions ...
@@ -82,8 +137,11 @@ type RunOptions struct {
 	explicitNamespace bool
 
 	// Flags local to this command
-	eval     string
-	filename string
+	eval       string
+	filename   string
+	script     string
+	scriptArgs []string
+	scriptsDir string
 
 	// Flags for generic interface
 	// See TraceRunnerOptions for definitions.
@@ -91,27 +149,53 @@ type RunOptions struct {
 	tracer          string
 	targetNamespace string
 	processSelector string
+	waitForProcess  time.Duration
 	program         string
 	programArgs     []string
 	output          string
 	tracerDefined   bool
 	parsedSelector  *tracejob.ProcessSelector
 
-	googleAppSecret     string
-	serviceAccount      string
-	imageName           string
-	initImageName       string
-	fetchHeaders        bool
-	deadline            int64
-	deadlineGracePeriod int64
-
-	resourceArg string
-	container   string
+	googleAppSecret      string
+	awsCredentialsSecret string
+	httpHeadersSecret    string
+	httpUploadFormat     string
+	format               string
+	eventsSink           string
+	serviceAccount       string
+	imageName            string
+	initImageName        string
+	fetchHeaders         bool
+	deadline             int64
+	deadlineGracePeriod  int64
+	ttl                  int32
+
+	cpuRequest    string
+	cpuLimit      string
+	memoryRequest string
+	memoryLimit   string
+	resources     corev1.ResourceRequirements
+
+	securityProfile       string
+	parsedSecurityProfile tracejob.SecurityProfile
+
+	resourceArg     string
+	container       string
+	selector        string
+	selectNodes     bool
+	podSelection    string
+	maxTargets      int
+	targetSelection tracejob.TargetSelection
 
 	patch     string
 	patchType string
-	attach    bool
-	download  bool
+	// patchContent is the content of the patch file, which is what the trace job keeps.
+	patchContent string
+	attach       bool
+	download     bool
+	dryRun       string
+
+	outputFormat string
 
 	clientConfig *rest.Config
 }
@@ -122,10 +206,20 @@ func NewRunOptions(streams genericclioptions.IOStreams) *RunOptions {
 		IOStreams: streams,
 
 		serviceAccount:      "default",
+		podSelection:        string(tracejob.SelectFirst),
 		imageName:           ImageName + ":" + ImageTag,
 		initImageName:       InitImageName + ":" + InitImageTag,
 		deadline:            int64(DefaultDeadline),
 		deadlineGracePeriod: int64(DefaultDeadlineGracePeriod),
+		ttl:                 tracejob.DefaultTTL,
+		cpuRequest:          tracejob.DefaultCPURequest,
+		cpuLimit:            tracejob.DefaultCPULimit,
+		memoryRequest:       tracejob.DefaultMemoryRequest,
+		memoryLimit:         tracejob.DefaultMemoryLimit,
+		securityProfile:     string(tracejob.SecurityProfilePrivileged),
+		scriptsDir:          scripts.DefaultDir(),
+		dryRun:              dryRunNone,
+		outputFormat:        "yaml",
 	}
 }
 
@@ -134,7 +228,7 @@ func NewRunCommand(factory cmdutil.Factory, streams genericclioptions.IOStreams)
 	o := NewRunOptions(streams)
 
 	cmd := &cobra.Command{
-		Use:          fmt.Sprintf("%s %s [-c CONTAINER] [--attach]", runCommand, usageString),
+		Use:          fmt.Sprintf("%s (%s | [nodes] -l SELECTOR) [-c CONTAINER] [--attach]", runCommand, usageString),
 		Short:        runShort,
 		Long:         runLong,                             // Wrap with templates.LongDesc()
 		Example:      fmt.Sprintf(runExamples, "kubectl"), // Wrap with templates.Examples()
@@ -158,17 +252,29 @@ func NewRunCommand(factory cmdutil.Factory, streams genericclioptions.IOStreams)
 	cmd.Flags().StringVarP(&o.container, "container", "c", o.container, "Specify the container")
 	cmd.Flags().StringVarP(&o.eval, "eval", "e", o.eval, "Literal string to be evaluated as a bpftrace program")
 	cmd.Flags().StringVarP(&o.filename, "filename", "f", o.filename, "File containing a bpftrace program")
+	cmd.Flags().StringVar(&o.script, "script", o.script, "Name of a bpftrace script of the library to run, see kubectl trace scripts list")
+	cmd.Flags().StringArrayVar(&o.scriptArgs, "set", o.scriptArgs, "Parameter of the script as NAME=VALUE, repeat flag for multiple parameters")
+	cmd.Flags().StringVar(&o.scriptsDir, "scripts-dir", o.scriptsDir, "Local directory of scripts, searched before the script config maps of the namespace")
+	cmd.Flags().StringVarP(&o.selector, "selector", "l", o.selector, "Label selector of the pods to trace instead of a TYPE/NAME argument, or of the nodes to trace when given along with a nodes argument")
+	cmd.Flags().StringVar(&o.podSelection, "pod-selection", o.podSelection, "How to pick the pods to trace when the resource or selector has many of them (first, random, all or one-per-node). When many pods are picked, a trace is created for each of them, and the traces are grouped together")
+	cmd.Flags().IntVar(&o.maxTargets, "max-targets", o.maxTargets, "Maximum number of pods or nodes to trace, 0 means one pod for the first and random selections and no limit otherwise")
 
 	// flags for new generic interface
 	cmd.Flags().StringVar(&o.tracer, "tracer", "bpftrace", "Tracing system to use")
 	cmd.Flags().StringVar(&o.targetNamespace, "target-namespace", "", "Namespace in which the target pod exists (if applicable). Defaults to the namespace argument passed to kubectl.")
-	cmd.Flags().StringVar(&o.processSelector, "process-selector", "", "Process Selector (similar to a label query) to filter on")
-	cmd.Flags().StringVar(&o.output, "output", "stdout", "Where to send tracing output (stdout or local path)")
+	cmd.Flags().StringVar(&o.processSelector, "process-selector", "", "Process Selector (similar to a label query) to filter on, eg pid=last,comm in (puma,unicorn),cmdline=~worker")
+	cmd.Flags().DurationVar(&o.waitForProcess, "wait-for-process", o.waitForProcess, "How long the trace waits for a process matching the process selector to appear in the container, eg 60s, for processes which are not started yet")
+	cmd.Flags().StringVar(&o.output, "output", "stdout", outputFlagUsage())
 	cmd.Flags().StringVar(&o.program, "program", o.program, "Program to execute")
+	cmd.Flags().StringVar(&o.format, "format", o.format, "Format of the output of bpftrace: text, or json to stream its events as JSON lines to the events sink (default text)")
+	cmd.Flags().StringVar(&o.eventsSink, "events-sink", o.eventsSink, "Where the events of bpftrace are sent with --format=json: stdout, file:///path in the trace container, otlp+http://host:4318 for an OTLP/HTTP collector or kafka+http://host:8082/topics/TOPIC for a Kafka REST proxy (default stdout)")
 	cmd.Flags().StringArrayVar(&o.programArgs, "args", o.programArgs, "Additional arguments to pass on to program, repeat flag for multiple arguments")
 
 	// global flags
 	cmd.Flags().StringVar(&o.googleAppSecret, "google-application-secret", o.googleAppSecret, "A secret containing a JSON formatted google service account key, for GOOGLE_APPLICATION_CREDENITALS. Used for GCS support.")
+	cmd.Flags().StringVar(&o.awsCredentialsSecret, "aws-credentials-secret", o.awsCredentialsSecret, "A secret whose keys are set as environment variables of the trace, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and optionally AWS_SESSION_TOKEN, AWS_REGION and AWS_ENDPOINT_URL. Used for S3 support.")
+	cmd.Flags().StringVar(&o.httpHeadersSecret, "http-headers-secret", o.httpHeadersSecret, "A secret whose keys are the names of headers, eg Authorization, added with their values to the requests of http:// and https:// outputs")
+	cmd.Flags().StringVar(&o.httpUploadFormat, "http-upload-format", o.httpUploadFormat, "How http:// and https:// outputs are posted, tar for a tarball of the output or multipart for a multipart form per file (default tar)")
 	cmd.Flags().BoolVarP(&o.attach, "attach", "a", o.attach, "Whether or not to attach to the trace program once it is created")
 	cmd.Flags().StringVar(&o.serviceAccount, "serviceaccount", o.serviceAccount, "Service account to use to set in the pod spec of the kubectl-trace job")
 	cmd.Flags().StringVar(&o.imageName, "imagename", o.imageName, "Custom image for the tracerunner")
@@ -176,8 +282,16 @@ func NewRunCommand(factory cmdutil.Factory, streams genericclioptions.IOStreams)
 	cmd.Flags().BoolVar(&o.fetchHeaders, "fetch-headers", o.fetchHeaders, "Whether to fetch linux headers or not")
 	cmd.Flags().Int64Var(&o.deadline, "deadline", o.deadline, "Maximum time to allow trace to run in seconds")
 	cmd.Flags().Int64Var(&o.deadlineGracePeriod, "deadline-grace-period", o.deadlineGracePeriod, "Maximum wait time to print maps or histograms after deadline, in seconds")
+	cmd.Flags().StringVar(&o.cpuRequest, "cpu-request", o.cpuRequest, "CPU requested by the trace containers, and checked against the CPU left on the target nodes")
+	cmd.Flags().StringVar(&o.cpuLimit, "cpu-limit", o.cpuLimit, "CPU limit of the trace containers")
+	cmd.Flags().StringVar(&o.memoryRequest, "memory-request", o.memoryRequest, "Memory requested by the trace containers, and checked against the memory left on the target nodes")
+	cmd.Flags().StringVar(&o.memoryLimit, "memory-limit", o.memoryLimit, "Memory limit of the trace containers")
+	cmd.Flags().StringVar(&o.securityProfile, "security-profile", o.securityProfile, "Privileges of the trace container: privileged, or restricted-bpf to only give it the capabilities its tracer needs")
+	cmd.Flags().Int32Var(&o.ttl, "ttl", o.ttl, "Time to keep the trace job and its configuration once finished, in seconds")
 	cmd.Flags().StringVar(&o.patch, "patch", "", "path of YAML or JSON file used to patch the job definition before creation")
 	cmd.Flags().StringVar(&o.patchType, "patch-type", "", "patch strategy to use: json, merge, or strategic")
+	cmd.Flags().StringVar(&o.dryRun, "dry-run", o.dryRun, "Must be none, client or server. With client, the job and config map of the trace are printed instead of being created. With server, the program is first run with bpftrace --dry-run on the target, and the trace is only created when bpftrace accepts it")
+	cmd.Flags().StringVar(&o.outputFormat, "output-format", o.outputFormat, "Format of the manifests printed with --dry-run=client: yaml or json")
 
 	return cmd
 }
@@ -205,27 +319,88 @@ func (o *RunOptions) Validate(cmd *cobra.Command, args []string) error {
 	}
 	o.parsedSelector = parsed
 
-	err = validateSelectorForTracer(o.tracer, o.parsedSelector)
+	err = tracejob.ValidateSelectorForTracer(o.tracer, o.parsedSelector)
 	if err != nil {
 		return err
 	}
 
+	policy, err := tracejob.ParseSelectionPolicy(o.podSelection)
+	if err != nil {
+		return err
+	}
+	if o.maxTargets < 0 {
+		return fmt.Errorf(maxTargetsNegativeErrString)
+	}
+	if o.waitForProcess < 0 {
+		return fmt.Errorf(waitForProcessNegativeErrString)
+	}
+	if cmd.Flag("script").Changed && o.tracer != bpftrace {
+		return fmt.Errorf(scriptWithoutBpftraceErrString)
+	}
+	if len(o.scriptArgs) > 0 && !cmd.Flag("script").Changed {
+		return fmt.Errorf(setWithoutScriptErrString)
+	}
+	switch o.dryRun {
+	case dryRunNone:
+	case dryRunClient:
+		if o.attach {
+			return fmt.Errorf(dryRunAttachErrString)
+		}
+	case dryRunServer:
+		if o.tracer != bpftrace {
+			return fmt.Errorf(dryRunWithoutBpftraceErrString)
+		}
+	default:
+		return fmt.Errorf(dryRunUnknownErrString, o.dryRun)
+	}
+	if cmd.Flag("output-format").Changed && o.dryRun != dryRunClient {
+		return fmt.Errorf(outputFormatWithoutDryRunErrString)
+	}
+	if o.outputFormat != "yaml" && o.outputFormat != "json" {
+		return fmt.Errorf(outputFormatUnknownErrString, o.outputFormat)
+	}
+
+	o.targetSelection = tracejob.TargetSelection{
+		Policy:     policy,
+		MaxTargets: o.maxTargets,
+		NotStarted: o.waitForProcess > 0,
+	}
+
 	containerFlagDefined := cmd.Flag("container").Changed
 
-	switch len(args) {
-	case 1:
-		o.resourceArg = args[0]
-		break
-	// 2nd argument interpreted as container when provided
-	case 2:
-		o.resourceArg = args[0]
-		o.container = args[1] // NOTE: this should actually be -c, to be consistent with the rest of kubectl
-		if containerFlagDefined {
-			return fmt.Errorf(containerAsArgOrFlagErrString)
+	if len(o.selector) > 0 {
+		// The selector stands for the TYPE/NAME argument, it selects pods unless "nodes" is given instead.
+		switch {
+		case len(args) == 0:
+		case len(args) == 1 && (args[0] == "pods" || args[0] == "pod"):
+		case len(args) == 1 && (args[0] == "nodes" || args[0] == "node"):
+			o.selectNodes = true
+			if containerFlagDefined {
+				return fmt.Errorf(containerWithNodesErrString)
+			}
+		default:
+			return fmt.Errorf(selectorWithResourceErrString)
 		}
-		break
-	default:
-		return fmt.Errorf(requiredArgErrString)
+	} else {
+		switch len(args) {
+		case 1:
+			o.resourceArg = args[0]
+			break
+		// 2nd argument interpreted as container when provided
+		case 2:
+			o.resourceArg = args[0]
+			o.container = args[1] // NOTE: this should actually be -c, to be consistent with the rest of kubectl
+			if containerFlagDefined {
+				return fmt.Errorf(containerAsArgOrFlagErrString)
+			}
+			break
+		default:
+			return fmt.Errorf(requiredArgErrString)
+		}
+	}
+
+	if o.waitForProcess > 0 && o.tracesNodes() {
+		return fmt.Errorf(waitForProcessWithNodesErrString)
 	}
 
 	if len(o.output) == 0 {
@@ -236,32 +411,54 @@ func (o *RunOptions) Validate(cmd *cobra.Command, args []string) error {
 	case o.output == "stdout":
 	case o.output[0] == '/' || o.output[0] == '.':
 		o.download = true
-	case strings.HasPrefix(o.output, "gs://"):
+	case upload.Supported(o.output):
 	default:
 		return fmt.Errorf("unknown output %s", o.output)
 	}
 
-	havePatch := cmd.Flag("patch").Changed
-	havePatchType := cmd.Flag("patch-type").Changed
-
-	if havePatch && !havePatchType {
-		return fmt.Errorf(bpftracePatchWithoutTypeErrString)
+	switch o.httpUploadFormat {
+	case "", upload.HTTPUploadTar, upload.HTTPUploadMultipart:
+	default:
+		return fmt.Errorf(httpUploadFormatUnknownErrString, o.httpUploadFormat)
+	}
+	if o.httpUploadFormat != "" && !strings.HasPrefix(o.output, "http://") && !strings.HasPrefix(o.output, "https://") {
+		return fmt.Errorf(httpUploadFormatWithoutHTTPErrString)
 	}
 
-	if !havePatch && havePatchType {
-		return fmt.Errorf(bpftracePatchTypeWithoutPatchErrString)
+	switch o.format {
+	case "", events.TextFormat:
+	case events.JSONFormat:
+		if o.tracer != bpftrace {
+			return fmt.Errorf(jsonFormatWithoutBpftraceErrString)
+		}
+	default:
+		return fmt.Errorf(formatUnknownErrString, o.format)
+	}
+	if o.eventsSink != "" {
+		if o.format != events.JSONFormat {
+			return fmt.Errorf(eventsSinkWithoutJSONErrString)
+		}
+		if err := events.ValidateSink(o.eventsSink); err != nil {
+			return err
+		}
 	}
 
 	switch o.tracer {
 	case bpftrace, bcc:
-		evalDefined, filenameDefined, programDefined := cmd.Flag("eval").Changed, cmd.Flag("filename").Changed, cmd.Flag("program").Changed
-		if !evalDefined && !filenameDefined && !programDefined {
+		evalDefined, filenameDefined, programDefined, scriptDefined := cmd.Flag("eval").Changed, cmd.Flag("filename").Changed, cmd.Flag("program").Changed, cmd.Flag("script").Changed
+		defined := 0
+		for _, d := range []bool{evalDefined, filenameDefined, programDefined, scriptDefined} {
+			if d {
+				defined++
+			}
+		}
+		if defined == 0 {
 			return fmt.Errorf(bpftraceMissingErrString)
 		}
-		if (evalDefined && filenameDefined) || (evalDefined && programDefined) || (filenameDefined && programDefined) {
+		if defined > 1 {
 			return fmt.Errorf(bpftraceDoubleErrString)
 		}
-		if (evalDefined && len(o.eval) == 0) || (filenameDefined && len(o.filename) == 0) || (programDefined && len(o.program) == 0) {
+		if (evalDefined && len(o.eval) == 0) || (filenameDefined && len(o.filename) == 0) || (programDefined && len(o.program) == 0) || (scriptDefined && len(o.script) == 0) {
 			return fmt.Errorf(bpftraceEmptyErrString)
 		}
 	default:
@@ -270,6 +467,15 @@ func (o *RunOptions) Validate(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// tracesNodes tells whether nodes are traced rather than the containers of pods, like a NAME argument without a TYPE does.
+func (o *RunOptions) tracesNodes() bool {
+	if len(o.selector) > 0 {
+		return o.selectNodes
+	}
+	resourceType, _, found := strings.Cut(o.resourceArg, "/")
+	return !found || resourceType == "node"
+}
+
 // Complete completes the setup of the command.
 func (o *RunOptions) Complete(factory cmdutil.Factory, cmd *cobra.Command, args []string) error {
 	// Prepare program
@@ -298,66 +504,182 @@ func (o *RunOptions) Complete(factory cmdutil.Factory, cmd *cobra.Command, args
 		o.targetNamespace = o.namespace
 	}
 
+	// Prepare defaults, the flags which are not given default to the configuration file
+	defaults, err := configDefaults(factory, cmd)
+	if err != nil {
+		return err
+	}
+	if err := applyRunDefaults(cmd, defaults); err != nil {
+		return err
+	}
+
+	if o.patch != "" && o.patchType == "" {
+		return fmt.Errorf(bpftracePatchWithoutTypeErrString)
+	}
+	if o.patch == "" && o.patchType != "" {
+		return fmt.Errorf(bpftracePatchTypeWithoutPatchErrString)
+	}
+	if o.patch != "" {
+		b, err := ioutil.ReadFile(o.patch)
+		if err != nil {
+			return fmt.Errorf("failed to read patch file %s: %v", o.patch, err)
+		}
+		o.patchContent = string(b)
+	}
+	if o.ttl < 0 {
+		return fmt.Errorf(ttlNegativeErrString)
+	}
+	o.parsedSecurityProfile, err = tracejob.ParseSecurityProfile(o.securityProfile)
+	if err != nil {
+		return err
+	}
+	o.resources, err = tracejob.ResourceRequirements(o.cpuRequest, o.cpuLimit, o.memoryRequest, o.memoryLimit)
+	if err != nil {
+		return err
+	}
+	o.targetSelection.Requests = o.resources.Requests
+
 	// Prepare client
 	o.clientConfig, err = factory.ToRESTConfig()
 	if err != nil {
 		return err
 	}
 
+	// Prepare the program of the script, once its parameters are set
+	if o.script != "" {
+		values, err := scripts.ParseValues(o.scriptArgs)
+		if err != nil {
+			return err
+		}
+		clientset, err := kubernetes.NewForConfig(o.clientConfig)
+		if err != nil {
+			return err
+		}
+		lib := &scripts.Library{Dir: o.scriptsDir, ConfigMaps: clientset.CoreV1().ConfigMaps(o.namespace)}
+		script, err := lib.Get(o.script)
+		if err != nil {
+			return err
+		}
+		o.program, err = script.Render(values)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 // Run executes the run command.
 func (o *RunOptions) Run() error {
-	juid := uuid.NewUUID()
-
 	clientset, err := kubernetes.NewForConfig(o.clientConfig)
 	if err != nil {
 		return err
 	}
 
-	target, err := tracejob.ResolveTraceJobTarget(clientset, o.resourceArg, o.container, o.targetNamespace)
+	var targets []tracejob.TraceJobTarget
+	if o.selectNodes {
+		targets, err = tracejob.ResolveNodeTargetsBySelector(clientset, o.selector, o.targetSelection)
+	} else if len(o.selector) > 0 {
+		targets, err = tracejob.ResolveTraceJobTargetsBySelector(clientset, o.selector, o.container, o.targetNamespace, o.targetSelection)
+	} else {
+		targets, err = tracejob.ResolveTraceJobTargets(clientset, o.resourceArg, o.container, o.targetNamespace, o.targetSelection)
+	}
 
 	if err != nil {
 		return err
 	}
 
+	// Catch the mistakes in the program before any trace job is scheduled.
+	if o.tracer == bpftrace && len(targets) > 0 {
+		if err := tracejob.CheckProgram(o.program, targets[0].PodUID != ""); err != nil {
+			return fmt.Errorf("invalid bpftrace program: %v", err)
+		}
+	}
+
 	tc := tracejob.NewTraceJobClient(clientset, o.namespace)
 
-	tj := tracejob.TraceJob{
-		Name:                fmt.Sprintf("%s%s", meta.ObjectNamePrefix, string(juid)),
-		Namespace:           o.namespace,
-		ServiceAccount:      o.serviceAccount,
-		ID:                  juid,
-		Target:              *target,
-		ProcessSelector:     o.processSelector,
-		Tracer:              o.tracer,
-		Output:              o.output,
-		Program:             o.program,
-		ProgramArgs:         o.programArgs,
-		GoogleAppSecret:     o.googleAppSecret,
-		ImageNameTag:        o.imageName,
-		InitImageNameTag:    o.initImageName,
-		FetchHeaders:        o.fetchHeaders,
-		Deadline:            o.deadline,
-		DeadlineGracePeriod: o.deadlineGracePeriod,
-		Patch:               o.patch,
-		PatchType:           o.patchType,
-	}
-
-	job, err := tc.CreateJob(tj)
-	if err != nil {
-		return err
+	// Traces fanned out over several pods or nodes share a group, so they can be managed together.
+	var group types.UID
+	if o.selectNodes || o.targetSelection.FansOut() {
+		group = uuid.NewUUID()
 	}
 
-	fmt.Fprintf(o.IOStreams.Out, "trace %s created\n", tj.ID)
+	tjs := []tracejob.TraceJob{}
+	manifests := []runtime.Object{}
+	for _, target := range targets {
+		juid := uuid.NewUUID()
+		tj := tracejob.TraceJob{
+			Name:                 fmt.Sprintf("%s%s", meta.ObjectNamePrefix, string(juid)),
+			Namespace:            o.namespace,
+			ServiceAccount:       o.serviceAccount,
+			ID:                   juid,
+			Group:                group,
+			Target:               target,
+			ProcessSelector:      o.processSelector,
+			WaitForProcess:       o.waitForProcess,
+			Tracer:               o.tracer,
+			Output:               o.output,
+			Program:              o.program,
+			ProgramArgs:          o.programArgs,
+			GoogleAppSecret:      o.googleAppSecret,
+			AWSCredentialsSecret: o.awsCredentialsSecret,
+			HTTPHeadersSecret:    o.httpHeadersSecret,
+			HTTPUploadFormat:     o.httpUploadFormat,
+			Format:               o.format,
+			EventsSink:           o.eventsSink,
+			ImageNameTag:         o.imageName,
+			InitImageNameTag:     o.initImageName,
+			FetchHeaders:         o.fetchHeaders,
+			Deadline:             o.deadline,
+			DeadlineGracePeriod:  o.deadlineGracePeriod,
+			TTL:                  &o.ttl,
+			Resources:            o.resources,
+			SecurityProfile:      o.parsedSecurityProfile,
+			Patch:                o.patchContent,
+			PatchType:            o.patchType,
+		}
+
+		if o.dryRun == dryRunClient {
+			job, cm, err := tj.Manifests()
+			if err != nil {
+				return err
+			}
+			manifests = append(manifests, job, cm)
+			continue
+		}
+
+		// Checking the program on the first target is enough, the others have the same kind of target.
+		if o.dryRun == dryRunServer && len(tjs) == 0 {
+			fmt.Fprintf(o.IOStreams.Out, "checking the program on %s\n", target.Resource())
+			if _, err := tracejob.DryRun(clientset, tj, tracejob.DefaultDryRunTimeout); err != nil {
+				return err
+			}
+			fmt.Fprintln(o.IOStreams.Out, "bpftrace accepted the program")
+		}
+
+		_, err := tc.CreateJob(tj)
+		if err != nil {
+			return deleteCreatedTraces(tc, o.IOStreams.ErrOut, group, tjs, err)
+		}
+
+		fmt.Fprintf(o.IOStreams.Out, "trace %s created\n", tj.ID)
+		tjs = append(tjs, tj)
+	}
+
+	if o.dryRun == dryRunClient {
+		return printManifests(o.IOStreams.Out, o.outputFormat, manifests)
+	}
+
+	if group != "" {
+		fmt.Fprintf(o.IOStreams.Out, "trace group %s created\n", group)
+	}
 
 	if o.download {
 		if o.attach {
-			go o.waitOnDownload(tj, clientset.CoreV1())
+			go o.waitOnDownload(group, tjs, clientset.CoreV1())
 		} else {
 			fmt.Fprintln(o.IOStreams.Out, "waiting for trace to be downloaded")
-			o.waitOnDownload(tj, clientset.CoreV1())
+			o.waitOnDownload(group, tjs, clientset.CoreV1())
 		}
 	}
 
@@ -366,35 +688,134 @@ func (o *RunOptions) Run() error {
 		ctx = signals.WithStandardSignals(ctx)
 		a := attacher.NewAttacher(clientset.CoreV1(), o.clientConfig, o.IOStreams)
 		a.WithContext(ctx)
-		a.AttachJob(tj.ID, job.Namespace)
+		if len(tjs) == 1 {
+			a.AttachJob(tjs[0].ID, tjs[0].Namespace)
+		} else {
+			a.AttachJobs(traceJobIDs(tjs), o.namespace)
+		}
 	}
 
 	return nil
 }
 
-func (o *RunOptions) waitOnDownload(tj tracejob.TraceJob, coreClient corev1client.CoreV1Interface) {
+func (o *RunOptions) waitOnDownload(group types.UID, tjs []tracejob.TraceJob, coreClient corev1client.CoreV1Interface) {
 	d := downloader.New(coreClient, o.clientConfig)
-	err := d.Start(tj.ID, tj.Namespace, o.output, MetadataDir)
+
+	var err error
+	var filename string
+	if group != "" {
+		err = d.StartGroup(group, traceJobIDs(tjs), o.namespace, o.output, MetadataDir)
+		filename = downloader.Filename(group)
+	} else {
+		err = d.Start(tjs[0].ID, tjs[0].Namespace, o.output, MetadataDir)
+		filename = downloader.Filename(tjs[0].ID)
+	}
 	if err != nil {
 		fmt.Fprintf(o.IOStreams.ErrOut, "[downloader] %s\n", err.Error())
 		return
 	}
-	fmt.Fprintf(o.IOStreams.Out, "downloaded %v\n", downloader.Filename(tj.ID))
+	fmt.Fprintf(o.IOStreams.Out, "downloaded %v\n", filename)
 }
 
-func validateSelectorForTracer(tracer string, selector *tracejob.ProcessSelector) error {
-	switch tracer {
-	case bcc, bpftrace:
-	case fake:
-		if _, ok := selector.Pid(); !ok {
-			return fmt.Errorf(pidProcessSelectorRequiredForTracer, fake)
+// printManifests prints the objects of traces, as a stream of YAML documents or as a JSON list.
+func printManifests(out io.Writer, format string, objs []runtime.Object) error {
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *batchv1.Job:
+			o.SetGroupVersionKind(batchv1.SchemeGroupVersion.WithKind("Job"))
+		case *corev1.ConfigMap:
+			o.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		}
+	}
+
+	if format == "json" {
+		list := &corev1.List{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"}}
+		for _, obj := range objs {
+			list.Items = append(list.Items, runtime.RawExtension{Object: obj})
 		}
-	case rbspy:
-		if _, ok := selector.Pid(); !ok {
-			return fmt.Errorf(pidProcessSelectorRequiredForTracer, rbspy)
+		return (&printers.JSONPrinter{}).PrintObj(list, out)
+	}
+
+	p := &printers.YAMLPrinter{}
+	for _, obj := range objs {
+		if err := p.PrintObj(obj, out); err != nil {
+			return err
 		}
-	default:
 	}
+	return nil
+}
+
+// deleteCreatedTraces deletes the traces created before creating another one failed with err,
+// so that no part of a trace group is left running. The traces which could not be deleted are listed in the error.
+func deleteCreatedTraces(tc *tracejob.TraceJobClient, out io.Writer, group types.UID, tjs []tracejob.TraceJob, err error) error {
+	if len(tjs) == 0 {
+		return err
+	}
+
+	fmt.Fprintf(out, "could not create every trace: %v, deleting the traces already created\n", err)
+	tc.WithOutStream(out)
+	left := []string{}
+	for _, tj := range tjs {
+		id := tj.ID
+		if derr := tc.DeleteJobs(tracejob.TraceJobFilter{ID: &id}); derr != nil {
+			fmt.Fprintf(out, "could not delete trace %s: %v\n", tj.ID, derr)
+			left = append(left, string(tj.ID))
+		}
+	}
+	if len(left) > 0 {
+		if group != "" {
+			return fmt.Errorf("%v, and traces %s of group %s are still running, delete them with kubectl trace delete --group %s", err, strings.Join(left, ", "), group, group)
+		}
+		return fmt.Errorf("%v, and traces %s are still running", err, strings.Join(left, ", "))
+	}
+	return err
+}
+
+// outputFlagUsage describes the --output flag, with the URI schemes of the registered uploaders.
+func outputFlagUsage() string {
+	schemes := []string{}
+	for _, scheme := range upload.Schemes() {
+		schemes = append(schemes, scheme+"://")
+	}
+	return fmt.Sprintf("Where to send tracing output: stdout, a local path, or a URI to upload it to (%s)", strings.Join(schemes, ", "))
+}
+
+func traceJobIDs(tjs []tracejob.TraceJob) []types.UID {
+	ids := make([]types.UID, 0, len(tjs))
+	for _, tj := range tjs {
+		ids = append(ids, tj.ID)
+	}
+	return ids
+}
 
+// applyRunDefaults sets the flags of the run command which are not given to the defaults of the configuration file.
+func applyRunDefaults(cmd *cobra.Command, defaults config.Profile) error {
+	for flag, value := range map[string]string{
+		"imagename":                 defaults.ImageName,
+		"init-imagename":            defaults.InitImageName,
+		"serviceaccount":            defaults.ServiceAccount,
+		"deadline":                  formatIntPtr(defaults.Deadline),
+		"deadline-grace-period":     formatIntPtr(defaults.DeadlineGracePeriod),
+		"fetch-headers":             formatBoolPtr(defaults.FetchHeaders),
+		"patch":                     defaults.Patch,
+		"patch-type":                defaults.PatchType,
+		"google-application-secret": defaults.GoogleAppSecret,
+		"aws-credentials-secret":    defaults.AWSCredentialsSecret,
+		"http-headers-secret":       defaults.HTTPHeadersSecret,
+		"ttl":                       formatInt32Ptr(defaults.TTL),
+		"security-profile":          defaults.SecurityProfile,
+		"cpu-request":               defaults.CPURequest,
+		"cpu-limit":                 defaults.CPULimit,
+		"memory-request":            defaults.MemoryRequest,
+		"memory-limit":              defaults.MemoryLimit,
+		"scripts-dir":               defaults.ScriptsDir,
+	} {
+		if value == "" || cmd.Flag(flag).Changed {
+			continue
+		}
+		if err := cmd.Flags().Set(flag, value); err != nil {
+			return fmt.Errorf("invalid %s in the configuration file: %v", flag, err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestPrintManifests(t *testing.T) {
+	tj := tracejob.TraceJob{Name: "kubectl-trace-1", ID: "1", Namespace: "default", Tracer: "bpftrace", Program: "BEGIN {}"}
+	job, cm, err := tj.Manifests()
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, printManifests(&out, "yaml", []runtime.Object{job, cm}))
+	assert.Regexp(t, `(?s)^apiVersion: batch/v1\nkind: Job\n.*name: kubectl-trace-1\n.*---\napiVersion: v1\n.*kind: ConfigMap\n`, out.String())
+	assert.Contains(t, out.String(), "program.bt: BEGIN {}")
+
+	out.Reset()
+	require.NoError(t, printManifests(&out, "json", []runtime.Object{job, cm}))
+	assert.Regexp(t, `(?s)^\{\n    "kind": "List",\n    "apiVersion": "v1",.*"kind": "Job",.*"kind": "ConfigMap",`, out.String())
+}
+
+func TestOutputFlagUsage(t *testing.T) {
+	assert.Equal(t, "Where to send tracing output: stdout, a local path, or a URI to upload it to (file://, gs://, http://, https://, s3://)", outputFlagUsage())
+
+	// -o is not taken by the format of the dry run, as it stands for --output in the other commands.
+	cmd := NewRunCommand(nil, genericclioptions.NewTestIOStreamsDiscard())
+	assert.Empty(t, cmd.Flag("output-format").Shorthand)
+	assert.Nil(t, cmd.Flags().ShorthandLookup("o"))
+}
+
+func TestValidateWaitForProcess(t *testing.T) {
+	tests := map[string]struct {
+		args     []string
+		expected string
+	}{
+		"pod":           {args: []string{"pod/api-1", "--wait-for-process=1m"}},
+		"deployment":    {args: []string{"deploy/api", "--wait-for-process=1m"}},
+		"pod selector":  {args: []string{"-l", "app=api", "--wait-for-process=1m"}},
+		"node":          {args: []string{"node/node-a", "--wait-for-process=1m"}, expected: waitForProcessWithNodesErrString},
+		"node name":     {args: []string{"node-a", "--wait-for-process=1m"}, expected: waitForProcessWithNodesErrString},
+		"node selector": {args: []string{"nodes", "-l", "pool=a", "--wait-for-process=1m"}, expected: waitForProcessWithNodesErrString},
+		"node no wait":  {args: []string{"node/node-a"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmd := NewRunCommand(nil, genericclioptions.NewTestIOStreamsDiscard())
+			require.NoError(t, cmd.ParseFlags(append(tt.args, "-e", "BEGIN {}")))
+			err := cmd.PreRunE(cmd, cmd.Flags().Args())
+			if tt.expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDeleteCreatedTraces(t *testing.T) {
+	clientset := fakeclientset.NewSimpleClientset()
+	tc := tracejob.NewTraceJobClient(clientset, "default")
+
+	created := []tracejob.TraceJob{}
+	for _, id := range []types.UID{"1", "2"} {
+		tj := tracejob.TraceJob{Name: "kubectl-trace-" + string(id), ID: id, Group: "group-1", Namespace: "default", Tracer: "bpftrace", Program: "BEGIN {}"}
+		_, err := tc.CreateJob(tj)
+		require.NoError(t, err)
+		created = append(created, tj)
+	}
+
+	var out bytes.Buffer
+	err := deleteCreatedTraces(tc, &out, "group-1", created, fmt.Errorf("quota exceeded"))
+	assert.EqualError(t, err, "quota exceeded")
+	assert.Contains(t, out.String(), "could not create every trace: quota exceeded, deleting the traces already created\n")
+
+	jobs, err := clientset.BatchV1().Jobs("default").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, jobs.Items)
+
+	clientset.PrependReactor("delete", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("forbidden")
+	})
+	_, err = tc.CreateJob(created[0])
+	require.NoError(t, err)
+	err = deleteCreatedTraces(tc, &out, "group-1", created[:1], fmt.Errorf("quota exceeded"))
+	assert.EqualError(t, err, "quota exceeded, and traces 1 of group group-1 are still running, delete them with kubectl trace delete --group group-1")
+
+	assert.EqualError(t, deleteCreatedTraces(tc, &out, "", nil, fmt.Errorf("quota exceeded")), "quota exceeded")
+}
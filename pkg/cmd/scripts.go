@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iovisor/kubectl-trace/pkg/scripts"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/client-go/kubernetes"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+var (
+	scriptsShort = `List and show the bpftrace scripts of the library` // Wrap with i18n.T()
+	scriptsLong  = `List and show the named bpftrace scripts which can be run with kubectl trace run --script.
+
+Scripts are the .bt files of a local directory, ~/.kube/kubectl-trace-scripts unless --scripts-dir is given,
+and the .bt keys of the config maps labelled iovisor.org/kubectl-trace-scripts in the namespace.
+The local scripts take precedence over the ones of the config maps.
+
+The leading comment lines of a script describe it. Its parameters are Go template actions,
+{{ param "port" }} for a required parameter and {{ param "port" "443" }} for a parameter with a default value.`
+
+	scriptsExamples = `
+  # List the scripts of the library
+  %[1]s trace scripts list
+
+  # Show the description, parameters and program of a script
+  %[1]s trace scripts show tcp-retransmits
+
+  # Publish a script in the cluster, for everybody tracing in the namespace
+  kubectl create configmap tcp-scripts --from-file=tcp-retransmits.bt
+  kubectl label configmap tcp-scripts iovisor.org/kubectl-trace-scripts=true`
+)
+
+// ScriptsOptions ...
+type ScriptsOptions struct {
+	genericclioptions.IOStreams
+
+	scriptsDir string
+	library    *scripts.Library
+}
+
+// NewScriptsOptions provides an instance of ScriptsOptions with default values.
+func NewScriptsOptions(streams genericclioptions.IOStreams) *ScriptsOptions {
+	return &ScriptsOptions{
+		IOStreams:  streams,
+		scriptsDir: scripts.DefaultDir(),
+	}
+}
+
+// NewScriptsCommand provides the scripts command and its list and show subcommands.
+func NewScriptsCommand(factory cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewScriptsOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:     "scripts SUBCOMMAND",
+		Short:   scriptsShort,
+		Long:    scriptsLong,                             // Wrap with templates.LongDesc()
+		Example: fmt.Sprintf(scriptsExamples, "kubectl"), // Wrap with templates.Examples()
+		Run: func(c *cobra.Command, args []string) {
+			c.Help()
+		},
+	}
+	cmd.PersistentFlags().StringVar(&o.scriptsDir, "scripts-dir", o.scriptsDir, "Local directory of scripts, searched before the script config maps of the namespace")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the scripts of the library",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			return o.RunList()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show NAME",
+		Short: "Show the description, parameters and program of a script",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			return o.RunShow(args[0])
+		},
+	})
+
+	return cmd
+}
+
+// Complete completes the setup of the command.
+func (o *ScriptsOptions) Complete(factory cmdutil.Factory, cmd *cobra.Command, args []string) error {
+	if !cmd.Flag("scripts-dir").Changed {
+		defaults, err := configDefaults(factory, cmd)
+		if err != nil {
+			return err
+		}
+		if defaults.ScriptsDir != "" {
+			o.scriptsDir = defaults.ScriptsDir
+		}
+	}
+
+	namespace, _, err := factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+	clientConfig, err := factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(clientConfig)
+	if err != nil {
+		return err
+	}
+
+	o.library = &scripts.Library{Dir: o.scriptsDir, ConfigMaps: clientset.CoreV1().ConfigMaps(namespace)}
+	return nil
+}
+
+// RunList lists the scripts of the library.
+func (o *ScriptsOptions) RunList() error {
+	list, err := o.library.List()
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		fmt.Fprintln(o.ErrOut, "No scripts found.")
+		return nil
+	}
+
+	w := printers.GetNewTabWriter(o.Out)
+	fmt.Fprintln(w, "NAME\tPARAMETERS\tSOURCE\tDESCRIPTION")
+	for _, s := range list {
+		names := []string{}
+		params, err := s.Params()
+		if err != nil {
+			return err
+		}
+		for _, p := range params {
+			names = append(names, p.Name)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Name, valueOrNone(strings.Join(names, ",")), s.Source, s.Description())
+	}
+	return w.Flush()
+}
+
+// RunShow shows the script called name.
+func (o *ScriptsOptions) RunShow(name string) error {
+	s, err := o.library.Get(name)
+	if err != nil {
+		return err
+	}
+	params, err := s.Params()
+	if err != nil {
+		return err
+	}
+
+	w := printers.GetNewTabWriter(o.Out)
+	fmt.Fprintf(w, "Name:\t%s\n", s.Name)
+	fmt.Fprintf(w, "Source:\t%s\n", s.Source)
+	fmt.Fprintf(w, "Description:\t%s\n", valueOrNone(s.Description()))
+	if len(params) == 0 {
+		fmt.Fprintf(w, "Parameters:\t<none>\n")
+	} else {
+		fmt.Fprintf(w, "Parameters:\n")
+		for _, p := range params {
+			if p.Required {
+				fmt.Fprintf(w, "  %s\t(required)\n", p.Name)
+			} else {
+				fmt.Fprintf(w, "  %s\t(default %q)\n", p.Name, p.Default)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(o.Out, "Program:\n%s", s.Program)
+	if !strings.HasSuffix(s.Program, "\n") {
+		fmt.Fprintln(o.Out)
+	}
+	return nil
+}
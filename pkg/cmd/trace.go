@@ -70,11 +70,17 @@ func NewTraceCommand(streams genericclioptions.IOStreams) *cobra.Command {
 	f := cmdutil.NewFactory(matchVersionFlags)
 
 	cmd.AddCommand(NewRunCommand(f, streams))
+	cmd.AddCommand(NewRerunCommand(f, streams))
 	cmd.AddCommand(NewGetCommand(f, streams))
 	cmd.AddCommand(NewAttachCommand(f, streams))
 	cmd.AddCommand(NewDeleteCommand(f, streams))
+	cmd.AddCommand(NewGcCommand(f, streams))
+	cmd.AddCommand(NewDescribeCommand(f, streams))
 	cmd.AddCommand(NewVersionCommand(streams))
 	cmd.AddCommand(NewLogCommand(f, streams))
+	cmd.AddCommand(NewControllerCommand(f, streams))
+	cmd.AddCommand(NewConfigCommand(f, streams))
+	cmd.AddCommand(NewScriptsCommand(f, streams))
 
 	// Override help on all the commands tree
 	walk(cmd, func(c *cobra.Command) {
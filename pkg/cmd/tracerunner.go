@@ -9,17 +9,22 @@ import (
 	"os/exec"
 	"os/signal"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/iovisor/kubectl-trace/pkg/downloader"
+	"github.com/iovisor/kubectl-trace/pkg/events"
 	"github.com/iovisor/kubectl-trace/pkg/procfs"
 	"github.com/iovisor/kubectl-trace/pkg/pty"
 	"github.com/iovisor/kubectl-trace/pkg/tracejob"
 	"github.com/iovisor/kubectl-trace/pkg/upload"
 	"github.com/spf13/cobra"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 // A pidDescriber produces some meaningful description of a PID from
@@ -30,6 +35,17 @@ type pidDescriber func(string) (string, error)
 // has completed successfully
 type postProcessor func() (string, []string, error)
 
+// traceCommand is a run of the tracer, there is one per traced process when many are selected.
+type traceCommand struct {
+	binary string
+	args   []string
+	// outputDir is where the files of the trace are written, MetadataDir or a directory of it.
+	outputDir   string
+	postProcess postProcessor
+	// jsonEvents is whether the output of the tracer is parsed as JSON and sent to the events sink.
+	jsonEvents bool
+}
+
 const (
 	// MetadataDir is where trace-runner will output traces and metadata
 	MetadataDir = "/tmp/kubectl-trace"
@@ -42,6 +58,8 @@ const (
 
 var (
 	bpfTraceBinaryPath = "/usr/bin/bpftrace"
+	// processPollInterval is how often the processes of the container are looked at while waiting for a process.
+	processPollInterval = 100 * time.Millisecond
 	bccToolsDir        = "/usr/share/bcc/tools/"
 	fakeToolsDir       = "/usr/share/fake/"
 )
@@ -51,7 +69,8 @@ type outputType string
 const (
 	stdout   outputType = "stdout"
 	download outputType = "download"
-	gcs      outputType = "gs"
+	// remote outputs are uploaded with the uploader of their URL scheme, eg gs:// or s3://.
+	remote outputType = "remote"
 )
 
 type TraceRunnerOptions struct {
@@ -63,22 +82,40 @@ type TraceRunnerOptions struct {
 
 	containerID string
 
+	// Name of the target container, to find it once restarted with another ID or started after the trace was created.
+	containerName string
+
 	// Process selector (similar to a label query) that identifies process to be traced.
 	// processSelector = label '=' value [',' labelN '=' valueN ...]
+	// Terms may also be label!=value, label=~regexp, label in (v1,v2), label notin (v1,v2),
+	// label to require a value and !label to require none.
 	// Currently supported labels:
 	// - pid
 	//   Select a process by its PID in the container namespace. If the value is numeric, select
 	//   the host PID corresponding to that specific container PID. If the value is "last", select
 	//   the host PID with the largest container PID value, optionally filtered by the other
-	//   selectors below.
+	//   selectors below. If the value is "all", select every process matching the other selectors.
 	// - exe
 	//   Filter the process list by matching on the value of /proc/<pid>/exe
 	// - comm
 	//   Filter the process list by matching on the contents of /proc/<pid>/comm
 	// - cmdline
 	//   Filter the process list by matching on the contents of /proc/<pid>/cmdline
+	// - cgroup
+	//   Filter the process list by matching on the contents of /proc/<pid>/cgroup
+	// - ppid
+	//   Filter the process list by the PID of the parent process in the container namespace
+	// - uid, user
+	//   Filter the process list by the real user of the process, by ID or by name in its /etc/passwd
+	// - env
+	//   Filter the process list by an entry of the environment of the process, eg env=RAILS_ENV=production
+	// - port
+	//   Filter the process list by a TCP port the process listens on
 	processSelector string
 
+	// How long to wait for a process matching the process selector to appear, not at all when zero.
+	waitForProcess time.Duration
+
 	// Where will the tracing system send output.
 	// output = stdout | download | file:///path | URI
 	output string
@@ -91,6 +128,17 @@ type TraceRunnerOptions struct {
 	// Not used for bpftrace.
 	programArgs []string
 
+	// Whether bpftrace stops right after attaching the probes of the program, to check it.
+	dryRun bool
+
+	// The format of the output of bpftrace.
+	// format = text | json
+	format string
+
+	// Where the events of bpftrace are sent in the json format.
+	// eventsSink = stdout | file:///path | otlp+http(s)://host:port[/path] | kafka+http(s)://host:port/topics/topic
+	eventsSink string
+
 	// Values populated after validation
 	parsedSelector *tracejob.ProcessSelector
 	outputType     outputType
@@ -111,7 +159,7 @@ func NewTraceRunnerCommand() *cobra.Command {
 				return err
 			}
 			if err := o.Run(); err != nil {
-				fmt.Fprintln(os.Stdout, err.Error())
+				fmt.Fprintln(o.messages(), err.Error())
 				return err
 			}
 			return nil
@@ -121,10 +169,15 @@ func NewTraceRunnerCommand() *cobra.Command {
 	cmd.Flags().StringVar(&o.tracer, "tracer", "bpftrace", "Tracing system to use")
 	cmd.Flags().StringVar(&o.podUID, "pod-uid", "", "UID of target pod")
 	cmd.Flags().StringVar(&o.containerID, "container-id", "", "ID of target container")
+	cmd.Flags().StringVar(&o.containerName, "container-name", "", "Name of target container")
 	cmd.Flags().StringVar(&o.processSelector, "process-selector", "", "Process Selector (similar to a label query) to filter on")
-	cmd.Flags().StringVar(&o.output, "output", "stdout", "Where to send tracing output (stdout or local path)")
+	cmd.Flags().DurationVar(&o.waitForProcess, "wait-for-process", o.waitForProcess, "How long to wait for a process matching the process selector to appear in the container, eg 60s")
+	cmd.Flags().StringVar(&o.output, "output", "stdout", outputFlagUsage())
 	cmd.Flags().StringVar(&o.program, "program", "/programs/program.bt", "Tracer input script or executable")
 	cmd.Flags().StringArrayVar(&o.programArgs, "args", o.programArgs, "Arguments to pass through to executable in --program")
+	cmd.Flags().BoolVar(&o.dryRun, "dry-run", o.dryRun, "Only check the program, bpftrace exits once its probes are attached")
+	cmd.Flags().StringVar(&o.format, "format", events.TextFormat, "Format of the output of bpftrace (text or json)")
+	cmd.Flags().StringVar(&o.eventsSink, "events-sink", events.DefaultSink, "Where to send the events of bpftrace in the json format (stdout, file:///path, otlp+http://host:port or kafka+http://host:port/topics/topic)")
 	return cmd
 }
 
@@ -144,34 +197,46 @@ func (o *TraceRunnerOptions) Validate(cmd *cobra.Command, args []string) error {
 		o.outputType = stdout
 	case o.output[0] == '/' || o.output[0] == '.':
 		o.outputType = download
-	case strings.HasPrefix(o.output, "gs://"):
-		o.outputType = gcs
+	case upload.Supported(o.output):
+		o.outputType = remote
 	default:
 		return fmt.Errorf("unknown output %s", o.output)
 	}
 
+	if o.waitForProcess < 0 {
+		return fmt.Errorf(waitForProcessNegativeErrString)
+	}
+
+	if o.dryRun && o.tracer != bpftrace {
+		return fmt.Errorf(dryRunWithoutBpftraceErrString)
+	}
+
+	switch o.format {
+	case events.TextFormat:
+	case events.JSONFormat:
+		if o.tracer != bpftrace {
+			return fmt.Errorf(jsonFormatWithoutBpftraceErrString)
+		}
+	default:
+		return fmt.Errorf(formatUnknownErrString, o.format)
+	}
+	if err := events.ValidateSink(o.eventsSink); err != nil {
+		return err
+	}
+
 	parsed, err := tracejob.NewProcessSelector(o.processSelector)
 	if err != nil {
 		return fmt.Errorf(err.Error())
 	}
 	o.parsedSelector = parsed
 
-	// TODO: unify this logic with run.go in a central selector validator?
 	switch o.tracer {
-	case bpftrace, bcc:
-	case fake:
-		if _, ok := o.parsedSelector.Pid(); !ok {
-			return fmt.Errorf(pidProcessSelectorRequiredForTracer, fake)
-		}
-	case rbspy:
-		if _, ok := o.parsedSelector.Pid(); !ok {
-			return fmt.Errorf(pidProcessSelectorRequiredForTracer, rbspy)
-		}
+	case bpftrace, bcc, fake, rbspy:
 	default:
 		panic("We shouldn't get here; have you accounted for all tracer types?")
 	}
 
-	return nil
+	return tracejob.ValidateSelectorForTracer(o.tracer, o.parsedSelector)
 }
 
 // Complete completes the setup of the command.
@@ -181,27 +246,33 @@ func (o *TraceRunnerOptions) Complete(cmd *cobra.Command, args []string) error {
 
 func (o *TraceRunnerOptions) Run() error {
 	var err error
-	var binary *string
-	var args []string
-	var pp postProcessor
+	var cmds []traceCommand
 
 	switch o.tracer {
 	case bpftrace:
-		binary, args, err = o.prepBpfTraceCommand()
+		cmds, err = o.prepBpfTraceCommand()
 	case bcc:
-		binary, args, err = o.prepBccCommand()
+		cmds, err = o.prepBccCommand()
 	case rbspy:
-		binary, args, pp, err = o.prepRbspyCommand()
+		cmds, err = o.prepRbspyCommands()
 	case fake:
-		binary, args, err = o.prepFakeCommand()
+		cmds, err = o.prepFakeCommands()
 	}
 
 	if err != nil {
 		return err
 	}
 
-	// Assume output is stdout until other backends are implemented.
-	fmt.Println("if your program has maps to print, send a SIGINT using Ctrl-C, if you want to interrupt the execution send SIGINT two times")
+	var sink events.Sink
+	if o.format == events.JSONFormat {
+		sink, err = events.NewSink(o.eventsSink)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Assume output is stdout until other backends are implemented.
+		fmt.Fprintln(o.messages(), "if your program has maps to print, send a SIGINT using Ctrl-C, if you want to interrupt the execution send SIGINT two times")
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	sigCh := make(chan os.Signal, 1)
 
@@ -218,7 +289,7 @@ func (o *TraceRunnerOptions) Run() error {
 			case <-sigCh:
 				if !killable {
 					killable = true
-					fmt.Println("\nfirst SIGINT received, now if your program had maps and did not free them it should print them out")
+					fmt.Fprintln(o.messages(), "\nfirst SIGINT received, now if your program had maps and did not free them it should print them out")
 					continue
 				}
 				return
@@ -226,53 +297,91 @@ func (o *TraceRunnerOptions) Run() error {
 		}
 	}()
 
-	var c *exec.Cmd
-	if len(args) == 0 {
-		c = exec.CommandContext(ctx, *binary)
-	} else {
-		c = exec.CommandContext(ctx, *binary, args...)
+	// The commands of the processes selected with pid=all run in parallel.
+	errs := make([]error, len(cmds))
+	var wg sync.WaitGroup
+	for i, tc := range cmds {
+		wg.Add(1)
+		go func(i int, tc traceCommand) {
+			defer wg.Done()
+			errs[i] = o.execute(ctx, tc, sink)
+		}(i, tc)
 	}
+	wg.Wait()
+	if sink != nil {
+		errs = append(errs, sink.Close())
+	}
+	err = utilerrors.NewAggregate(errs)
 
-	err = runTraceCommand(c, o.outputType != stdout)
+	switch o.outputType {
+	case stdout:
+		return err
+	case download:
+		fmt.Fprintln(o.messages(), "waiting for trace output to be uploaded")
+		return signalUploader()
+	case remote:
+		fmt.Fprintln(o.messages(), "Uploading trace output to "+o.output)
+		// The responses of webhooks are messages too, kept out of the events on stdout.
+		manifest, err := upload.Upload(MetadataDir, o.output, upload.Options{Out: o.messages()})
+		if len(manifest) > 0 {
+			manifest.Print(o.messages())
+		}
+		return err
+	}
 
-	if pp != nil {
-		binary, args, err := pp()
+	return nil
+}
+
+// messages is where the runner writes what it does. It is stderr with the json format,
+// so that stdout only has the events of bpftrace when they are sent there.
+func (o *TraceRunnerOptions) messages() io.Writer {
+	if o.format == events.JSONFormat {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// execute runs a command of the tracer, then its post processor if any.
+// The output of the commands with JSON events is sent to sink.
+func (o *TraceRunnerOptions) execute(ctx context.Context, tc traceCommand, sink events.Sink) error {
+	streamOutput := o.outputType != stdout
+	if tc.outputDir != MetadataDir {
+		if err := os.MkdirAll(tc.outputDir, 0755); err != nil {
+			return err
+		}
+	}
+
+	c := exec.CommandContext(ctx, tc.binary, tc.args...)
+	var err error
+	if tc.jsonEvents {
+		err = runJSONTraceCommand(c, sink, o.eventLabels(), streamOutput, tc.outputDir)
+	} else {
+		err = runTraceCommand(c, streamOutput, tc.outputDir)
+	}
+
+	if tc.postProcess != nil {
+		binary, args, err := tc.postProcess()
 		if err != nil {
 			return fmt.Errorf("failed to determine post processor command for tracer %s %v", o.tracer, err)
 		} else {
 			fmt.Printf("Running post processor %s %v \n", binary, args)
 			postProcess := exec.Command(binary, args...)
-			err = runTraceCommand(postProcess, o.outputType != stdout)
+			err = runTraceCommand(postProcess, streamOutput, tc.outputDir)
 			if err != nil {
 				return fmt.Errorf("failed to execute post processor command for tracer %s %v", o.tracer, err)
 			}
 		}
 	}
 
-	switch o.outputType {
-	case stdout:
-		return err
-	case download:
-		fmt.Println("waiting for trace output to be uploaded")
-		return signalUploader()
-	case gcs:
-		client, err := upload.NewGcsUploader(upload.GcsUploaderOptions{})
-		if err != nil {
-			return err
-		}
-		fmt.Println("Uploading trace output to " + o.output)
-		return client.Upload(MetadataDir, o.output)
-	}
-
-	return nil
+	return err
 }
 
 // This helper will ensure that the output for the command is handled correctly,
-// either streaming to stdout or teeing to a long file as well.
-func runTraceCommand(c *exec.Cmd, streamOutput bool) error {
+// either streaming to stdout or teeing to a long file in outputDir as well.
+func runTraceCommand(c *exec.Cmd, streamOutput bool, outputDir string) error {
 	c.Stdin = os.Stdin
 	if streamOutput {
-		outLog, err := os.OpenFile(path.Join(MetadataDir, "stdout.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		outLog, err := os.OpenFile(path.Join(outputDir, "stdout.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
 			return fmt.Errorf("failed to open stdout log file: %v", err)
 		}
@@ -295,30 +404,77 @@ func runTraceCommand(c *exec.Cmd, streamOutput bool) error {
 	}
 }
 
-func (o *TraceRunnerOptions) prepBpfTraceCommand() (*string, []string, error) {
+// runJSONTraceCommand sends the JSON output of the command to sink as events with labels,
+// the output being kept in a log file in outputDir as well when streamOutput is set.
+func runJSONTraceCommand(c *exec.Cmd, sink events.Sink, labels map[string]string, streamOutput bool, outputDir string) error {
+	c.Stdin = os.Stdin
+	c.Stderr = os.Stderr
+	out, err := c.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = out
+	if streamOutput {
+		outLog, err := os.OpenFile(path.Join(outputDir, "stdout.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open stdout log file: %v", err)
+		}
+		defer outLog.Close()
+		r = io.TeeReader(out, outLog)
+	}
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+	forwardErr := events.Forward(r, sink, labels)
+	return utilerrors.NewAggregate([]error{c.Wait(), forwardErr})
+}
+
+// eventLabels are the labels of the events of the trace, identifying what is traced.
+func (o *TraceRunnerOptions) eventLabels() map[string]string {
+	labels := map[string]string{}
+	if o.podUID != "" {
+		labels["pod_uid"] = o.podUID
+	}
+	if o.containerID != "" {
+		labels["container_id"] = o.containerID
+	}
+	return labels
+}
+
+func (o *TraceRunnerOptions) prepBpfTraceCommand() ([]traceCommand, error) {
 	programPath := o.program
 
-	// Render $container_pid to actual process pid if scoped to container.
-	if o.podUID != "" && o.containerID != "" {
-		pid, err := o.findTargetPidForPod()
+	// Render $container_pid and $container_pids to actual process pids if scoped to container.
+	if o.inContainer() {
+		pids, err := o.findTargetPidsForPod()
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		f, err := ioutil.ReadFile(programPath)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		programPath = path.Join(os.TempDir(), "program-container.bt")
-		r := strings.Replace(string(f), "$container_pid", pid, -1)
+		r := replaceContainerPids(string(f), pids)
 		if err := ioutil.WriteFile(programPath, []byte(r), 0755); err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 	}
 
-	return &bpfTraceBinaryPath, []string{programPath}, nil
+	args := []string{programPath}
+	if o.dryRun {
+		args = []string{"--dry-run", programPath}
+	}
+	jsonEvents := o.format == events.JSONFormat
+	if jsonEvents {
+		args = append([]string{"-f", "json"}, args...)
+	}
+	return []traceCommand{{binary: bpfTraceBinaryPath, args: args, outputDir: MetadataDir, jsonEvents: jsonEvents}}, nil
 }
 
-func (o *TraceRunnerOptions) prepBccCommand() (*string, []string, error) {
+func (o *TraceRunnerOptions) prepBccCommand() ([]traceCommand, error) {
 	// Sanitize o.program by removing common prefix/suffixes.
 	name := o.program
 	name = strings.TrimPrefix(name, "/usr/bin/")
@@ -328,71 +484,140 @@ func (o *TraceRunnerOptions) prepBccCommand() (*string, []string, error) {
 	program := bccToolsDir + name
 	args := append([]string{}, o.programArgs...)
 
-	if o.podUID != "" && o.containerID != "" {
-		pid, err := o.findTargetPidForPod()
+	if o.inContainer() {
+		pids, err := o.findTargetPidsForPod()
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		for i, arg := range args {
-			args[i] = strings.Replace(arg, "$container_pid", pid, -1)
+			args[i] = replaceContainerPids(arg, pids)
 		}
 	}
 
-	return &program, args, nil
+	return []traceCommand{{binary: program, args: args, outputDir: MetadataDir}}, nil
 }
 
-func (o *TraceRunnerOptions) prepRbspyCommand() (*string, []string, postProcessor, error) {
-	program := rbspy
-	args := []string{"record", "--format", "speedscope", "--file", path.Join(MetadataDir, "profile.speedscope.json"), "--raw-file", path.Join(MetadataDir, "rbspy.raw.gz"), "--pid"}
-
-	foundPid, err := findHostPid(o.podUID, o.containerID, o.parsedSelector)
+// prepRbspyCommands records every selected process, in a directory of its own when there are many of them.
+func (o *TraceRunnerOptions) prepRbspyCommands() ([]traceCommand, error) {
+	foundPids, err := o.waitForPids(o.findSelectedPids)
 	if err != nil {
-		return nil, nil, nil, err
-	}
-
-	args = append(args, foundPid)
-	return &program, args, o.prepRbspyPostprocessCommand, nil
+		return nil, err
+	}
+
+	cmds := []traceCommand{}
+	for _, pid := range foundPids {
+		dir := pidOutputDir(pid, len(foundPids))
+		args := []string{"record", "--format", "speedscope", "--file", path.Join(dir, "profile.speedscope.json"), "--raw-file", path.Join(dir, "rbspy.raw.gz"), "--pid", pid}
+		cmds = append(cmds, traceCommand{
+			binary:    rbspy,
+			args:      args,
+			outputDir: dir,
+			postProcess: func() (string, []string, error) {
+				return o.prepRbspyPostprocessCommand(dir)
+			},
+		})
+	}
+	return cmds, nil
 }
 
-func (o *TraceRunnerOptions) prepRbspyPostprocessCommand() (string, []string, error) {
+func (o *TraceRunnerOptions) prepRbspyPostprocessCommand(dir string) (string, []string, error) {
 	program := rbspy
-	args := []string{"report", "--format", "flamegraph", "--input", path.Join(MetadataDir, "rbspy.raw.gz"), "--output", path.Join(MetadataDir, "flamegraph.svg")}
+	args := []string{"report", "--format", "flamegraph", "--input", path.Join(dir, "rbspy.raw.gz"), "--output", path.Join(dir, "flamegraph.svg")}
 	return program, args, nil
 }
 
-func (o *TraceRunnerOptions) prepFakeCommand() (*string, []string, error) {
+func (o *TraceRunnerOptions) prepFakeCommands() ([]traceCommand, error) {
 	name := path.Base(o.program)
 	program := fakeToolsDir + name
-	args := append([]string{}, o.programArgs...)
 
-	foundPid, err := findHostPid(o.podUID, o.containerID, o.parsedSelector)
+	foundPids, err := o.waitForPids(o.findSelectedPids)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+
+	cmds := []traceCommand{}
+	for _, pid := range foundPids {
+		args := append([]string{}, o.programArgs...)
+		for i, arg := range args {
+			args[i] = strings.Replace(arg, "$target_pid", pid, -1)
+		}
+		cmds = append(cmds, traceCommand{binary: program, args: args, outputDir: pidOutputDir(pid, len(foundPids))})
 	}
+	return cmds, nil
+}
 
-	for i, arg := range args {
-		args[i] = strings.Replace(arg, "$target_pid", foundPid, -1)
+// pidOutputDir is where the files of the trace of pid are written, MetadataDir unless many processes are traced.
+func pidOutputDir(pid string, traced int) string {
+	if traced == 1 {
+		return MetadataDir
 	}
+	return path.Join(MetadataDir, pid)
+}
+
+// replaceContainerPids replaces $container_pids with the comma separated pids, and $container_pid with the first of them.
+func replaceContainerPids(s string, pids []string) string {
+	s = strings.Replace(s, "$container_pids", strings.Join(pids, ","), -1)
+	return strings.Replace(s, "$container_pid", pids[0], -1)
+}
 
-	return &program, args, nil
+// inContainer tells whether the trace is scoped to a container of a pod.
+func (o *TraceRunnerOptions) inContainer() bool {
+	return o.podUID != "" && (o.containerID != "" || o.containerName != "")
 }
 
-func (o *TraceRunnerOptions) findTargetPidForPod() (string, error) {
-		var pid string
-		var err error
+func (o *TraceRunnerOptions) findTargetPidsForPod() ([]string, error) {
+	return o.waitForPids(func() ([]string, error) {
 		if o.processSelector != "" {
-			pid, err = findHostPid(o.podUID, o.containerID, o.parsedSelector)
-			if err != nil {
-				return "", err
-			}
-		} else {
-			pid, err = procfs.FindPidByPodContainer(o.podUID, o.containerID)
-			if err != nil {
-				return "", err
-			}
+			return o.findSelectedPids()
 		}
 
-	return pid, nil
+		pid, err := o.findContainerPid()
+		if err != nil {
+			return nil, err
+		}
+		return []string{pid}, nil
+	})
+}
+
+// findContainerPid finds a process of the target container by its ID, or by its name when it has no process
+// with that ID, as happens once it restarted or when it had not started yet when the trace was created.
+func (o *TraceRunnerOptions) findContainerPid() (string, error) {
+	if o.containerID != "" || o.containerName == "" {
+		pid, err := procfs.FindPidByPodContainer(o.podUID, o.containerID)
+		if err == nil || o.containerName == "" {
+			return pid, err
+		}
+	}
+	return procfs.FindPidByPodContainerName(o.podUID, o.containerName)
+}
+
+// findSelectedPids finds the processes of the target container selected by the process selector.
+func (o *TraceRunnerOptions) findSelectedPids() ([]string, error) {
+	containerPid, err := o.findContainerPid()
+	if err != nil {
+		return nil, err
+	}
+	return findHostPids(containerPid, o.parsedSelector)
+}
+
+// waitForPids calls find until it finds the pids, for up to --wait-for-process, so that processes
+// which are not started yet can be traced, like the ones of crash looping containers or cron jobs.
+func (o *TraceRunnerOptions) waitForPids(find func() ([]string, error)) ([]string, error) {
+	if o.waitForProcess == 0 {
+		return find()
+	}
+
+	fmt.Fprintf(o.messages(), "waiting up to %s for a process matching '%s'\n", o.waitForProcess, o.parsedSelector)
+	var pids []string
+	var findErr error
+	err := wait.PollImmediate(processPollInterval, o.waitForProcess, func() (bool, error) {
+		pids, findErr = find()
+		return findErr == nil, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("no process matching '%s' appeared within %s: %v", o.parsedSelector, o.waitForProcess, findErr)
+	}
+	return pids, nil
 }
 
 func findProcPid(targetPid string, hostPids []string) (string, error) {
@@ -410,12 +635,40 @@ func findProcPid(targetPid string, hostPids []string) (string, error) {
 	return "", fmt.Errorf("pid %s not found; is it still running?", targetPid)
 }
 
-func findHostPid(podUID, containerID string, selector *tracejob.ProcessSelector) (string, error) {
-	containerPid, err := procfs.FindPidByPodContainer(podUID, containerID)
+// findHostPids returns the host pids of the processes selected in the container,
+// every matching process with pid=all and a single one otherwise.
+func findHostPids(containerPid string, selector *tracejob.ProcessSelector) ([]string, error) {
+	if targetPid, _ := selector.Pid(); targetPid != "all" {
+		pid, err := findHostPid(containerPid, selector)
+		if err != nil {
+			return nil, err
+		}
+		return []string{pid}, nil
+	}
+
+	hostPidsForContainer, err := procfs.FindPidsForContainer(containerPid)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	filteredPids, err := filterPidsBySelector(selector, hostPidsForContainer)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(filteredPids) == 0 {
+		return nil, fmt.Errorf("process matching '%s' not found; is it still running?", selector)
 	}
 
+	sort.Slice(filteredPids, func(i, j int) bool {
+		a, _ := strconv.Atoi(filteredPids[i])
+		b, _ := strconv.Atoi(filteredPids[j])
+		return a < b
+	})
+	return filteredPids, nil
+}
+
+func findHostPid(containerPid string, selector *tracejob.ProcessSelector) (string, error) {
 	hostPidsForContainer, err := procfs.FindPidsForContainer(containerPid)
 	if err != nil {
 		return "", err
@@ -448,29 +701,50 @@ func findHostPid(podUID, containerID string, selector *tracejob.ProcessSelector)
 	return foundPid, nil
 }
 
-func filterPidsBySelector(selector *tracejob.ProcessSelector, hostPids []string) ([]string, error) {
-	matching := hostPids
-	var err error
+// pidDescribers describe processes by the labels of process selectors.
+// The values of env and port are joined by new lines, as expected by tracejob.Requirement.
+var pidDescribers = map[string]pidDescriber{
+	"exe":     procfs.GetProcExe,
+	"comm":    procfs.GetProcComm,
+	"cmdline": procfs.GetProcCmdline,
+	"cgroup":  procfs.GetProcCgroup,
+	"ppid":    describeContainerPpid,
+	"uid":     procfs.GetProcUid,
+	"user":    procfs.GetProcUser,
+	"env":     joinedLines(procfs.GetProcEnviron),
+	"port":    joinedLines(procfs.GetProcListeningPorts),
+}
 
-	targetExe, ok := selector.Exe()
-	if ok {
-		matching, err = findPidsMatching(targetExe, matching, procfs.GetProcExe)
-		if err != nil {
-			return nil, err
-		}
+// describeContainerPpid describes a process by the pid of its parent in the container,
+// like the pid of process selectors.
+func describeContainerPpid(pid string) (string, error) {
+	ppid, err := procfs.GetProcPpid(pid)
+	if err != nil || ppid == "0" {
+		return ppid, err
 	}
+	return procfs.GetFinalNamespacePid(ppid)
+}
 
-	targetComm, ok := selector.Comm()
-	if ok {
-		matching, err = findPidsMatching(targetComm, matching, procfs.GetProcComm)
+func joinedLines(describe func(string) ([]string, error)) pidDescriber {
+	return func(pid string) (string, error) {
+		lines, err := describe(pid)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
+		return strings.Join(lines, "\n"), nil
 	}
+}
 
-	targetCmdline, ok := selector.Cmdline()
-	if ok {
-		matching, err = findPidsMatching(targetCmdline, matching, procfs.GetProcCmdline)
+func filterPidsBySelector(selector *tracejob.ProcessSelector, hostPids []string) ([]string, error) {
+	matching := hostPids
+	var err error
+
+	for _, r := range selector.Requirements() {
+		describePid, ok := pidDescribers[r.Label]
+		if !ok {
+			return nil, fmt.Errorf("unsupported process selector label %s", r.Label)
+		}
+		matching, err = findPidsMatching(r, matching, describePid)
 		if err != nil {
 			return nil, err
 		}
@@ -505,7 +779,7 @@ func findLastContainerPid(hostPids []string) (string, error) {
 	return desiredHostPid, nil
 }
 
-func findPidsMatching(needle string, hostPids []string, describePid pidDescriber) ([]string, error) {
+func findPidsMatching(requirement tracejob.Requirement, hostPids []string, describePid pidDescriber) ([]string, error) {
 	matching := []string{}
 
 	for _, pid := range hostPids {
@@ -514,7 +788,7 @@ func findPidsMatching(needle string, hostPids []string, describePid pidDescriber
 			return nil, err
 		}
 
-		if strings.Contains(desc, needle) {
+		if requirement.Matches(desc) {
 			matching = append(matching, pid)
 		}
 	}
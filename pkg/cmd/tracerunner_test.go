@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/events"
+	"github.com/iovisor/kubectl-trace/pkg/procfs"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceContainerPids(t *testing.T) {
+	program := `uprobe:/proc/$container_pid/exe:main /pid == $container_pid/ { printf("%s\n", "$container_pids"); }`
+
+	assert.Equal(t,
+		`uprobe:/proc/12/exe:main /pid == 12/ { printf("%s\n", "12,15,20"); }`,
+		replaceContainerPids(program, []string{"12", "15", "20"}))
+	assert.Equal(t,
+		`uprobe:/proc/12/exe:main /pid == 12/ { printf("%s\n", "12"); }`,
+		replaceContainerPids(program, []string{"12"}))
+}
+
+func TestPidOutputDir(t *testing.T) {
+	assert.Equal(t, MetadataDir, pidOutputDir("12", 1))
+	assert.Equal(t, MetadataDir+"/12", pidOutputDir("12", 3))
+}
+
+func TestPrepBpfTraceCommandJSON(t *testing.T) {
+	o := &TraceRunnerOptions{program: "/programs/program.bt", format: events.JSONFormat, dryRun: true}
+	cmds, err := o.prepBpfTraceCommand()
+	require.NoError(t, err)
+	require.Len(t, cmds, 1)
+	assert.Equal(t, []string{"-f", "json", "--dry-run", "/programs/program.bt"}, cmds[0].args)
+	assert.True(t, cmds[0].jsonEvents)
+
+	o.format = events.TextFormat
+	cmds, err = o.prepBpfTraceCommand()
+	require.NoError(t, err)
+	assert.False(t, cmds[0].jsonEvents)
+}
+
+func TestWaitForPids(t *testing.T) {
+	processPollInterval = time.Millisecond
+	selector, err := tracejob.NewProcessSelector("pid=last,comm=worker")
+	require.NoError(t, err)
+	o := &TraceRunnerOptions{parsedSelector: selector, waitForProcess: time.Second}
+
+	calls := 0
+	pids, err := o.waitForPids(func() ([]string, error) {
+		calls++
+		if calls < 3 {
+			return nil, fmt.Errorf("process matching 'pid=last,comm=worker' not found; is it still running?")
+		}
+		return []string{"42"}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"42"}, pids)
+	assert.Equal(t, 3, calls)
+
+	o.waitForProcess = 10 * time.Millisecond
+	_, err = o.waitForPids(func() ([]string, error) {
+		return nil, fmt.Errorf("process matching 'pid=last,comm=worker' not found; is it still running?")
+	})
+	assert.EqualError(t, err, "no process matching 'pid=last,comm=worker' appeared within 10ms: process matching 'pid=last,comm=worker' not found; is it still running?")
+}
+
+func TestFindTargetPidsForRestartedContainer(t *testing.T) {
+	procFs := procfs.ProcFs
+	procfs.ProcFs = afero.NewMemMapFs()
+	defer func() { procfs.ProcFs = procFs }()
+
+	podUID := "18640755-cc12-4557-b96e-0f74d5b44d1d"
+	mountinfo := map[string]string{
+		// The sandbox of the pod.
+		"3": "1480 1479 0:32 /kubepods/burstable/pod" + podUID + "/0a1b2c3d /sys/fs/cgroup ro - cgroup2 cgroup rw\n",
+		// The container, restarted with another ID than the one of the trace.
+		"7": "1487 1486 0:32 /kubepods/burstable/pod" + podUID + "/9f3c1d2e /sys/fs/cgroup ro - cgroup2 cgroup rw\n" +
+			"1490 1486 8:1 /var/lib/kubelet/pods/" + podUID + "/containers/worker/5b8e2a1c /dev/termination-log rw - ext4 /dev/sda1 rw\n",
+	}
+	for pid, mounts := range mountinfo {
+		require.NoError(t, afero.WriteFile(procfs.ProcFs, "/proc/"+pid+"/mountinfo", []byte(mounts), 0644))
+	}
+
+	for name, containerID := range map[string]string{"restarted": "66221e7d", "not started": ""} {
+		t.Run(name, func(t *testing.T) {
+			o := &TraceRunnerOptions{podUID: podUID, containerID: containerID, containerName: "worker"}
+			assert.True(t, o.inContainer())
+			pids, err := o.findTargetPidsForPod()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"7"}, pids)
+		})
+	}
+
+	o := &TraceRunnerOptions{podUID: podUID, containerID: "66221e7d"}
+	_, err := o.findTargetPidsForPod()
+	assert.EqualError(t, err, "no process found for specified pod and container")
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/util/homedir"
+	"sigs.k8s.io/yaml"
+)
+
+// PathEnvVar is the environment variable overriding the location of the configuration file.
+const PathEnvVar = "KUBECTL_TRACE_CONFIG"
+
+// Profile holds defaults of kubectl trace run, used when the matching flags are not given.
+// The fields left empty do not change the defaults.
+type Profile struct {
+	// ImageName is the tracerunner image, like --imagename.
+	ImageName string `json:"imageName,omitempty"`
+	// InitImageName is the image fetching the linux headers, like --init-imagename.
+	InitImageName string `json:"initImageName,omitempty"`
+	// ServiceAccount is the service account of the trace pods, like --serviceaccount.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// Deadline is the maximum time a trace runs, in seconds, like --deadline.
+	Deadline *int64 `json:"deadline,omitempty"`
+	// DeadlineGracePeriod is the time left to print maps after the deadline, in seconds, like --deadline-grace-period.
+	DeadlineGracePeriod *int64 `json:"deadlineGracePeriod,omitempty"`
+	// FetchHeaders tells whether to fetch the linux headers, like --fetch-headers.
+	FetchHeaders *bool `json:"fetchHeaders,omitempty"`
+	// Patch is the path of a file patching the trace jobs, like --patch.
+	Patch string `json:"patch,omitempty"`
+	// PatchType is the strategy used to apply Patch, like --patch-type.
+	PatchType string `json:"patchType,omitempty"`
+	// GoogleAppSecret is the secret holding a google service account key, like --google-application-secret.
+	GoogleAppSecret string `json:"googleAppSecret,omitempty"`
+	// AWSCredentialsSecret is the secret holding the AWS_* variables of S3 outputs, like --aws-credentials-secret.
+	AWSCredentialsSecret string `json:"awsCredentialsSecret,omitempty"`
+	// HTTPHeadersSecret is the secret holding the headers of HTTP outputs, like --http-headers-secret.
+	HTTPHeadersSecret string `json:"httpHeadersSecret,omitempty"`
+	// TTL is the time a finished trace is kept, in seconds, like --ttl.
+	TTL *int32 `json:"ttl,omitempty"`
+	// SecurityProfile is the privileges of the trace container, like --security-profile.
+	SecurityProfile string `json:"securityProfile,omitempty"`
+	// CPURequest is the CPU requested by the trace containers, eg 100m.
+	CPURequest string `json:"cpuRequest,omitempty"`
+	// CPULimit is the CPU limit of the trace containers, eg 1.
+	CPULimit string `json:"cpuLimit,omitempty"`
+	// MemoryRequest is the memory requested by the trace containers, eg 100Mi.
+	MemoryRequest string `json:"memoryRequest,omitempty"`
+	// MemoryLimit is the memory limit of the trace containers, eg 1G.
+	MemoryLimit string `json:"memoryLimit,omitempty"`
+	// ScriptsDir is the local directory of scripts, like --scripts-dir.
+	ScriptsDir string `json:"scriptsDir,omitempty"`
+}
+
+// Config is the content of the configuration file. Its top level values apply to every profile,
+// the values of the active profile taking precedence over them.
+type Config struct {
+	Profile `json:",inline"`
+
+	// CurrentProfile is the active profile, unless the kubeconfig context has its own.
+	CurrentProfile string `json:"currentProfile,omitempty"`
+	// ContextProfiles are the active profiles of kubeconfig contexts.
+	ContextProfiles map[string]string `json:"contextProfiles,omitempty"`
+	// Profiles are the named profiles.
+	Profiles map[string]Profile `json:"profiles,omitempty"`
+}
+
+// DefaultPath returns the path of the configuration file, $KUBECTL_TRACE_CONFIG or ~/.kube/kubectl-trace.yaml.
+func DefaultPath() string {
+	if path := os.Getenv(PathEnvVar); path != "" {
+		return path
+	}
+	return filepath.Join(homedir.HomeDir(), ".kube", "kubectl-trace.yaml")
+}
+
+// Load reads the configuration file at path. A missing file is an empty configuration.
+func Load(path string) (*Config, error) {
+	c := &Config{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("could not read configuration file %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Save writes the configuration file at path.
+func (c *Config) Save(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// ActiveProfile returns the name of the profile in use for the kubeconfig context, if any.
+func (c *Config) ActiveProfile(context string) string {
+	if name, ok := c.ContextProfiles[context]; ok && context != "" {
+		return name
+	}
+	return c.CurrentProfile
+}
+
+// Defaults returns the defaults in use for the kubeconfig context: the top level values
+// overridden by the ones of the active profile.
+func (c *Config) Defaults(context string) (Profile, error) {
+	defaults := c.Profile
+	name := c.ActiveProfile(context)
+	if name == "" {
+		return defaults, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return defaults, fmt.Errorf("profile %s not found in the configuration file", name)
+	}
+
+	dv, pv := reflect.ValueOf(&defaults).Elem(), reflect.ValueOf(p)
+	for i := 0; i < pv.NumField(); i++ {
+		if !pv.Field(i).IsZero() {
+			dv.Field(i).Set(pv.Field(i))
+		}
+	}
+	return defaults, nil
+}
+
+// Keys returns the keys of the values a profile holds, as used in the configuration file.
+func Keys() []string {
+	t := reflect.TypeOf(Profile{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		keys = append(keys, jsonKey(t.Field(i)))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Set sets the value of key, an empty value unsetting it.
+func (p *Profile) Set(key, value string) error {
+	v := reflect.ValueOf(p).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if jsonKey(v.Type().Field(i)) != key {
+			continue
+		}
+
+		f := v.Field(i)
+		if value == "" {
+			f.Set(reflect.Zero(f.Type()))
+			return nil
+		}
+		switch f.Interface().(type) {
+		case string:
+			f.SetString(value)
+		case *int64:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid value %q for %s, must be an integer", value, key)
+			}
+			f.Set(reflect.ValueOf(&n))
+		case *int32:
+			n, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid value %q for %s, must be an integer", value, key)
+			}
+			n32 := int32(n)
+			f.Set(reflect.ValueOf(&n32))
+		case *bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value %q for %s, must be true or false", value, key)
+			}
+			f.Set(reflect.ValueOf(&b))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown key %s, must be one of %s", key, strings.Join(Keys(), ", "))
+}
+
+func jsonKey(f reflect.StructField) string {
+	return strings.Split(f.Tag.Get("json"), ",")[0]
+}
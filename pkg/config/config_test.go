@@ -0,0 +1,110 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+cpuRequest: 50m
+memoryLimit: 2Gi
+currentProfile: staging
+contextProfiles:
+  prod-cluster: prod
+profiles:
+  staging:
+    imageName: quay.io/myorg/kubectl-trace-runner:staging
+  prod:
+    imageName: quay.io/myorg/kubectl-trace-runner:stable
+    memoryLimit: 4Gi
+    deadline: 600
+    fetchHeaders: true
+`
+
+func writeConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "kubectl-trace-config")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "kubectl-trace.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	c, err := Load(writeConfig(t, testConfig))
+	require.NoError(t, err)
+	assert.Equal(t, "50m", c.CPURequest)
+	assert.Equal(t, "staging", c.CurrentProfile)
+	assert.Equal(t, "prod", c.ContextProfiles["prod-cluster"])
+	assert.Len(t, c.Profiles, 2)
+}
+
+func TestLoadMissing(t *testing.T) {
+	c, err := Load(filepath.Join(os.TempDir(), "kubectl-trace-missing.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, &Config{}, c)
+}
+
+func TestLoadUnknownField(t *testing.T) {
+	_, err := Load(writeConfig(t, "cpuRequests: 50m\n"))
+	assert.Error(t, err)
+}
+
+func TestDefaults(t *testing.T) {
+	c, err := Load(writeConfig(t, testConfig))
+	require.NoError(t, err)
+
+	staging, err := c.Defaults("dev-cluster")
+	require.NoError(t, err)
+	assert.Equal(t, "quay.io/myorg/kubectl-trace-runner:staging", staging.ImageName)
+	assert.Equal(t, "50m", staging.CPURequest)
+	assert.Equal(t, "2Gi", staging.MemoryLimit)
+	assert.Nil(t, staging.Deadline)
+
+	prod, err := c.Defaults("prod-cluster")
+	require.NoError(t, err)
+	assert.Equal(t, "quay.io/myorg/kubectl-trace-runner:stable", prod.ImageName)
+	assert.Equal(t, "50m", prod.CPURequest)
+	assert.Equal(t, "4Gi", prod.MemoryLimit)
+	assert.Equal(t, int64(600), *prod.Deadline)
+	assert.True(t, *prod.FetchHeaders)
+
+	c.CurrentProfile = "missing"
+	_, err = c.Defaults("dev-cluster")
+	assert.EqualError(t, err, "profile missing not found in the configuration file")
+}
+
+func TestSet(t *testing.T) {
+	p := Profile{}
+	require.NoError(t, p.Set("imageName", "runner:latest"))
+	require.NoError(t, p.Set("deadline", "60"))
+	require.NoError(t, p.Set("ttl", "3600"))
+	require.NoError(t, p.Set("fetchHeaders", "true"))
+	assert.Equal(t, "runner:latest", p.ImageName)
+	assert.Equal(t, int64(60), *p.Deadline)
+	assert.Equal(t, int32(3600), *p.TTL)
+	assert.True(t, *p.FetchHeaders)
+
+	require.NoError(t, p.Set("deadline", ""))
+	assert.Nil(t, p.Deadline)
+
+	assert.EqualError(t, p.Set("deadline", "soon"), `invalid value "soon" for deadline, must be an integer`)
+	assert.Error(t, p.Set("image", "runner:latest"))
+}
+
+func TestSave(t *testing.T) {
+	path := filepath.Join(writeConfig(t, ""), "..", "nested", "kubectl-trace.yaml")
+	c := &Config{CurrentProfile: "prod", Profiles: map[string]Profile{"prod": {ServiceAccount: "tracer"}}}
+	c.CPURequest = "50m"
+	require.NoError(t, c.Save(path))
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, c, loaded)
+}
@@ -0,0 +1,469 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/apis/trace/v1alpha1"
+	"github.com/iovisor/kubectl-trace/pkg/errors"
+	"github.com/iovisor/kubectl-trace/pkg/events"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/iovisor/kubectl-trace/pkg/upload"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// DefaultResyncPeriod is how often every TraceJob is reconciled, even without changes.
+	DefaultResyncPeriod = 5 * time.Minute
+	// unallocatableRetryPeriod is how long to wait before trying again to create a trace on an unallocatable target.
+	unallocatableRetryPeriod = 30 * time.Second
+)
+
+// Options configure the controller.
+type Options struct {
+	// Namespace to watch for TraceJobs, all namespaces when empty.
+	Namespace string
+	// ImageNameTag is the trace runner image used when a TraceJob does not specify one.
+	ImageNameTag string
+	// InitImageNameTag is the init image used when a TraceJob does not specify one.
+	InitImageNameTag string
+	// Deadline is used when a TraceJob does not specify one, in seconds.
+	Deadline int64
+	// DeadlineGracePeriod is used when a TraceJob does not specify one, in seconds.
+	DeadlineGracePeriod int64
+	// ResyncPeriod is how often every TraceJob is reconciled, defaults to DefaultResyncPeriod.
+	ResyncPeriod time.Duration
+}
+
+// Controller reconciles TraceJob custom resources into the job and config map
+// running the trace, and reports the state of the trace back in their status.
+type Controller struct {
+	clientset     kubernetes.Interface
+	dynamicClient dynamic.Interface
+	options       Options
+
+	traceJobInformers dynamicinformer.DynamicSharedInformerFactory
+	jobInformers      informers.SharedInformerFactory
+	traceJobLister    cache.GenericLister
+	synced            []cache.InformerSynced
+	queue             workqueue.RateLimitingInterface
+}
+
+// New creates a controller for the TraceJobs in options.Namespace.
+func New(clientset kubernetes.Interface, dynamicClient dynamic.Interface, options Options) *Controller {
+	if options.ResyncPeriod == 0 {
+		options.ResyncPeriod = DefaultResyncPeriod
+	}
+
+	c := &Controller{
+		clientset:     clientset,
+		dynamicClient: dynamicClient,
+		options:       options,
+		queue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "tracejobs"),
+	}
+
+	c.traceJobInformers = dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, options.ResyncPeriod, options.Namespace, nil)
+	traceJobInformer := c.traceJobInformers.ForResource(v1alpha1.SchemeGroupVersionResource)
+	traceJobInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueue,
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+	})
+	c.traceJobLister = traceJobInformer.Lister()
+
+	c.jobInformers = informers.NewSharedInformerFactoryWithOptions(clientset, options.ResyncPeriod,
+		informers.WithNamespace(options.Namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = meta.TraceIDLabelKey
+		}))
+	jobInformer := c.jobInformers.Batch().V1().Jobs().Informer()
+	jobInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueOwner,
+		UpdateFunc: func(_, obj interface{}) { c.enqueueOwner(obj) },
+		DeleteFunc: c.enqueueOwner,
+	})
+
+	c.synced = []cache.InformerSynced{traceJobInformer.Informer().HasSynced, jobInformer.HasSynced}
+	return c
+}
+
+// Run starts workers reconciling TraceJobs until ctx is done.
+func (c *Controller) Run(ctx context.Context, workers int) error {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	c.traceJobInformers.Start(ctx.Done())
+	c.jobInformers.Start(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), c.synced...) {
+		return fmt.Errorf("timed out waiting for caches to sync")
+	}
+
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	requeueAfter, err := c.Reconcile(ctx, key.(string))
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("error reconciling tracejob %s: %v", key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+
+	c.queue.Forget(key)
+	if requeueAfter > 0 {
+		c.queue.AddAfter(key, requeueAfter)
+	}
+	return true
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// enqueueOwner enqueues the TraceJob owning a trace job, if any.
+func (c *Controller) enqueueOwner(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return
+	}
+	owner := metav1.GetControllerOf(job)
+	if owner == nil || owner.Kind != v1alpha1.Kind || !strings.HasPrefix(owner.APIVersion, v1alpha1.GroupName+"/") {
+		return
+	}
+	c.queue.Add(job.Namespace + "/" + owner.Name)
+}
+
+// Reconcile creates the trace job of the TraceJob identified by key if needed,
+// and updates its status. It returns how long to wait before reconciling it again, if at all.
+func (c *Controller) Reconcile(ctx context.Context, key string) (time.Duration, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return 0, err
+	}
+
+	obj, err := c.traceJobLister.ByNamespace(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		// The job and config map are garbage collected through their owner reference.
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	tj, err := fromUnstructured(obj)
+	if err != nil {
+		return 0, err
+	}
+
+	status := tj.Status.DeepCopy()
+	var requeueAfter time.Duration
+	if status.TraceID == "" {
+		requeueAfter, err = c.createTrace(tj, status)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		if err := c.observeTrace(tj, status); err != nil {
+			return 0, err
+		}
+	}
+	status.ObservedGeneration = tj.Generation
+
+	if equality.Semantic.DeepEqual(*status, tj.Status) {
+		return requeueAfter, nil
+	}
+	return requeueAfter, c.updateStatus(ctx, tj, status)
+}
+
+// createTrace creates the job and config map running the trace of tj.
+func (c *Controller) createTrace(tj *v1alpha1.TraceJob, status *v1alpha1.TraceJobStatus) (time.Duration, error) {
+	spec := c.withDefaults(tj)
+	if err := validateSpec(spec); err != nil {
+		status.Phase = v1alpha1.TraceJobFailed
+		status.Message = err.Error()
+		return 0, nil
+	}
+
+	targetNamespace := spec.TargetNamespace
+	if targetNamespace == "" {
+		targetNamespace = tj.Namespace
+	}
+
+	// validateSpec made sure the resources are valid.
+	resources, _ := tracejob.CompleteResourceRequirements(specResources(spec))
+
+	// The node of the target must have room for the resources the trace job requests.
+	targets, err := tracejob.ResolveTraceJobTargets(c.clientset, spec.Resource, spec.Container, targetNamespace, tracejob.TargetSelection{
+		Policy:     tracejob.SelectFirst,
+		Requests:   resources.Requests,
+		NotStarted: waitForProcess(spec) > 0,
+	})
+	if errors.IsUnallocatableTargetError(err) {
+		status.Phase = v1alpha1.TraceJobPending
+		status.Message = err.Error()
+		return unallocatableRetryPeriod, nil
+	}
+	if err != nil {
+		status.Phase = v1alpha1.TraceJobFailed
+		status.Message = err.Error()
+		return 0, nil
+	}
+	target := targets[0]
+
+	// Catch the mistakes in the program before the trace job is scheduled, like kubectl trace run does.
+	if spec.Tracer == "bpftrace" {
+		if err := tracejob.CheckProgram(spec.Program, target.PodUID != ""); err != nil {
+			status.Phase = v1alpha1.TraceJobFailed
+			status.Message = fmt.Sprintf("invalid bpftrace program: %v", err)
+			return 0, nil
+		}
+	}
+
+	// The trace is identified by the TraceJob, so that creating it again after a
+	// failed status update finds the same job.
+	nj := tracejob.TraceJob{
+		Name:                 fmt.Sprintf("%s%s", meta.ObjectNamePrefix, string(tj.UID)),
+		Namespace:            tj.Namespace,
+		ServiceAccount:       spec.ServiceAccount,
+		ID:                   tj.UID,
+		Target:               target,
+		ProcessSelector:      spec.ProcessSelector,
+		WaitForProcess:       waitForProcess(spec),
+		Tracer:               spec.Tracer,
+		Output:               spec.Output,
+		Program:              spec.Program,
+		ProgramArgs:          spec.ProgramArgs,
+		GoogleAppSecret:      spec.GoogleAppSecret,
+		ImageNameTag:         spec.ImageNameTag,
+		InitImageNameTag:     spec.InitImageNameTag,
+		FetchHeaders:         spec.FetchHeaders,
+		Deadline:             spec.Deadline,
+		DeadlineGracePeriod:  spec.DeadlineGracePeriod,
+		TTL:                  spec.TTL,
+		Resources:            resources,
+		SecurityProfile:      tracejob.SecurityProfile(spec.SecurityProfile),
+		AWSCredentialsSecret: spec.AWSCredentialsSecret,
+		HTTPHeadersSecret:    spec.HTTPHeadersSecret,
+		HTTPUploadFormat:     spec.HTTPUploadFormat,
+		Format:               spec.Format,
+		EventsSink:           spec.EventsSink,
+		OwnerReferences: []metav1.OwnerReference{
+			*metav1.NewControllerRef(tj, v1alpha1.SchemeGroupVersion.WithKind(v1alpha1.Kind)),
+		},
+	}
+
+	tc := tracejob.NewTraceJobClient(c.clientset, tj.Namespace)
+	if _, err := tc.CreateJob(nj); err != nil && !apierrors.IsAlreadyExists(err) {
+		return 0, err
+	}
+
+	status.Phase = v1alpha1.TraceJobPending
+	status.Message = ""
+	status.TraceID = nj.ID
+	status.JobName = nj.Name
+	status.Node = target.Node
+	return 0, nil
+}
+
+// observeTrace reports the state of the trace job of tj in status.
+func (c *Controller) observeTrace(tj *v1alpha1.TraceJob, status *v1alpha1.TraceJobStatus) error {
+	tc := tracejob.NewTraceJobClient(c.clientset, tj.Namespace)
+	id := status.TraceID
+	jobs, err := tc.GetJob(tracejob.TraceJobFilter{ID: &id})
+	if err != nil {
+		return err
+	}
+
+	if len(jobs) == 0 {
+		if status.Phase != v1alpha1.TraceJobCompleted && status.Phase != v1alpha1.TraceJobFailed {
+			status.Phase = v1alpha1.TraceJobUnknown
+			status.Message = fmt.Sprintf("job %s not found", status.JobName)
+		}
+		return nil
+	}
+
+	job := jobs[0]
+	status.StartTime = job.StartTime
+	status.Message = ""
+	switch job.Status {
+	case tracejob.TraceJobRunning:
+		status.Phase = v1alpha1.TraceJobRunning
+	case tracejob.TraceJobCompleted:
+		status.Phase = v1alpha1.TraceJobCompleted
+	case tracejob.TraceJobFailed:
+		status.Phase = v1alpha1.TraceJobFailed
+	default:
+		status.Phase = v1alpha1.TraceJobPending
+	}
+	return nil
+}
+
+func (c *Controller) updateStatus(ctx context.Context, tj *v1alpha1.TraceJob, status *v1alpha1.TraceJobStatus) error {
+	updated := tj.DeepCopy()
+	updated.Status = *status
+
+	obj, err := toUnstructured(updated)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.dynamicClient.Resource(v1alpha1.SchemeGroupVersionResource).Namespace(tj.Namespace).UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
+// withDefaults returns the spec of tj, with the fields left empty set to the controller defaults.
+func (c *Controller) withDefaults(tj *v1alpha1.TraceJob) v1alpha1.TraceJobSpec {
+	spec := *tj.Spec.DeepCopy()
+	if spec.Tracer == "" {
+		spec.Tracer = "bpftrace"
+	}
+	if spec.Output == "" {
+		spec.Output = "stdout"
+	}
+	if spec.ServiceAccount == "" {
+		spec.ServiceAccount = "default"
+	}
+	if spec.ImageNameTag == "" {
+		spec.ImageNameTag = c.options.ImageNameTag
+	}
+	if spec.InitImageNameTag == "" {
+		spec.InitImageNameTag = c.options.InitImageNameTag
+	}
+	if spec.Deadline == 0 {
+		spec.Deadline = c.options.Deadline
+	}
+	if spec.DeadlineGracePeriod == 0 {
+		spec.DeadlineGracePeriod = c.options.DeadlineGracePeriod
+	}
+	return spec
+}
+
+func specResources(spec v1alpha1.TraceJobSpec) corev1.ResourceRequirements {
+	if spec.Resources == nil {
+		return corev1.ResourceRequirements{}
+	}
+	return *spec.Resources
+}
+
+func waitForProcess(spec v1alpha1.TraceJobSpec) time.Duration {
+	if spec.WaitForProcess == nil {
+		return 0
+	}
+	return spec.WaitForProcess.Duration
+}
+
+func validateSpec(spec v1alpha1.TraceJobSpec) error {
+	if spec.Resource == "" {
+		return fmt.Errorf("spec.resource is required")
+	}
+	if spec.Program == "" {
+		return fmt.Errorf("spec.program is required")
+	}
+	// Local outputs are downloaded by kubectl trace run, nobody would download them here.
+	if spec.Output != "stdout" && !upload.Supported(spec.Output) {
+		return fmt.Errorf("unsupported output %s, must be stdout or a URI of %s", spec.Output, strings.Join(upload.Schemes(), ", "))
+	}
+	if _, err := tracejob.ParseSecurityProfile(spec.SecurityProfile); err != nil {
+		return err
+	}
+	if _, err := tracejob.CompleteResourceRequirements(specResources(spec)); err != nil {
+		return fmt.Errorf("invalid spec.resources: %v", err)
+	}
+	selector, err := tracejob.NewProcessSelector(spec.ProcessSelector)
+	if err != nil {
+		return err
+	}
+	if err := tracejob.ValidateSelectorForTracer(spec.Tracer, selector); err != nil {
+		return err
+	}
+	if waitForProcess(spec) < 0 {
+		return fmt.Errorf("spec.waitForProcess cannot be negative")
+	}
+	switch spec.HTTPUploadFormat {
+	case "", upload.HTTPUploadTar, upload.HTTPUploadMultipart:
+	default:
+		return fmt.Errorf("unknown spec.httpUploadFormat %s, must be %s or %s", spec.HTTPUploadFormat, upload.HTTPUploadTar, upload.HTTPUploadMultipart)
+	}
+	switch spec.Format {
+	case "", events.TextFormat:
+	case events.JSONFormat:
+		if spec.Tracer != "" && spec.Tracer != "bpftrace" {
+			return fmt.Errorf("spec.format %s can only be used with the bpftrace tracer", spec.Format)
+		}
+	default:
+		return fmt.Errorf("unknown spec.format %s, must be %s or %s", spec.Format, events.TextFormat, events.JSONFormat)
+	}
+	if spec.EventsSink != "" {
+		if spec.Format != events.JSONFormat {
+			return fmt.Errorf("spec.eventsSink can only be used with spec.format %s", events.JSONFormat)
+		}
+		if err := events.ValidateSink(spec.EventsSink); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fromUnstructured(obj runtime.Object) (*v1alpha1.TraceJob, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T", obj)
+	}
+	tj := &v1alpha1.TraceJob{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), tj); err != nil {
+		return nil, err
+	}
+	return tj, nil
+}
+
+func toUnstructured(tj *v1alpha1.TraceJob) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetAPIVersion(v1alpha1.SchemeGroupVersion.String())
+	u.SetKind(v1alpha1.Kind)
+	return u, nil
+}
@@ -0,0 +1,249 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/apis/trace/v1alpha1"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testNamespace = "tracing"
+
+func testNode(name string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"kubernetes.io/hostname": name},
+		},
+		Status: v1.NodeStatus{
+			Allocatable: v1.ResourceList{
+				v1.ResourcePods:   resource.MustParse("110"),
+				v1.ResourceCPU:    resource.MustParse("4"),
+				v1.ResourceMemory: resource.MustParse("8Gi"),
+			},
+		},
+	}
+}
+
+func testTraceJob(name, resource string) *v1alpha1.TraceJob {
+	return &v1alpha1.TraceJob{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       v1alpha1.Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  testNamespace,
+			UID:        types.UID(name + "-uid"),
+			Generation: 1,
+		},
+		Spec: v1alpha1.TraceJobSpec{
+			Resource: resource,
+			Program:  "kprobe:do_sys_open { @[comm] = count(); }",
+		},
+	}
+}
+
+func newTestController(t *testing.T, tjs ...*v1alpha1.TraceJob) (*Controller, *fake.Clientset) {
+	clientset := fake.NewSimpleClientset(testNode("node-a"))
+
+	// The dynamic client only deals with unstructured objects, so the typed objects are not registered.
+	scheme := runtime.NewScheme()
+	objects := []runtime.Object{}
+	for _, tj := range tjs {
+		u, err := toUnstructured(tj)
+		require.NoError(t, err)
+		objects = append(objects, u)
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme,
+		map[schema.GroupVersionResource]string{v1alpha1.SchemeGroupVersionResource: "TraceJobList"},
+		objects...)
+
+	c := New(clientset, dynamicClient, Options{
+		ImageNameTag:        "runner:latest",
+		InitImageNameTag:    "init:latest",
+		Deadline:            3600,
+		DeadlineGracePeriod: 30,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c.traceJobInformers.Start(ctx.Done())
+	c.traceJobInformers.WaitForCacheSync(ctx.Done())
+
+	return c, clientset
+}
+
+func getTraceJob(t *testing.T, c *Controller, name string) *v1alpha1.TraceJob {
+	u, err := c.dynamicClient.Resource(v1alpha1.SchemeGroupVersionResource).Namespace(testNamespace).Get(context.Background(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	tj, err := fromUnstructured(u)
+	require.NoError(t, err)
+	return tj
+}
+
+func TestReconcileCreatesTraceJob(t *testing.T) {
+	c, clientset := newTestController(t, testTraceJob("trace-a", "node/node-a"))
+
+	_, err := c.Reconcile(context.Background(), testNamespace+"/trace-a")
+	require.NoError(t, err)
+
+	tj := getTraceJob(t, c, "trace-a")
+	assert.Equal(t, v1alpha1.TraceJobPending, tj.Status.Phase)
+	assert.Equal(t, types.UID("trace-a-uid"), tj.Status.TraceID)
+	assert.Equal(t, meta.ObjectNamePrefix+"trace-a-uid", tj.Status.JobName)
+	assert.Equal(t, "node-a", tj.Status.Node)
+	assert.Equal(t, int64(1), tj.Status.ObservedGeneration)
+
+	job, err := clientset.BatchV1().Jobs(testNamespace).Get(context.Background(), tj.Status.JobName, metav1.GetOptions{})
+	require.NoError(t, err)
+	owner := metav1.GetControllerOf(job)
+	require.NotNil(t, owner)
+	assert.Equal(t, v1alpha1.Kind, owner.Kind)
+	assert.Equal(t, "trace-a", owner.Name)
+	assert.Equal(t, "runner:latest", job.Spec.Template.Spec.Containers[0].Image)
+
+	cm, err := clientset.CoreV1().ConfigMaps(testNamespace).Get(context.Background(), tj.Status.JobName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, testTraceJob("trace-a", "").Spec.Program, cm.Data["program.bt"])
+	assert.NotNil(t, metav1.GetControllerOf(cm))
+}
+
+func TestReconcileTraceJobResources(t *testing.T) {
+	tj := testTraceJob("trace-a", "node/node-a")
+	tj.Spec.Resources = &v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("2Gi")},
+		Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("4Gi")},
+	}
+	big := testTraceJob("trace-big", "node/node-a")
+	big.Spec.Resources = &v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("8")},
+		Limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("8")},
+	}
+	c, clientset := newTestController(t, tj, big)
+
+	_, err := c.Reconcile(context.Background(), testNamespace+"/trace-a")
+	require.NoError(t, err)
+	job, err := clientset.BatchV1().Jobs(testNamespace).Get(context.Background(), meta.ObjectNamePrefix+"trace-a-uid", metav1.GetOptions{})
+	require.NoError(t, err)
+	resources := job.Spec.Template.Spec.Containers[0].Resources
+	assert.Equal(t, "2Gi", resources.Requests.Memory().String())
+	assert.Equal(t, "4Gi", resources.Limits.Memory().String())
+	assert.Equal(t, "100m", resources.Requests.Cpu().String())
+
+	// The node has 4 CPUs, the trace cannot be scheduled until it has more.
+	requeueAfter, err := c.Reconcile(context.Background(), testNamespace+"/trace-big")
+	require.NoError(t, err)
+	assert.Equal(t, unallocatableRetryPeriod, requeueAfter)
+	status := getTraceJob(t, c, "trace-big").Status
+	assert.Equal(t, v1alpha1.TraceJobPending, status.Phase)
+	assert.Contains(t, status.Message, "the trace requests 8")
+	assert.Empty(t, status.TraceID)
+}
+
+func TestReconcileReportsJobStatus(t *testing.T) {
+	tj := testTraceJob("trace-a", "node/node-a")
+	c, clientset := newTestController(t, tj)
+	_, err := c.Reconcile(context.Background(), testNamespace+"/trace-a")
+	require.NoError(t, err)
+
+	job, err := clientset.BatchV1().Jobs(testNamespace).Get(context.Background(), meta.ObjectNamePrefix+"trace-a-uid", metav1.GetOptions{})
+	require.NoError(t, err)
+	job.Status.Active = 1
+	_, err = clientset.BatchV1().Jobs(testNamespace).UpdateStatus(context.Background(), job, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	// Make the lister see the status written by the first reconciliation.
+	updated := getTraceJob(t, c, "trace-a")
+	u, err := toUnstructured(updated)
+	require.NoError(t, err)
+	require.NoError(t, c.traceJobInformers.ForResource(v1alpha1.SchemeGroupVersionResource).Informer().GetIndexer().Update(u))
+
+	_, err = c.Reconcile(context.Background(), testNamespace+"/trace-a")
+	require.NoError(t, err)
+	assert.Equal(t, v1alpha1.TraceJobRunning, getTraceJob(t, c, "trace-a").Status.Phase)
+
+	require.NoError(t, clientset.BatchV1().Jobs(testNamespace).Delete(context.Background(), job.Name, metav1.DeleteOptions{}))
+	_, err = c.Reconcile(context.Background(), testNamespace+"/trace-a")
+	require.NoError(t, err)
+	status := getTraceJob(t, c, "trace-a").Status
+	assert.Equal(t, v1alpha1.TraceJobUnknown, status.Phase)
+	assert.Contains(t, status.Message, "not found")
+}
+
+func TestReconcileInvalidTraceJob(t *testing.T) {
+	local := testTraceJob("trace-local", "node/node-a")
+	local.Spec.Output = "./trace.tar"
+	unconfined := testTraceJob("trace-unconfined", "node/node-a")
+	unconfined.Spec.SecurityProfile = "unconfined"
+	badSelector := testTraceJob("trace-bad-selector", "node/node-a")
+	badSelector.Spec.ProcessSelector = "exe=~("
+	badUploadFormat := testTraceJob("trace-bad-upload-format", "node/node-a")
+	badUploadFormat.Spec.HTTPUploadFormat = "zip"
+	badResources := testTraceJob("trace-bad-resources", "node/node-a")
+	badResources.Spec.Resources = &v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("2G")},
+	}
+	badEventsSink := testTraceJob("trace-bad-events-sink", "node/node-a")
+	badEventsSink.Spec.Format = "json"
+	badEventsSink.Spec.EventsSink = "syslog://localhost"
+	rbspyWithoutPid := testTraceJob("trace-rbspy-without-pid", "node/node-a")
+	rbspyWithoutPid.Spec.Tracer = "rbspy"
+	rbspyWithoutPid.Spec.Program = "rbspy"
+	badProgram := testTraceJob("trace-bad-program", "node/node-a")
+	badProgram.Spec.Program = "kprobe:do_sys_open { @[comm] = count(); "
+	containerPidOnNode := testTraceJob("trace-container-pid-on-node", "node/node-a")
+	containerPidOnNode.Spec.Program = "uprobe:/proc/$container_pid/exe:main { @ = count(); }"
+
+	tests := []struct {
+		tj      *v1alpha1.TraceJob
+		message string
+	}{
+		{tj: testTraceJob("trace-missing", "pod/missing"), message: "missing"},
+		{tj: testTraceJob("trace-unsupported", "service/api"), message: "service"},
+		{tj: local, message: "unsupported output"},
+		{tj: unconfined, message: "unknown security profile"},
+		{tj: badSelector, message: "invalid regular expression"},
+		{tj: badUploadFormat, message: "unknown spec.httpUploadFormat zip"},
+		{tj: badResources, message: "invalid spec.resources: the memory request 2G is greater than its limit 1G"},
+		{tj: badEventsSink, message: "unknown events sink syslog://localhost"},
+		{tj: rbspyWithoutPid, message: "a pid process selector must be specified for tracer rbspy"},
+		{tj: badProgram, message: "invalid bpftrace program"},
+		{tj: containerPidOnNode, message: "invalid bpftrace program: line 1: $container_pid can only be used when tracing a pod"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tj.Name, func(t *testing.T) {
+			c, clientset := newTestController(t, tt.tj)
+			_, err := c.Reconcile(context.Background(), testNamespace+"/"+tt.tj.Name)
+			require.NoError(t, err)
+
+			status := getTraceJob(t, c, tt.tj.Name).Status
+			assert.Equal(t, v1alpha1.TraceJobFailed, status.Phase)
+			assert.Contains(t, status.Message, tt.message)
+			assert.Empty(t, status.TraceID)
+
+			jobs, err := clientset.BatchV1().Jobs(testNamespace).List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+			assert.Empty(t, jobs.Items)
+		})
+	}
+}
+
+func TestReconcileDeletedTraceJob(t *testing.T) {
+	c, _ := newTestController(t)
+	requeueAfter, err := c.Reconcile(context.Background(), testNamespace+"/gone")
+	assert.NoError(t, err)
+	assert.Zero(t, requeueAfter)
+}
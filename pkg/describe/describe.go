@@ -0,0 +1,295 @@
+package describe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+	kubedescribe "k8s.io/kubectl/pkg/describe"
+)
+
+// Describer shows everything known about a trace, to understand what it does and why it is stuck.
+type Describer struct {
+	clientset kubernetes.Interface
+}
+
+// NewDescriber creates a describer for the traces reachable with clientset.
+func NewDescriber(clientset kubernetes.Interface) *Describer {
+	return &Describer{clientset: clientset}
+}
+
+// Describe writes the description of tj to out: its spec, the state of its job and pods,
+// the events about them and its program.
+func (d *Describer) Describe(tj tracejob.TraceJob, out io.Writer) error {
+	job, err := d.clientset.BatchV1().Jobs(tj.Namespace).Get(context.Background(), tj.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		job = nil
+	} else if err != nil {
+		return err
+	}
+
+	pl, err := d.clientset.CoreV1().Pods(tj.Namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, tj.ID),
+	})
+	if err != nil {
+		return err
+	}
+
+	events := &corev1.EventList{}
+	if job != nil {
+		if err := d.appendEvents(events, tj.Namespace, job.UID); err != nil {
+			return err
+		}
+	}
+	for _, pod := range pl.Items {
+		if err := d.appendEvents(events, tj.Namespace, pod.UID); err != nil {
+			return err
+		}
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	w := kubedescribe.NewPrefixWriter(tw)
+	describeTrace(tj, w)
+	describeJob(job, w)
+	describePods(pl.Items, w)
+	describeProgram(tj.Program, w)
+	kubedescribe.DescribeEvents(events, w)
+	return tw.Flush()
+}
+
+// appendEvents appends the events involving the object identified by uid to events.
+func (d *Describer) appendEvents(events *corev1.EventList, namespace string, uid types.UID) error {
+	el, err := d.clientset.CoreV1().Events(namespace).List(context.Background(), metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("involvedObject.uid", string(uid)).String(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range el.Items {
+		// Not every client honours field selectors.
+		if e.InvolvedObject.UID == uid {
+			events.Items = append(events.Items, e)
+		}
+	}
+	return nil
+}
+
+func describeTrace(tj tracejob.TraceJob, w kubedescribe.PrefixWriter) {
+	w.Write(kubedescribe.LEVEL_0, "Name:\t%s\n", tj.Name)
+	w.Write(kubedescribe.LEVEL_0, "Namespace:\t%s\n", tj.Namespace)
+	w.Write(kubedescribe.LEVEL_0, "ID:\t%s\n", tj.ID)
+	w.Write(kubedescribe.LEVEL_0, "Group:\t%s\n", valueOrNone(string(tj.Group)))
+	w.Write(kubedescribe.LEVEL_0, "Status:\t%s\n", valueOrNone(string(tj.Status)))
+	w.Write(kubedescribe.LEVEL_0, "Start Time:\t%s\n", timestamp(tj.StartTime))
+	w.Write(kubedescribe.LEVEL_0, "Target:\n")
+	w.Write(kubedescribe.LEVEL_1, "Node:\t%s\n", valueOrNone(tj.Target.Node))
+	if tj.Target.PodUID != "" {
+		w.Write(kubedescribe.LEVEL_1, "Pod:\t%s\n", valueOrNone(tj.Target.Pod))
+		w.Write(kubedescribe.LEVEL_1, "Pod Namespace:\t%s\n", valueOrNone(tj.Target.Namespace))
+		w.Write(kubedescribe.LEVEL_1, "Pod UID:\t%s\n", tj.Target.PodUID)
+		w.Write(kubedescribe.LEVEL_1, "Container:\t%s\n", valueOrNone(tj.Target.Container))
+		w.Write(kubedescribe.LEVEL_1, "Container ID:\t%s\n", valueOrNone(tj.Target.ContainerID))
+	}
+	w.Write(kubedescribe.LEVEL_0, "Tracer:\t%s\n", valueOrNone(tj.Tracer))
+	w.Write(kubedescribe.LEVEL_0, "Process Selector:\t%s\n", valueOrNone(tj.ProcessSelector))
+	if tj.WaitForProcess > 0 {
+		w.Write(kubedescribe.LEVEL_0, "Wait For Process:\t%s\n", tj.WaitForProcess)
+	}
+	w.Write(kubedescribe.LEVEL_0, "Program Args:\t%s\n", valueOrNone(strings.Join(tj.ProgramArgs, " ")))
+	w.Write(kubedescribe.LEVEL_0, "Output:\t%s\n", valueOrNone(tj.Output))
+	w.Write(kubedescribe.LEVEL_0, "Deadline:\t%s\n", seconds(tj.Deadline))
+	w.Write(kubedescribe.LEVEL_0, "Deadline Grace Period:\t%s\n", seconds(tj.DeadlineGracePeriod))
+	if tj.TTL != nil {
+		w.Write(kubedescribe.LEVEL_0, "TTL:\t%ds\n", *tj.TTL)
+	}
+	if len(tj.Resources.Requests) > 0 || len(tj.Resources.Limits) > 0 {
+		w.Write(kubedescribe.LEVEL_0, "Resources:\n")
+		w.Write(kubedescribe.LEVEL_1, "Requests:\t%s\n", resourceList(tj.Resources.Requests))
+		w.Write(kubedescribe.LEVEL_1, "Limits:\t%s\n", resourceList(tj.Resources.Limits))
+	}
+	if tj.SecurityProfile != "" {
+		w.Write(kubedescribe.LEVEL_0, "Security Profile:\t%s\n", tj.SecurityProfile)
+	}
+	w.Write(kubedescribe.LEVEL_0, "Service Account:\t%s\n", valueOrNone(tj.ServiceAccount))
+	w.Write(kubedescribe.LEVEL_0, "Image:\t%s\n", valueOrNone(tj.ImageNameTag))
+	w.Write(kubedescribe.LEVEL_0, "Fetch Headers:\t%t\n", tj.FetchHeaders)
+	if tj.FetchHeaders {
+		w.Write(kubedescribe.LEVEL_0, "Init Image:\t%s\n", valueOrNone(tj.InitImageNameTag))
+	}
+	if tj.GoogleAppSecret != "" {
+		w.Write(kubedescribe.LEVEL_0, "Google App Secret:\t%s\n", tj.GoogleAppSecret)
+	}
+	if tj.AWSCredentialsSecret != "" {
+		w.Write(kubedescribe.LEVEL_0, "AWS Credentials Secret:\t%s\n", tj.AWSCredentialsSecret)
+	}
+	if tj.HTTPHeadersSecret != "" {
+		w.Write(kubedescribe.LEVEL_0, "HTTP Headers Secret:\t%s\n", tj.HTTPHeadersSecret)
+	}
+	if tj.HTTPUploadFormat != "" {
+		w.Write(kubedescribe.LEVEL_0, "HTTP Upload Format:\t%s\n", tj.HTTPUploadFormat)
+	}
+	if tj.Format != "" {
+		w.Write(kubedescribe.LEVEL_0, "Format:\t%s\n", tj.Format)
+	}
+	if tj.EventsSink != "" {
+		w.Write(kubedescribe.LEVEL_0, "Events Sink:\t%s\n", tj.EventsSink)
+	}
+	if tj.Patch != "" {
+		w.Write(kubedescribe.LEVEL_0, "Patch Type:\t%s\n", tj.PatchType)
+	}
+}
+
+func describeJob(job *batchv1.Job, w kubedescribe.PrefixWriter) {
+	if job == nil {
+		w.Write(kubedescribe.LEVEL_0, "Job:\t<not found>\n")
+		return
+	}
+
+	w.Write(kubedescribe.LEVEL_0, "Job:\n")
+	w.Write(kubedescribe.LEVEL_1, "Active:\t%d\n", job.Status.Active)
+	w.Write(kubedescribe.LEVEL_1, "Succeeded:\t%d\n", job.Status.Succeeded)
+	w.Write(kubedescribe.LEVEL_1, "Failed:\t%d\n", job.Status.Failed)
+	if job.Status.CompletionTime != nil {
+		w.Write(kubedescribe.LEVEL_1, "Completion Time:\t%s\n", timestamp(job.Status.CompletionTime))
+	}
+	if len(job.Status.Conditions) == 0 {
+		w.Write(kubedescribe.LEVEL_1, "Conditions:\t<none>\n")
+		return
+	}
+	w.Write(kubedescribe.LEVEL_1, "Conditions:\n")
+	w.Write(kubedescribe.LEVEL_2, "Type\tStatus\tReason\tMessage\n")
+	w.Write(kubedescribe.LEVEL_2, "----\t------\t------\t-------\n")
+	for _, c := range job.Status.Conditions {
+		w.Write(kubedescribe.LEVEL_2, "%v\t%v\t%s\t%s\n", c.Type, c.Status, valueOrNone(c.Reason), valueOrNone(c.Message))
+	}
+}
+
+func describePods(pods []corev1.Pod, w kubedescribe.PrefixWriter) {
+	if len(pods) == 0 {
+		w.Write(kubedescribe.LEVEL_0, "Pods:\t<none>\n")
+		return
+	}
+
+	w.Write(kubedescribe.LEVEL_0, "Pods:\n")
+	for _, pod := range pods {
+		w.Write(kubedescribe.LEVEL_1, "%s:\n", pod.Name)
+		w.Write(kubedescribe.LEVEL_2, "Phase:\t%s\n", pod.Status.Phase)
+		if pod.Status.Reason != "" {
+			w.Write(kubedescribe.LEVEL_2, "Reason:\t%s\n", pod.Status.Reason)
+		}
+		if pod.Status.Message != "" {
+			w.Write(kubedescribe.LEVEL_2, "Message:\t%s\n", pod.Status.Message)
+		}
+		for _, c := range pod.Status.Conditions {
+			if c.Status != corev1.ConditionTrue && c.Reason != "" {
+				w.Write(kubedescribe.LEVEL_2, "%s:\t%s (%s)\n", c.Type, c.Reason, strings.TrimSpace(c.Message))
+			}
+		}
+		describeContainerStatuses("Init Containers", pod.Status.InitContainerStatuses, w)
+		describeContainerStatuses("Containers", pod.Status.ContainerStatuses, w)
+	}
+}
+
+func describeContainerStatuses(label string, statuses []corev1.ContainerStatus, w kubedescribe.PrefixWriter) {
+	if len(statuses) == 0 {
+		return
+	}
+	w.Write(kubedescribe.LEVEL_2, "%s:\n", label)
+	for _, s := range statuses {
+		w.Write(kubedescribe.LEVEL_3, "%s:\t%s\n", s.Name, containerState(s.State))
+		if s.RestartCount > 0 {
+			w.Write(kubedescribe.LEVEL_3, "%s restarts:\t%d, last %s\n", s.Name, s.RestartCount, containerState(s.LastTerminationState))
+		}
+	}
+}
+
+// containerState summarizes the state of a container, with the reason it is waiting or terminated.
+func containerState(state corev1.ContainerState) string {
+	switch {
+	case state.Running != nil:
+		return fmt.Sprintf("Running since %s", timestamp(&state.Running.StartedAt))
+	case state.Waiting != nil:
+		return withMessage(fmt.Sprintf("Waiting: %s", valueOrNone(state.Waiting.Reason)), state.Waiting.Message)
+	case state.Terminated != nil:
+		t := state.Terminated
+		reason := t.Reason
+		if reason == "" && t.Signal != 0 {
+			reason = fmt.Sprintf("Signal %d", t.Signal)
+		}
+		return withMessage(fmt.Sprintf("Terminated: %s, exit code %d", valueOrNone(reason), t.ExitCode), t.Message)
+	default:
+		return "Waiting"
+	}
+}
+
+func describeProgram(program string, w kubedescribe.PrefixWriter) {
+	if program == "" {
+		w.Write(kubedescribe.LEVEL_0, "Program:\t<none>\n")
+		return
+	}
+	w.Write(kubedescribe.LEVEL_0, "Program:\n")
+	// Tabs would be taken as column separators by the tab writer.
+	program = strings.ReplaceAll(strings.TrimRight(program, "\n"), "\t", "    ")
+	for _, line := range strings.Split(program, "\n") {
+		w.Write(kubedescribe.LEVEL_1, "%s\n", line)
+	}
+}
+
+func withMessage(s, message string) string {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return s
+	}
+	return fmt.Sprintf("%s (%s)", s, message)
+}
+
+// resourceList formats a list of resources as cpu=100m, memory=100Mi.
+func resourceList(l corev1.ResourceList) string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	resources := make([]string, 0, len(names))
+	for _, name := range names {
+		q := l[corev1.ResourceName(name)]
+		resources = append(resources, fmt.Sprintf("%s=%s", name, q.String()))
+	}
+	return valueOrNone(strings.Join(resources, ", "))
+}
+
+func valueOrNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
+
+func seconds(s int64) string {
+	if s == 0 {
+		return "<none>"
+	}
+	return fmt.Sprintf("%ds", s)
+}
+
+func timestamp(t *metav1.Time) string {
+	if t == nil || t.IsZero() {
+		return "<unknown>"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Time.Format(time.RFC1123Z), duration.HumanDuration(time.Since(t.Time)))
+}
@@ -0,0 +1,139 @@
+package describe
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testNamespace = "default"
+
+func TestDescribe(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	tc := tracejob.NewTraceJobClient(clientset, testNamespace)
+
+	_, err := tc.CreateJob(tracejob.TraceJob{
+		Name:                "kubectl-trace-1",
+		ID:                  "1",
+		Namespace:           testNamespace,
+		Tracer:              "bpftrace",
+		ProcessSelector:     "exe=ruby",
+		Output:              "stdout",
+		Program:             "kprobe:do_sys_open\n{\n\t@[comm] = count();\n}\n",
+		ImageNameTag:        "runner:latest",
+		InitImageNameTag:    "init:latest",
+		FetchHeaders:        true,
+		Deadline:            3600,
+		DeadlineGracePeriod: 30,
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("100Mi")},
+			Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("1G")},
+		},
+		Target: tracejob.TraceJobTarget{
+			Node:        "node-a",
+			PodUID:      "api-1-uid",
+			ContainerID: "api-1-container",
+			Pod:         "api-1",
+			Container:   "app",
+			Namespace:   "apps",
+		},
+	})
+	require.NoError(t, err)
+
+	job, err := clientset.BatchV1().Jobs(testNamespace).Get(context.Background(), "kubectl-trace-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	job.UID = "job-uid"
+	job.Status.Failed = 1
+	job.Status.Conditions = []batchv1.JobCondition{
+		{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"},
+	}
+	_, err = clientset.BatchV1().Jobs(testNamespace).Update(context.Background(), job, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kubectl-trace-1-abcde",
+			Namespace: testNamespace,
+			UID:       "pod-uid",
+			Labels:    map[string]string{meta.TraceIDLabelKey: "1"},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodFailed,
+			InitContainerStatuses: []corev1.ContainerStatus{
+				{Name: "kubectl-trace-init", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}},
+			},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "kubectl-trace-1", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}}},
+			},
+		},
+	}
+	_, err = clientset.CoreV1().Pods(testNamespace).Create(context.Background(), pod, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	for _, e := range []*corev1.Event{
+		{
+			ObjectMeta:     metav1.ObjectMeta{Name: "job-event", Namespace: testNamespace},
+			InvolvedObject: corev1.ObjectReference{Kind: "Job", Name: "kubectl-trace-1", UID: "job-uid"},
+			Type:           corev1.EventTypeWarning,
+			Reason:         "BackoffLimitExceeded",
+			Message:        "Job has reached the specified backoff limit",
+		},
+		{
+			ObjectMeta:     metav1.ObjectMeta{Name: "other-event", Namespace: testNamespace},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "other", UID: "other-uid"},
+			Type:           corev1.EventTypeNormal,
+			Reason:         "Unrelated",
+		},
+	} {
+		_, err = clientset.CoreV1().Events(testNamespace).Create(context.Background(), e, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	tjs, err := tc.GetJob(tracejob.TraceJobFilter{Name: &job.Name})
+	require.NoError(t, err)
+	require.Len(t, tjs, 1)
+
+	var out bytes.Buffer
+	require.NoError(t, NewDescriber(clientset).Describe(tjs[0], &out))
+	description := out.String()
+
+	for _, expected := range []string{
+		`Name:\s+kubectl-trace-1\n`,
+		`Status:\s+Failed\n`,
+		`Pod:\s+api-1\n`,
+		`Pod Namespace:\s+apps\n`,
+		`Tracer:\s+bpftrace\n`,
+		`Process Selector:\s+exe=ruby\n`,
+		`Deadline:\s+3600s\n`,
+		`Init Image:\s+init:latest\n`,
+		`Requests:\s+cpu=100m, memory=100Mi\n`,
+		`Limits:\s+cpu=1, memory=1G\n`,
+		`Failed\s+True\s+BackoffLimitExceeded\s+Job has reached the specified backoff limit\n`,
+		`Phase:\s+Failed\n`,
+		`kubectl-trace-init:\s+Terminated: Completed, exit code 0\n`,
+		`kubectl-trace-1:\s+Terminated: OOMKilled, exit code 137\n`,
+		`\n      @\[comm\] = count\(\);\n`,
+		`Warning\s+BackoffLimitExceeded`,
+	} {
+		assert.Regexp(t, expected, description)
+	}
+	assert.NotContains(t, description, "Unrelated")
+}
+
+func TestDescribeJobNotFound(t *testing.T) {
+	var out bytes.Buffer
+	err := NewDescriber(fake.NewSimpleClientset()).Describe(tracejob.TraceJob{Name: "kubectl-trace-1", ID: "1", Namespace: testNamespace}, &out)
+	require.NoError(t, err)
+	assert.Regexp(t, `Job:\s+<not found>\n`, out.String())
+	assert.Regexp(t, `Events:\s+<none>\n`, out.String())
+}
@@ -3,8 +3,10 @@ package downloader
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/iovisor/kubectl-trace/pkg/meta"
@@ -117,6 +119,48 @@ func (d *Downloader) Start(traceJobID types.UID, namespace, downloadDir, podOutD
 	return err
 }
 
+// StartGroup downloads the output of every trace job in a group and merges them
+// into a single archive, with the output of each trace rooted at its trace job ID.
+func (d *Downloader) StartGroup(groupID types.UID, traceJobIDs []types.UID, namespace, downloadDir, podOutDir string) error {
+	tmpDir, err := ioutil.TempDir("", Filename(groupID))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(traceJobIDs))
+	for i, id := range traceJobIDs {
+		wg.Add(1)
+		go func(i int, id types.UID) {
+			defer wg.Done()
+			errs[i] = d.Start(id, namespace, tmpDir, podOutDir)
+		}(i, id)
+	}
+	wg.Wait()
+
+	archives := map[string]string{}
+	for i, id := range traceJobIDs {
+		if errs[i] != nil {
+			return fmt.Errorf("failed to download trace %s: %v", id, errs[i])
+		}
+		archives[string(id)] = path.Join(tmpDir, Filename(id))
+	}
+
+	err = os.MkdirAll(downloadDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	groupFile, err := os.Create(path.Join(downloadDir, Filename(groupID)))
+	if err != nil {
+		return err
+	}
+	defer groupFile.Close()
+
+	return MergeTars(groupFile, archives)
+}
+
 // Filename is where downloader will put trace output.
 func Filename(traceJobID types.UID) string {
 	return fmt.Sprintf("%s%s.tar", meta.TracePrefix, traceJobID)
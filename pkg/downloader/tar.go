@@ -1,10 +1,13 @@
 package downloader
 
 import (
+	"archive/tar"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 
 	"github.com/mholt/archiver/v3"
 )
@@ -56,3 +59,49 @@ func TarDirectory(w io.Writer, path string) error {
 		})
 	})
 }
+
+// MergeTars writes a tar with the content of every archive, keyed by prefix.
+// Each entry of an archive is rooted at its prefix in the merged tar.
+func MergeTars(w io.Writer, archives map[string]string) error {
+	prefixes := make([]string, 0, len(archives))
+	for prefix := range archives {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	tw := tar.NewWriter(w)
+	for _, prefix := range prefixes {
+		if err := appendTar(tw, prefix, archives[prefix]); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func appendTar(tw *tar.Writer, prefix, archive string) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", archive, err)
+		}
+
+		hdr.Name = path.Join(prefix, hdr.Name)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
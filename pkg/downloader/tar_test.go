@@ -4,6 +4,8 @@ import (
 	"archive/tar"
 	"bytes"
 	"io"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -52,3 +54,49 @@ func TestTarDirectoryDoesNotExist(t *testing.T) {
 	err := TarDirectory(b, "does-not-exist")
 	assert.NotNil(t, err)
 }
+
+func TestMergeTars(t *testing.T) {
+	dir := t.TempDir()
+
+	archives := map[string]string{}
+	for _, prefix := range []string{"trace-b", "trace-a"} {
+		archive := filepath.Join(dir, prefix+".tar")
+		f, err := os.Create(archive)
+		assert.Nil(t, err)
+		assert.Nil(t, TarDirectory(f, "testdata/test_tar_directory"))
+		assert.Nil(t, f.Close())
+		archives[prefix] = archive
+	}
+
+	b := &bytes.Buffer{}
+	err := MergeTars(b, archives)
+	assert.Nil(t, err)
+
+	names := []string{}
+	reader := tar.NewReader(b)
+	for {
+		hdr, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		names = append(names, hdr.Name)
+	}
+
+	expected := []string{
+		"trace-a/test_tar_directory/another/baz",
+		"trace-a/test_tar_directory/bar",
+		"trace-a/test_tar_directory/foo",
+		"trace-b/test_tar_directory/another/baz",
+		"trace-b/test_tar_directory/bar",
+		"trace-b/test_tar_directory/foo",
+	}
+
+	assert.EqualValues(t, expected, names)
+}
+
+func TestMergeTarsArchiveDoesNotExist(t *testing.T) {
+	b := &bytes.Buffer{}
+	err := MergeTars(b, map[string]string{"trace": "does-not-exist.tar"})
+	assert.NotNil(t, err)
+}
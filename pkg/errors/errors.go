@@ -5,9 +5,21 @@ const (
 	ErrorUnallocatable string = "Unallocatable"
 )
 
+// These are the scheduling checks a node can fail, making it unallocatable.
+const (
+	CheckCordoned           string = "Cordoned"
+	CheckNotReady           string = "NotReady"
+	CheckNoExecuteTaint     string = "NoExecuteTaint"
+	CheckTooManyPods        string = "TooManyPods"
+	CheckInsufficientCPU    string = "InsufficientCPU"
+	CheckInsufficientMemory string = "InsufficientMemory"
+)
+
 type TargetSelectionError struct {
 	ErrorMessage string
 	ErrorType    string
+	// FailedCheck is the scheduling check that made a target unallocatable, if known.
+	FailedCheck string
 }
 
 func (e TargetSelectionError) Error() string {
@@ -28,6 +40,15 @@ func NewErrorUnallocatable(message string) error {
 	}
 }
 
+// NewErrorFailedCheck is an unallocatable error caused by a failed scheduling check.
+func NewErrorFailedCheck(check, message string) error {
+	return TargetSelectionError{
+		ErrorMessage: message,
+		ErrorType:    ErrorUnallocatable,
+		FailedCheck:  check,
+	}
+}
+
 func IsInvalidTargetError(err error) bool {
 	return reasonForError(err) == ErrorInvalid
 }
@@ -36,6 +57,15 @@ func IsUnallocatableTargetError(err error) bool {
 	return reasonForError(err) == ErrorUnallocatable
 }
 
+// FailedCheck returns the scheduling check that made a target unallocatable, or an empty string.
+func FailedCheck(err error) string {
+	myErr, ok := err.(TargetSelectionError)
+	if ok {
+		return myErr.FailedCheck
+	}
+	return ""
+}
+
 func reasonForError(err error) string {
 	myErr, ok := err.(TargetSelectionError)
 	if ok {
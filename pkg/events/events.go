@@ -0,0 +1,126 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	// BatchSize is the largest number of records sent to a sink at once.
+	BatchSize = 100
+	// FlushInterval is how often the records read are sent to the sink, when there are less than BatchSize of them.
+	FlushInterval = time.Second
+	// QueueSize is the number of batches waiting for the sink, the batches read once it is full are dropped.
+	QueueSize = 64
+
+	// maxLineSize is the size of the longest line of bpftrace, which prints a whole map on a line.
+	maxLineSize = 64 * 1024 * 1024
+)
+
+// Record is an output of bpftrace in JSON format, such as a printf, a map or a histogram,
+// along with the time it was read at and the labels of the trace.
+type Record struct {
+	Time time.Time `json:"time"`
+	// Type is the type of the output of bpftrace, eg printf, map, hist or attached_probes,
+	// or text for the lines which are not JSON.
+	Type   string            `json:"type"`
+	Data   json.RawMessage   `json:"data"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ParseRecord parses a line printed by bpftrace -f json. The lines which are not JSON outputs of bpftrace,
+// such as errors, are kept as text records.
+func ParseRecord(line []byte, now time.Time, labels map[string]string) Record {
+	var output struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(line, &output); err != nil || output.Type == "" || len(output.Data) == 0 {
+		text, _ := json.Marshal(string(line))
+		return Record{Time: now, Type: "text", Data: text, Labels: labels}
+	}
+	return Record{Time: now, Type: output.Type, Data: output.Data, Labels: labels}
+}
+
+// Forward reads the lines printed by bpftrace -f json from r until its end, and sends them to sink as records
+// with labels, in batches of up to BatchSize records at least every FlushInterval. The batches are sent from
+// another goroutine, through a queue of QueueSize batches, so that a slow sink never stops the reading of r
+// and bpftrace is not blocked writing its output. The batches the sink fails to send, and the ones read while
+// the queue is full, are reported on stderr and dropped.
+func Forward(r io.Reader, sink Sink, labels map[string]string) error {
+	lines := make(chan []byte)
+	var scanErr error
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			lines <- append([]byte{}, line...)
+		}
+		scanErr = scanner.Err()
+	}()
+
+	queue := make(chan []Record, QueueSize)
+	failed := 0
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for batch := range queue {
+			if err := sink.Send(batch); err != nil {
+				fmt.Fprintf(os.Stderr, "could not send %d events: %v\n", len(batch), err)
+				failed += len(batch)
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(FlushInterval)
+	defer ticker.Stop()
+
+	batch := []Record{}
+	dropped := 0
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		select {
+		case queue <- batch:
+		default:
+			fmt.Fprintf(os.Stderr, "the events sink is too slow, dropping %d events\n", len(batch))
+			dropped += len(batch)
+		}
+		batch = []Record{}
+	}
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				flush()
+				close(queue)
+				<-sent
+				if scanErr != nil {
+					return fmt.Errorf("could not read the output of bpftrace: %v", scanErr)
+				}
+				if failed+dropped > 0 {
+					return fmt.Errorf("%d events could not be sent", failed+dropped)
+				}
+				return nil
+			}
+			batch = append(batch, ParseRecord(line, time.Now(), labels))
+			if len(batch) >= BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
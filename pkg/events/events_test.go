@@ -0,0 +1,141 @@
+package events
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSink records the batches it is sent, failing the first ones, and waiting for release to be closed when it is set.
+type fakeSink struct {
+	mu       sync.Mutex
+	failures int
+	batches  [][]Record
+	release  chan struct{}
+}
+
+func (f *fakeSink) Send(records []Record) error {
+	if f.release != nil {
+		<-f.release
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failures > 0 {
+		f.failures--
+		return fmt.Errorf("connection refused")
+	}
+	f.batches = append(f.batches, records)
+	return nil
+}
+
+func (f *fakeSink) Close() error {
+	return nil
+}
+
+func TestParseRecord(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	labels := map[string]string{"pod_uid": "1234"}
+
+	tests := map[string]struct {
+		line         string
+		expectedType string
+		expectedData string
+	}{
+		"printf": {
+			line:         `{"type": "printf", "data": "open /etc/hosts\n"}`,
+			expectedType: "printf",
+			expectedData: `"open /etc/hosts\n"`,
+		},
+		"map": {
+			line:         `{"type": "map", "data": {"@[bash]": 3, "@[sshd]": 12}}`,
+			expectedType: "map",
+			expectedData: `{"@[bash]": 3, "@[sshd]": 12}`,
+		},
+		"not json": {
+			line:         `ERROR: Could not resolve symbol: /bin/bash:readline`,
+			expectedType: "text",
+			expectedData: `"ERROR: Could not resolve symbol: /bin/bash:readline"`,
+		},
+		"json without type": {
+			line:         `{"data": 1}`,
+			expectedType: "text",
+			expectedData: `"{\"data\": 1}"`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := ParseRecord([]byte(tt.line), now, labels)
+			assert.Equal(t, now, r.Time)
+			assert.Equal(t, tt.expectedType, r.Type)
+			assert.Equal(t, tt.expectedData, string(r.Data))
+			assert.Equal(t, labels, r.Labels)
+		})
+	}
+}
+
+func TestForward(t *testing.T) {
+	batchSize := BatchSize
+	BatchSize = 2
+	defer func() { BatchSize = batchSize }()
+
+	output := strings.Join([]string{
+		`{"type": "attached_probes", "data": {"probes": 1}}`,
+		``,
+		`{"type": "printf", "data": "hello"}`,
+		`{"type": "map", "data": {"@": 1}}`,
+	}, "\n")
+
+	sink := &fakeSink{}
+	require.NoError(t, Forward(strings.NewReader(output), sink, nil))
+	require.Len(t, sink.batches, 2)
+	assert.Len(t, sink.batches[0], 2)
+	assert.Equal(t, "attached_probes", sink.batches[0][0].Type)
+	assert.Equal(t, "printf", sink.batches[0][1].Type)
+	assert.Len(t, sink.batches[1], 1)
+	assert.Equal(t, "map", sink.batches[1][0].Type)
+
+	sink = &fakeSink{failures: 1}
+	err := Forward(strings.NewReader(output), sink, nil)
+	assert.EqualError(t, err, "2 events could not be sent")
+	require.Len(t, sink.batches, 1)
+	assert.Equal(t, "map", sink.batches[0][0].Type)
+}
+
+func TestForwardSlowSink(t *testing.T) {
+	batchSize, queueSize := BatchSize, QueueSize
+	BatchSize, QueueSize = 1, 1
+	defer func() { BatchSize, QueueSize = batchSize, queueSize }()
+
+	r, w := io.Pipe()
+	sink := &fakeSink{release: make(chan struct{})}
+	errs := make(chan error)
+	go func() { errs <- Forward(r, sink, nil) }()
+
+	written := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			fmt.Fprintf(w, "{\"type\": \"printf\", \"data\": \"%d\"}\n", i)
+		}
+		close(written)
+	}()
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the output is not read while the sink is blocked")
+	}
+
+	w.Close()
+	close(sink.release)
+	err := <-errs
+	require.NotEmpty(t, sink.batches)
+	assert.Less(t, len(sink.batches), 5)
+	assert.EqualError(t, err, fmt.Sprintf("%d events could not be sent", 5-len(sink.batches)))
+}
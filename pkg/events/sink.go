@@ -0,0 +1,298 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// TextFormat is the default output of bpftrace, printed as is.
+	TextFormat = "text"
+	// JSONFormat is the output of bpftrace -f json, whose lines are sent to a sink as records.
+	JSONFormat = "json"
+
+	// DefaultSink writes the records to stdout.
+	DefaultSink = "stdout"
+)
+
+// Sink receives the records of a trace.
+type Sink interface {
+	// Send forwards records, which are in the order bpftrace printed them.
+	Send(records []Record) error
+	// Close flushes what is left to send.
+	Close() error
+}
+
+// Backoff is how the requests of the sinks sending records over HTTP are retried.
+var Backoff = wait.Backoff{
+	Duration: 500 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    4,
+}
+
+// NewSink returns the sink of target, which is one of:
+// - stdout, writing the records as JSON lines to stdout.
+// - file:///path, appending the records as JSON lines to a file.
+// - otlp+http://host:port/path or otlp+https://, posting the records as OTLP logs, to /v1/logs when path is empty.
+// - kafka+http://host:port/topics/topic or kafka+https://, producing the records to a topic through a Kafka REST proxy.
+func NewSink(target string) (Sink, error) {
+	if target == DefaultSink {
+		return &writerSink{w: bufio.NewWriter(os.Stdout)}, nil
+	}
+
+	u, err := parseSink(target)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		if err := os.MkdirAll(filepath.Dir(u.Path), 0755); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(u.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &writerSink{w: bufio.NewWriter(f), closer: f}, nil
+	case "otlp+http", "otlp+https":
+		u.Scheme = strings.TrimPrefix(u.Scheme, "otlp+")
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/v1/logs"
+		}
+		return &httpSink{url: u.String(), contentType: "application/json", encode: encodeOTLPLogs}, nil
+	default:
+		u.Scheme = strings.TrimPrefix(u.Scheme, "kafka+")
+		return &httpSink{url: u.String(), contentType: "application/vnd.kafka.json.v2+json", encode: encodeKafkaRecords}, nil
+	}
+}
+
+// ValidateSink checks that target is a sink NewSink can create, without creating it.
+func ValidateSink(target string) error {
+	if target == DefaultSink {
+		return nil
+	}
+	_, err := parseSink(target)
+	return err
+}
+
+func parseSink(target string) (*url.URL, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid events sink %s: %v", target, err)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Host != "" || u.Path == "" {
+			return nil, fmt.Errorf("invalid events sink %s, file sinks must have an absolute path, eg file:///data/events.jsonl", target)
+		}
+	case "otlp+http", "otlp+https":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid events sink %s, no host", target)
+		}
+	case "kafka+http", "kafka+https":
+		if u.Host == "" || !strings.HasPrefix(u.Path, "/topics/") || len(u.Path) == len("/topics/") {
+			return nil, fmt.Errorf("invalid events sink %s, kafka sinks must be the URL of a topic of a REST proxy, eg kafka+http://rest-proxy:8082/topics/traces", target)
+		}
+	default:
+		return nil, fmt.Errorf("unknown events sink %s, must be stdout or a file://, otlp+http://, otlp+https://, kafka+http:// or kafka+https:// URL", target)
+	}
+	return u, nil
+}
+
+// writerSink writes the records as JSON lines.
+type writerSink struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+}
+
+func (s *writerSink) Send(records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enc := json.NewEncoder(s.w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return s.w.Flush()
+}
+
+func (s *writerSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+// httpSink posts each batch of records encoded by encode to url.
+type httpSink struct {
+	url         string
+	contentType string
+	encode      func(records []Record) ([]byte, error)
+	client      *http.Client
+}
+
+func (s *httpSink) Send(records []Record) error {
+	body, err := s.encode(records)
+	if err != nil {
+		return err
+	}
+	client := s.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var lastErr error
+	err = wait.ExponentialBackoff(Backoff, func() (bool, error) {
+		resp, err := client.Post(s.url, s.contentType, bytes.NewReader(body))
+		if err != nil {
+			lastErr = err
+			return false, nil
+		}
+		defer resp.Body.Close()
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		if resp.StatusCode/100 == 2 {
+			return true, nil
+		}
+		lastErr = fmt.Errorf("POST %s failed: %s: %s", s.url, resp.Status, bytes.TrimSpace(respBody))
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusRequestTimeout {
+			return false, lastErr
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("%v, after %d attempts", lastErr, Backoff.Steps)
+	}
+	return err
+}
+
+func (s *httpSink) Close() error {
+	return nil
+}
+
+// The OTLP/HTTP JSON encoding of logs, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+type otlpLogs struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano string          `json:"timeUnixNano"`
+	Body         otlpValue       `json:"body"`
+	Attributes   []otlpAttribute `json:"attributes"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// encodeOTLPLogs makes a log record of each record, whose body is the data of the record and type
+// the bpftrace.type attribute. The labels of the records are the attributes of the resource.
+func encodeOTLPLogs(records []Record) ([]byte, error) {
+	resources := map[string]*otlpResourceLogs{}
+	order := []string{}
+	for _, r := range records {
+		key := labelsKey(r.Labels)
+		rl, ok := resources[key]
+		if !ok {
+			attributes := []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: "kubectl-trace"}}}
+			for _, k := range sortedKeys(r.Labels) {
+				attributes = append(attributes, otlpAttribute{Key: k, Value: otlpValue{StringValue: r.Labels[k]}})
+			}
+			rl = &otlpResourceLogs{
+				Resource:  otlpResource{Attributes: attributes},
+				ScopeLogs: []otlpScopeLogs{{Scope: otlpScope{Name: "kubectl-trace"}, LogRecords: []otlpLogRecord{}}},
+			}
+			resources[key] = rl
+			order = append(order, key)
+		}
+		rl.ScopeLogs[0].LogRecords = append(rl.ScopeLogs[0].LogRecords, otlpLogRecord{
+			TimeUnixNano: strconv.FormatInt(r.Time.UnixNano(), 10),
+			Body:         otlpValue{StringValue: string(r.Data)},
+			Attributes:   []otlpAttribute{{Key: "bpftrace.type", Value: otlpValue{StringValue: r.Type}}},
+		})
+	}
+
+	logs := otlpLogs{ResourceLogs: []otlpResourceLogs{}}
+	for _, key := range order {
+		logs.ResourceLogs = append(logs.ResourceLogs, *resources[key])
+	}
+	return json.Marshal(logs)
+}
+
+// encodeKafkaRecords encodes records for the v2 API of the Kafka REST proxy, each record being the value of a message.
+func encodeKafkaRecords(records []Record) ([]byte, error) {
+	type message struct {
+		Value Record `json:"value"`
+	}
+	messages := struct {
+		Records []message `json:"records"`
+	}{}
+	for _, r := range records {
+		messages.Records = append(messages.Records, message{Value: r})
+	}
+	return json.Marshal(messages)
+}
+
+func labelsKey(labels map[string]string) string {
+	var b strings.Builder
+	for _, k := range sortedKeys(labels) {
+		fmt.Fprintf(&b, "%s=%s,", k, labels[k])
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
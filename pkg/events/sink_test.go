@@ -0,0 +1,154 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// fakeCollector records the bodies it receives, failing the first requests with failStatus.
+type fakeCollector struct {
+	mu         sync.Mutex
+	failures   int
+	failStatus int
+	requests   int
+	paths      []string
+	types      []string
+	bodies     []string
+}
+
+func (f *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+	if f.requests <= f.failures {
+		w.WriteHeader(f.failStatus)
+		fmt.Fprint(w, "unavailable")
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	f.paths = append(f.paths, r.URL.Path)
+	f.types = append(f.types, r.Header.Get("Content-Type"))
+	f.bodies = append(f.bodies, string(body))
+}
+
+func withFastBackoff(t *testing.T) {
+	backoff := Backoff
+	Backoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+	t.Cleanup(func() { Backoff = backoff })
+}
+
+var testRecords = []Record{
+	{
+		Time:   time.Unix(1760000000, 5).UTC(),
+		Type:   "printf",
+		Data:   json.RawMessage(`"hello"`),
+		Labels: map[string]string{"pod_uid": "1234"},
+	},
+	{
+		Time:   time.Unix(1760000001, 0).UTC(),
+		Type:   "map",
+		Data:   json.RawMessage(`{"@":1}`),
+		Labels: map[string]string{"pod_uid": "1234"},
+	},
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events", "trace.jsonl")
+
+	sink, err := NewSink("file://" + filepath.ToSlash(path))
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(testRecords[:1]))
+	require.NoError(t, sink.Send(testRecords[1:]))
+	require.NoError(t, sink.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `{"time":"2025-10-09T08:53:20.000000005Z","type":"printf","data":"hello","labels":{"pod_uid":"1234"}}
+{"time":"2025-10-09T08:53:21Z","type":"map","data":{"@":1},"labels":{"pod_uid":"1234"}}
+`, string(data))
+}
+
+func TestOTLPSink(t *testing.T) {
+	withFastBackoff(t)
+	fake := &fakeCollector{failures: 1, failStatus: http.StatusServiceUnavailable}
+	s := httptest.NewServer(fake)
+	defer s.Close()
+
+	sink, err := NewSink("otlp+" + s.URL)
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(testRecords))
+
+	assert.Equal(t, 2, fake.requests)
+	assert.Equal(t, []string{"/v1/logs"}, fake.paths)
+	assert.Equal(t, []string{"application/json"}, fake.types)
+	assert.JSONEq(t, `{"resourceLogs": [{
+		"resource": {"attributes": [
+			{"key": "service.name", "value": {"stringValue": "kubectl-trace"}},
+			{"key": "pod_uid", "value": {"stringValue": "1234"}}
+		]},
+		"scopeLogs": [{
+			"scope": {"name": "kubectl-trace"},
+			"logRecords": [
+				{"timeUnixNano": "1760000000000000005", "body": {"stringValue": "\"hello\""}, "attributes": [{"key": "bpftrace.type", "value": {"stringValue": "printf"}}]},
+				{"timeUnixNano": "1760000001000000000", "body": {"stringValue": "{\"@\":1}"}, "attributes": [{"key": "bpftrace.type", "value": {"stringValue": "map"}}]}
+			]
+		}]
+	}]}`, fake.bodies[0])
+}
+
+func TestKafkaSink(t *testing.T) {
+	fake := &fakeCollector{}
+	s := httptest.NewServer(fake)
+	defer s.Close()
+
+	sink, err := NewSink("kafka+" + s.URL + "/topics/traces")
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(testRecords[:1]))
+
+	assert.Equal(t, []string{"/topics/traces"}, fake.paths)
+	assert.Equal(t, []string{"application/vnd.kafka.json.v2+json"}, fake.types)
+	assert.JSONEq(t, `{"records": [{"value": {"time": "2025-10-09T08:53:20.000000005Z", "type": "printf", "data": "hello", "labels": {"pod_uid": "1234"}}}]}`, fake.bodies[0])
+}
+
+func TestSinkErrors(t *testing.T) {
+	withFastBackoff(t)
+	fake := &fakeCollector{failures: 10, failStatus: http.StatusBadRequest}
+	s := httptest.NewServer(fake)
+	defer s.Close()
+
+	sink, err := NewSink("otlp+" + s.URL + "/logs")
+	require.NoError(t, err)
+	err = sink.Send(testRecords)
+	assert.EqualError(t, err, fmt.Sprintf("POST %s/logs failed: 400 Bad Request: unavailable", s.URL))
+	assert.Equal(t, 1, fake.requests)
+
+	fake.requests, fake.failStatus = 0, http.StatusBadGateway
+	err = sink.Send(testRecords)
+	assert.EqualError(t, err, fmt.Sprintf("POST %s/logs failed: 502 Bad Gateway: unavailable, after 3 attempts", s.URL))
+	assert.Equal(t, 3, fake.requests)
+
+	tests := map[string]string{
+		"syslog://localhost":           "unknown events sink syslog://localhost, must be stdout or a file://, otlp+http://, otlp+https://, kafka+http:// or kafka+https:// URL",
+		"file://events.jsonl":          "invalid events sink file://events.jsonl, file sinks must have an absolute path, eg file:///data/events.jsonl",
+		"kafka+http://rest-proxy:8082": "invalid events sink kafka+http://rest-proxy:8082, kafka sinks must be the URL of a topic of a REST proxy, eg kafka+http://rest-proxy:8082/topics/traces",
+	}
+	for target, expected := range tests {
+		_, err := NewSink(target)
+		assert.EqualError(t, err, expected, target)
+		assert.EqualError(t, ValidateSink(target), expected, target)
+	}
+	assert.NoError(t, ValidateSink(DefaultSink))
+	assert.NoError(t, ValidateSink("otlp+https://collector:4318"))
+}
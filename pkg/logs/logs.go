@@ -13,6 +13,7 @@ import (
 
 	"fmt"
 	"io"
+	"sync"
 
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 )
@@ -48,7 +49,42 @@ func (l *Logs) Run(jobID types.UID, namespace string, follow bool, timestamps bo
 		return fmt.Errorf(podNotFoundError)
 	}
 
-	pod := &pl.Items[0]
+	return l.podLogs(&pl.Items[0], follow, timestamps, l.IOStreams.Out)
+}
+
+// RunGroup prints the logs of every trace in a group, prefixing each line with the name of its pod.
+func (l *Logs) RunGroup(groupID types.UID, namespace string, follow bool, timestamps bool) error {
+	pl, err := l.coreV1Client.Pods(namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", meta.TraceGroupLabelKey, groupID),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if len(pl.Items) == 0 {
+		return fmt.Errorf(podNotFoundError)
+	}
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	for i := range pl.Items {
+		wg.Add(1)
+		go func(pod *corev1.Pod) {
+			defer wg.Done()
+			out := NewPrefixWriter(l.IOStreams.Out, fmt.Sprintf("[%s] ", pod.Name), &lock)
+			if err := l.podLogs(pod, follow, timestamps, out); err != nil {
+				fmt.Fprintf(l.IOStreams.ErrOut, "[%s] %s\n", pod.Name, err.Error())
+			}
+			out.Flush()
+		}(&pl.Items[i])
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (l *Logs) podLogs(pod *corev1.Pod, follow bool, timestamps bool, out io.Writer) error {
 	if pod.Status.Phase == corev1.PodFailed {
 		return fmt.Errorf(podPhaseNotAcceptedError, pod.Status.Phase)
 	}
@@ -66,9 +102,9 @@ func (l *Logs) Run(jobID types.UID, namespace string, follow bool, timestamps bo
 		Timestamps: timestamps,
 	}
 
-	logsRequest := l.coreV1Client.Pods(namespace).GetLogs(pod.Name, logOptions)
+	logsRequest := l.coreV1Client.Pods(pod.Namespace).GetLogs(pod.Name, logOptions)
 
-	return consumeRequest(logsRequest, l.IOStreams.Out)
+	return consumeRequest(logsRequest, out)
 }
 
 func consumeRequest(request *rest.Request, out io.Writer) error {
@@ -0,0 +1,63 @@
+package logs
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// PrefixWriter prefixes every line written to it before passing it on to the underlying writer.
+// Writers sharing the same lock can be used concurrently without interleaving their lines.
+type PrefixWriter struct {
+	out    io.Writer
+	prefix []byte
+	lock   *sync.Mutex
+	buf    bytes.Buffer
+}
+
+// NewPrefixWriter constructs a PrefixWriter writing to out.
+func NewPrefixWriter(out io.Writer, prefix string, lock *sync.Mutex) *PrefixWriter {
+	return &PrefixWriter{
+		out:    out,
+		prefix: []byte(prefix),
+		lock:   lock,
+	}
+}
+
+// Write buffers p and writes out every complete line it holds.
+func (w *PrefixWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		if err := w.writeLine(w.buf.Next(i + 1)); err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush writes out any trailing line that was not terminated by a newline.
+func (w *PrefixWriter) Flush() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	line := append([]byte{}, w.buf.Next(w.buf.Len())...)
+	line = append(line, '\n')
+	return w.writeLine(line)
+}
+
+func (w *PrefixWriter) writeLine(line []byte) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if _, err := w.out.Write(w.prefix); err != nil {
+		return err
+	}
+	_, err := w.out.Write(line)
+	return err
+}
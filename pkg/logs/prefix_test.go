@@ -0,0 +1,24 @@
+package logs
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := NewPrefixWriter(b, "[pod-a] ", &sync.Mutex{})
+
+	_, err := w.Write([]byte("first line\nsecond "))
+	assert.Nil(t, err)
+	assert.Equal(t, "[pod-a] first line\n", b.String())
+
+	_, err = w.Write([]byte("line\nunterminated"))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Flush())
+
+	assert.Equal(t, "[pod-a] first line\n[pod-a] second line\n[pod-a] unterminated\n", b.String())
+}
@@ -7,6 +7,12 @@ const (
 	TraceIDLabelKey = "iovisor.org/kubectl-trace-id"
 	// TraceLabelKey is a meta to annotate objects created by this tool
 	TraceLabelKey = "iovisor.org/kubectl-trace"
+	// TraceGroupLabelKey is a meta to group the objects created by this tool for a single run
+	TraceGroupLabelKey = "iovisor.org/kubectl-trace-group"
+	// TraceSpecAnnotationKey annotates the objects created by this tool with the spec of the trace, as JSON
+	TraceSpecAnnotationKey = "iovisor.org/kubectl-trace-spec"
+	// ScriptLibraryLabelKey labels the config maps holding a library of scripts, one per key
+	ScriptLibraryLabelKey = "iovisor.org/kubectl-trace-scripts"
 
 	// ObjectNamePrefix is the prefix used for objects created by kubectl-trace
 	ObjectNamePrefix = "kubectl-trace-"
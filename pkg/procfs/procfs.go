@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 
 	"github.com/fntlnz/mountinfo"
@@ -15,6 +16,55 @@ import (
 var ProcFs = afero.NewOsFs()
 
 func FindPidByPodContainer(podUID, containerID string) (string, error) {
+	pid, err := findPidByMountRoot(func(root string) bool {
+		// See https://github.com/kubernetes/kubernetes/blob/2f3a4ec9cb96e8e2414834991d63c59988c3c866/pkg/kubelet/cm/cgroup_manager_linux.go#L81-L85
+		// Note that these identifiers are currently specific to systemd, however, this mounting approach is what allows us to find the containerized
+		// process.
+		//
+		// EG: /kubelet.slice/kubelet-kubepods.slice/kubelet-kubepods-besteffort.slice/kubelet-kubepods-besteffort-pod18640755_cc12_4557_b96e_0f74d5b44d1d.slice/cri-containerd-66221e7d988e193822a3e8368b61ad9aeabf6b5276df76daebb7ea33bccc0b87.scope
+		//     /kubelet.slice/kubelet-kubepods.slice/kubelet-kubepods-besteffort.slice/kubelet-kubepods-besteffort-pod{POD_ID/-/_/}.slice/cri-containerd-{CONTAINER_ID}.scope
+		//
+		podNeedle := strings.ReplaceAll(podUID, "-", "_")
+		if strings.Contains(root, podNeedle) && strings.Contains(root, containerID) {
+			return true
+		}
+		// Here we also support a pre cgroup v2 format
+		//     /kubepods/burstable/pod31dd0274-bb43-4975-bdbc-7e10047a23f8/851c75dad6ad8ce6a5d9b9129a4eb1645f7c6e5ba8406b12d50377b665737072
+		//     /kubepods/burstable/pod{POD_ID}/{CONTAINER_ID}
+		//
+		// This "needle" that we look for in the mountinfo haystack should match one and only one container.
+		needle := path.Join(podUID, containerID)
+		return strings.Contains(root, needle)
+	})
+	if err != nil {
+		return "", err
+	}
+	if pid == "" {
+		return "", fmt.Errorf("no process found for specified pod and container")
+	}
+	return pid, nil
+}
+
+// FindPidByPodContainerName finds a process of a container of a pod by the name of the container, which
+// unlike its ID stays the same when the container restarts, and is known before it starts.
+func FindPidByPodContainerName(podUID, containerName string) (string, error) {
+	// The kubelet mounts the termination log of each container from a directory of the container,
+	//     {KUBELET_ROOT}/pods/{POD_ID}/containers/{CONTAINER_NAME}/{ID} on /dev/termination-log
+	needle := "/" + path.Join("pods", podUID, "containers", containerName) + "/"
+	pid, err := findPidByMountRoot(func(root string) bool {
+		return strings.Contains(root, needle)
+	})
+	if err != nil {
+		return "", err
+	}
+	if pid == "" {
+		return "", fmt.Errorf("no process found for container %s of pod %s", containerName, podUID)
+	}
+	return pid, nil
+}
+
+// findPidByMountRoot returns the first process with a mount whose root matches, or an empty pid if there is none.
+func findPidByMountRoot(matches func(root string) bool) (string, error) {
 	d, err := ProcFs.Open("/proc")
 
 	if err != nil {
@@ -47,32 +97,14 @@ func FindPidByPodContainer(podUID, containerID string) (string, error) {
 			}
 
 			for _, m := range mi {
-				root := m.Root
-				// See https://github.com/kubernetes/kubernetes/blob/2f3a4ec9cb96e8e2414834991d63c59988c3c866/pkg/kubelet/cm/cgroup_manager_linux.go#L81-L85
-				// Note that these identifiers are currently specific to systemd, however, this mounting approach is what allows us to find the containerized
-				// process.
-				//
-				// EG: /kubelet.slice/kubelet-kubepods.slice/kubelet-kubepods-besteffort.slice/kubelet-kubepods-besteffort-pod18640755_cc12_4557_b96e_0f74d5b44d1d.slice/cri-containerd-66221e7d988e193822a3e8368b61ad9aeabf6b5276df76daebb7ea33bccc0b87.scope
-				//     /kubelet.slice/kubelet-kubepods.slice/kubelet-kubepods-besteffort.slice/kubelet-kubepods-besteffort-pod{POD_ID/-/_/}.slice/cri-containerd-{CONTAINER_ID}.scope
-				//
-				podNeedle := strings.ReplaceAll(podUID, "-", "_")
-				if strings.Contains(root, podNeedle) && strings.Contains(root, containerID) {
-					return dname, nil
-				}
-				// Here we also support a pre cgroup v2 format
-				//     /kubepods/burstable/pod31dd0274-bb43-4975-bdbc-7e10047a23f8/851c75dad6ad8ce6a5d9b9129a4eb1645f7c6e5ba8406b12d50377b665737072
-				//     /kubepods/burstable/pod{POD_ID}/{CONTAINER_ID}
-				//
-				// This "needle" that we look for in the mountinfo haystack should match one and only one container.
-				needle := path.Join(podUID, containerID)
-				if strings.Contains(root, needle) {
+				if matches(m.Root) {
 					return dname, nil
 				}
 			}
 		}
 	}
 
-	return "", fmt.Errorf("no process found for specified pod and container")
+	return "", nil
 }
 
 func FindPidsForContainer(pid string) ([]string, error) {
@@ -173,6 +205,165 @@ func GetProcCmdline(pid string) (string, error) {
 	return string(cmdline), nil
 }
 
+// GetProcPpid returns the pid of the parent of pid, in the pid namespace of the reader.
+func GetProcPpid(pid string) (string, error) {
+	return getStatusField(pid, "PPid")
+}
+
+// GetProcUid returns the real uid of pid.
+func GetProcUid(pid string) (string, error) {
+	uid, err := getStatusField(pid, "Uid")
+	if err != nil {
+		return "", err
+	}
+	return strings.Fields(uid)[0], nil
+}
+
+// GetProcUser returns the name of the real user of pid, as found in the /etc/passwd of its root
+// filesystem, or an empty string when the user has no name.
+func GetProcUser(pid string) (string, error) {
+	uid, err := GetProcUid(pid)
+	if err != nil {
+		return "", err
+	}
+
+	passwd, err := ProcFs.Open(path.Join("/proc", pid, "root", "etc", "passwd"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer passwd.Close()
+
+	scanner := bufio.NewScanner(passwd)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) > 2 && fields[2] == uid {
+			return fields[0], nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// GetProcEnviron returns the environment of pid, as KEY=VALUE entries.
+func GetProcEnviron(pid string) ([]string, error) {
+	environ, err := afero.ReadFile(ProcFs, path.Join("/proc", pid, "environ"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []string{}
+	for _, e := range strings.Split(string(environ), "\x00") {
+		if e != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// GetProcCgroup returns the cgroups of pid, as found in /proc/<pid>/cgroup.
+func GetProcCgroup(pid string) (string, error) {
+	cgroup, err := afero.ReadFile(ProcFs, path.Join("/proc", pid, "cgroup"))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(cgroup)), nil
+}
+
+// GetProcListeningPorts returns the TCP ports pid listens on, that is the ports of the listening sockets
+// of its network namespace which are among its open files.
+func GetProcListeningPorts(pid string) ([]string, error) {
+	listening := map[string]string{}
+	for _, table := range []string{"tcp", "tcp6"} {
+		if err := readListeningSockets(path.Join("/proc", pid, "net", table), listening); err != nil {
+			return nil, err
+		}
+	}
+
+	fdDir := path.Join("/proc", pid, "fd")
+	d, err := ProcFs.Open(fdDir)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	fds, err := d.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	ports := []string{}
+	seen := map[string]bool{}
+	for _, fd := range fds {
+		link, err := readlink(path.Join(fdDir, fd))
+		if err != nil {
+			// The file may have been closed since the directory was read.
+			continue
+		}
+		name := path.Base(link)
+		if !strings.HasPrefix(name, "socket:[") {
+			continue
+		}
+		inode := strings.TrimSuffix(strings.TrimPrefix(name, "socket:["), "]")
+		if port, ok := listening[inode]; ok && !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+// readListeningSockets adds the ports of the listening sockets of a /proc/net/tcp table to listening, by inode.
+func readListeningSockets(table string, listening map[string]string) error {
+	f, err := ProcFs.Open(table)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The columns are: sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListen {
+			continue
+		}
+		local := strings.Split(fields[1], ":")
+		port, err := strconv.ParseUint(local[len(local)-1], 16, 16)
+		if err != nil {
+			continue
+		}
+		listening[fields[9]] = strconv.FormatUint(port, 10)
+	}
+	return scanner.Err()
+}
+
+// tcpListen is the state of listening sockets in /proc/net/tcp.
+const tcpListen = "0A"
+
+func getStatusField(pid, key string) (string, error) {
+	status, err := ProcFs.Open(path.Join("/proc", pid, "status"))
+	if err != nil {
+		return "", err
+	}
+	defer status.Close()
+
+	scanner := bufio.NewScanner(status)
+	for scanner.Scan() {
+		if value := strings.TrimPrefix(scanner.Text(), key+":"); value != scanner.Text() {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no %s in the status of process %s", key, pid)
+}
+
 func getMountInfo(fd string) ([]mountinfo.Mountinfo, error) {
 	file, err := ProcFs.Open(fd)
 	if err != nil {
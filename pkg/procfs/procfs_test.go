@@ -31,6 +31,31 @@ func TestFindPidByPodContainer(t *testing.T) {
 	assert.Equal(t, "1", pid)
 }
 
+func TestFindPidByPodContainerName(t *testing.T) {
+	_ = setupBasePath(t)
+
+	// The container has restarted, its process is the one of a new container ID.
+	assert.Nil(t, ProcFs.MkdirAll("/proc/7", 0755))
+	f, err := ProcFs.Create("/proc/7/mountinfo")
+	if assert.Nil(t, err) {
+		_, err = f.WriteString("1487 1486 0:32 /kubelet.slice/kubelet-kubepods.slice/kubelet-kubepods-besteffort.slice/kubelet-kubepods-besteffort-pod18640755_cc12_4557_b96e_0f74d5b44d1d.slice/cri-containerd-9f3c1d2e.scope /sys/fs/cgroup ro,nosuid,nodev,noexec,relatime - cgroup2 cgroup rw,nsdelegate,memory_recursiveprot\n")
+		assert.Nil(t, err)
+		_, err = f.WriteString("1490 1486 8:1 /var/lib/kubelet/pods/18640755-cc12-4557-b96e-0f74d5b44d1d/containers/worker/5b8e2a1c /dev/termination-log rw,relatime - ext4 /dev/sda1 rw\n")
+		assert.Nil(t, err)
+		assert.Nil(t, f.Close())
+	}
+
+	_, err = FindPidByPodContainer("18640755-cc12-4557-b96e-0f74d5b44d1d", "66221e7d988e193822a3e8368b61ad9aeabf6b5276df76daebb7ea33bccc0b87")
+	assert.EqualError(t, err, "no process found for specified pod and container")
+
+	pid, err := FindPidByPodContainerName("18640755-cc12-4557-b96e-0f74d5b44d1d", "worker")
+	assert.Nil(t, err)
+	assert.Equal(t, "7", pid)
+
+	_, err = FindPidByPodContainerName("18640755-cc12-4557-b96e-0f74d5b44d1d", "work")
+	assert.EqualError(t, err, "no process found for container work of pod 18640755-cc12-4557-b96e-0f74d5b44d1d")
+}
+
 func TestFindPidsForContainerFindsTheContainer(t *testing.T) {
 	_ = setupBasePath(t)
 
@@ -118,6 +143,80 @@ func TestGetProcExe(t *testing.T) {
 	assert.Equal(t, expected, exe)
 }
 
+func TestGetProcStatusFields(t *testing.T) {
+	_ = setupBasePath(t)
+
+	assert.Nil(t, ProcFs.MkdirAll("/proc/42/root/etc", 0755))
+	data := []byte("Name:	unicorn\nPPid:	41\nUid:	1000	1000	1000	1000\n")
+	assert.Nil(t, afero.WriteFile(ProcFs, "/proc/42/status", data, 0444))
+	passwd := []byte("root:x:0:0:root:/root:/bin/sh\napp:x:1000:1000::/app:/bin/sh\n")
+	assert.Nil(t, afero.WriteFile(ProcFs, "/proc/42/root/etc/passwd", passwd, 0444))
+
+	ppid, err := GetProcPpid("42")
+	assert.Nil(t, err)
+	assert.Equal(t, "41", ppid)
+
+	uid, err := GetProcUid("42")
+	assert.Nil(t, err)
+	assert.Equal(t, "1000", uid)
+
+	user, err := GetProcUser("42")
+	assert.Nil(t, err)
+	assert.Equal(t, "app", user)
+}
+
+func TestGetProcEnviron(t *testing.T) {
+	_ = setupBasePath(t)
+
+	assert.Nil(t, ProcFs.MkdirAll("/proc/42", 0755))
+	data := []byte("HOME=/app\x00RAILS_ENV=production\x00")
+	assert.Nil(t, afero.WriteFile(ProcFs, "/proc/42/environ", data, 0444))
+
+	environ, err := GetProcEnviron("42")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"HOME=/app", "RAILS_ENV=production"}, environ)
+}
+
+func TestGetProcCgroup(t *testing.T) {
+	_ = setupBasePath(t)
+
+	assert.Nil(t, ProcFs.MkdirAll("/proc/42", 0755))
+	data := []byte("0::/kubepods/burstable/pod31dd0274/851c75da\n")
+	assert.Nil(t, afero.WriteFile(ProcFs, "/proc/42/cgroup", data, 0444))
+
+	cgroup, err := GetProcCgroup("42")
+	assert.Nil(t, err)
+	assert.Equal(t, "0::/kubepods/burstable/pod31dd0274/851c75da", cgroup)
+}
+
+func TestGetProcListeningPorts(t *testing.T) {
+	_ = setupBasePath(t)
+
+	assert.Nil(t, ProcFs.MkdirAll("/proc/42/net", 0755))
+	assert.Nil(t, ProcFs.MkdirAll("/proc/42/fd", 0755))
+	tcp := []byte(`  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F90 0100007F:D2F0 01 00000000:00000000 00:00000000 00000000  1000        0 1002 1 0000000000000000 20 4 30 10 -1
+   2: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2001 1 0000000000000000 100 0 0 10 0
+`)
+	assert.Nil(t, afero.WriteFile(ProcFs, "/proc/42/net/tcp", tcp, 0444))
+	tcp6 := []byte(`  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:2382 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 1003 1 0000000000000000 100 0 0 10 0
+`)
+	assert.Nil(t, afero.WriteFile(ProcFs, "/proc/42/net/tcp6", tcp6, 0444))
+
+	// The process listens on 8080 and 9090, and has a connection on 8080. Port 22 is another process's.
+	assert.Nil(t, symlink(ProcFs, "socket:[1001]", "/proc/42/fd/3"))
+	assert.Nil(t, symlink(ProcFs, "socket:[1002]", "/proc/42/fd/4"))
+	assert.Nil(t, symlink(ProcFs, "socket:[1003]", "/proc/42/fd/5"))
+	assert.Nil(t, symlink(ProcFs, "/dev/null", "/proc/42/fd/0"))
+
+	ports, err := GetProcListeningPorts("42")
+	assert.Nil(t, err)
+	sort.Strings(ports)
+	assert.Equal(t, []string{"8080", "9090"}, ports)
+}
+
 func setupBasePath(t *testing.T) string {
 	tempDir, err := ioutil.TempDir("", "example")
 	if err != nil {
@@ -0,0 +1,203 @@
+package scripts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1typed "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/homedir"
+)
+
+// Extension is the extension of the scripts, in a directory or in the keys of a config map.
+const Extension = ".bt"
+
+// DefaultDir returns the default local directory of scripts, ~/.kube/kubectl-trace-scripts.
+func DefaultDir() string {
+	return filepath.Join(homedir.HomeDir(), ".kube", "kubectl-trace-scripts")
+}
+
+// Script is a named bpftrace program, whose parameters are Go template actions:
+// {{ param "port" }} for a required parameter, {{ param "port" "443" }} for a parameter with a default value.
+type Script struct {
+	Name string
+	// Source is where the script was found, a file path or a config map as NAMESPACE/NAME.
+	Source  string
+	Program string
+}
+
+// Param is a parameter of a script.
+type Param struct {
+	Name     string
+	Default  string
+	Required bool
+}
+
+// Description returns the leading comment lines of the script.
+func (s Script) Description() string {
+	var lines []string
+	for _, line := range strings.Split(s.Program, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "//") {
+			break
+		}
+		lines = append(lines, strings.TrimSpace(strings.TrimPrefix(line, "//")))
+	}
+	return strings.TrimSpace(strings.Join(lines, " "))
+}
+
+// Params returns the parameters of the script, in order of appearance.
+func (s Script) Params() ([]Param, error) {
+	var params []Param
+	seen := map[string]bool{}
+	funcs := template.FuncMap{
+		"param": func(name string, defaults ...string) string {
+			if !seen[name] {
+				seen[name] = true
+				p := Param{Name: name, Required: len(defaults) == 0}
+				if len(defaults) > 0 {
+					p.Default = defaults[0]
+				}
+				params = append(params, p)
+			}
+			return ""
+		},
+	}
+	if _, err := s.execute(funcs); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// Render returns the program of the script with the values of its parameters.
+// Values for parameters the script does not have are rejected, as they are most likely typos.
+func (s Script) Render(values map[string]string) (string, error) {
+	used := map[string]bool{}
+	funcs := template.FuncMap{
+		"param": func(name string, defaults ...string) (string, error) {
+			used[name] = true
+			if v, ok := values[name]; ok {
+				return v, nil
+			}
+			if len(defaults) > 0 {
+				return defaults[0], nil
+			}
+			return "", fmt.Errorf("parameter %s is required, set it with --set %s=VALUE", name, name)
+		},
+	}
+	program, err := s.execute(funcs)
+	if err != nil {
+		return "", err
+	}
+	for name := range values {
+		if !used[name] {
+			return "", fmt.Errorf("script %s has no parameter %s", s.Name, name)
+		}
+	}
+	return program, nil
+}
+
+func (s Script) execute(funcs template.FuncMap) (string, error) {
+	t, err := template.New(s.Name).Funcs(funcs).Parse(s.Program)
+	if err != nil {
+		return "", fmt.Errorf("could not parse script %s: %v", s.Name, err)
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, nil); err != nil {
+		return "", fmt.Errorf("could not render script %s: %v", s.Name, err)
+	}
+	return out.String(), nil
+}
+
+// ParseValues parses parameter values given as NAME=VALUE.
+func ParseValues(assignments []string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, a := range assignments {
+		parts := strings.SplitN(a, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid parameter %q, must be NAME=VALUE", a)
+		}
+		values[parts[0]] = parts[1]
+	}
+	return values, nil
+}
+
+// Library finds scripts in a local directory and in the config maps labelled with meta.ScriptLibraryLabelKey.
+// The scripts of the directory take precedence over the ones of the config maps.
+type Library struct {
+	// Dir is the local directory of scripts, ignored when empty or missing.
+	Dir string
+	// ConfigMaps is where the config maps of scripts are looked for, ignored when nil.
+	ConfigMaps corev1typed.ConfigMapInterface
+}
+
+// List returns the scripts of the library, sorted by name.
+func (l *Library) List() ([]Script, error) {
+	byName := map[string]Script{}
+
+	if l.ConfigMaps != nil {
+		cml, err := l.ConfigMaps.List(context.Background(), metav1.ListOptions{
+			LabelSelector: meta.ScriptLibraryLabelKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, cm := range cml.Items {
+			for key, program := range cm.Data {
+				if !strings.HasSuffix(key, Extension) {
+					continue
+				}
+				name := strings.TrimSuffix(key, Extension)
+				byName[name] = Script{Name: name, Source: cm.Namespace + "/" + cm.Name, Program: program}
+			}
+		}
+	}
+
+	if l.Dir != "" {
+		files, err := ioutil.ReadDir(l.Dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), Extension) {
+				continue
+			}
+			path := filepath.Join(l.Dir, f.Name())
+			program, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			name := strings.TrimSuffix(f.Name(), Extension)
+			byName[name] = Script{Name: name, Source: path, Program: string(program)}
+		}
+	}
+
+	scripts := make([]Script, 0, len(byName))
+	for _, s := range byName {
+		scripts = append(scripts, s)
+	}
+	sort.Slice(scripts, func(i, j int) bool { return scripts[i].Name < scripts[j].Name })
+	return scripts, nil
+}
+
+// Get returns the script called name.
+func (l *Library) Get(name string) (*Script, error) {
+	scripts, err := l.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range scripts {
+		if scripts[i].Name == name {
+			return &scripts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("script %s not found", name)
+}
@@ -0,0 +1,115 @@
+package scripts
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const tcpRetransmits = `// Counts the TCP retransmits to a port,
+// by remote address.
+kprobe:tcp_retransmit_skb
+/((struct sock *)arg0)->__sk_common.skc_dport == {{ param "port" }}/
+{
+	@[ntop(((struct sock *)arg0)->__sk_common.skc_daddr)] = count();
+}
+interval:s:{{ param "interval" "10" }} { print(@); clear(@); }
+`
+
+func TestScriptDescription(t *testing.T) {
+	s := Script{Name: "tcp-retransmits", Program: tcpRetransmits}
+	assert.Equal(t, "Counts the TCP retransmits to a port, by remote address.", s.Description())
+	assert.Empty(t, Script{Program: "kprobe:do_sys_open { }"}.Description())
+}
+
+func TestScriptParams(t *testing.T) {
+	params, err := Script{Name: "tcp-retransmits", Program: tcpRetransmits}.Params()
+	require.NoError(t, err)
+	assert.Equal(t, []Param{
+		{Name: "port", Required: true},
+		{Name: "interval", Default: "10"},
+	}, params)
+}
+
+func TestScriptRender(t *testing.T) {
+	s := Script{Name: "tcp-retransmits", Program: tcpRetransmits}
+
+	program, err := s.Render(map[string]string{"port": "443"})
+	require.NoError(t, err)
+	assert.Contains(t, program, "skc_dport == 443/\n")
+	assert.Contains(t, program, "interval:s:10 {")
+
+	program, err = s.Render(map[string]string{"port": "443", "interval": "1"})
+	require.NoError(t, err)
+	assert.Contains(t, program, "interval:s:1 {")
+
+	_, err = s.Render(map[string]string{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "parameter port is required, set it with --set port=VALUE")
+
+	_, err = s.Render(map[string]string{"port": "443", "prot": "tcp"})
+	assert.EqualError(t, err, "script tcp-retransmits has no parameter prot")
+}
+
+func TestParseValues(t *testing.T) {
+	values, err := ParseValues([]string{"port=443", "filter=a=b"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"port": "443", "filter": "a=b"}, values)
+
+	_, err = ParseValues([]string{"port"})
+	assert.EqualError(t, err, `invalid parameter "port", must be NAME=VALUE`)
+}
+
+func TestLibrary(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "tcp-retransmits.bt"), []byte(tcpRetransmits), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("not a script"), 0644))
+
+	clientset := fake.NewSimpleClientset()
+	for _, cm := range []*corev1.ConfigMap{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-scripts", Namespace: "default", Labels: map[string]string{meta.ScriptLibraryLabelKey: "true"}},
+			Data: map[string]string{
+				"tcp-retransmits.bt": "// Shadowed by the local script.\n",
+				"opensnoop.bt":       "// Files opened.\ntracepoint:syscalls:sys_enter_openat { printf(\"%s\\n\", str(args->filename)); }\n",
+				"notes.txt":          "not a script",
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "unlabelled", Namespace: "default"},
+			Data:       map[string]string{"hidden.bt": "kprobe:do_sys_open { }"},
+		},
+	} {
+		_, err := clientset.CoreV1().ConfigMaps("default").Create(context.Background(), cm, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	lib := &Library{Dir: dir, ConfigMaps: clientset.CoreV1().ConfigMaps("default")}
+	scripts, err := lib.List()
+	require.NoError(t, err)
+	require.Len(t, scripts, 2)
+	assert.Equal(t, "opensnoop", scripts[0].Name)
+	assert.Equal(t, "default/team-scripts", scripts[0].Source)
+	assert.Equal(t, "tcp-retransmits", scripts[1].Name)
+	assert.Equal(t, filepath.Join(dir, "tcp-retransmits.bt"), scripts[1].Source)
+
+	s, err := lib.Get("opensnoop")
+	require.NoError(t, err)
+	assert.Equal(t, "Files opened.", s.Description())
+
+	_, err = lib.Get("hidden")
+	assert.EqualError(t, err, "script hidden not found")
+
+	// A missing directory is an empty one.
+	scripts, err = (&Library{Dir: filepath.Join(dir, "missing")}).List()
+	require.NoError(t, err)
+	assert.Empty(t, scripts)
+}
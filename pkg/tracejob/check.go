@@ -0,0 +1,196 @@
+package tracejob
+
+import (
+	"fmt"
+	"strings"
+)
+
+// probeTypes are the probe types of bpftrace, with their aliases.
+var probeTypes = map[string]bool{
+	"BEGIN": true, "END": true, "self": true,
+	"kprobe": true, "k": true, "kretprobe": true, "kr": true,
+	"uprobe": true, "u": true, "uretprobe": true, "ur": true,
+	"usdt": true, "U": true,
+	"tracepoint": true, "t": true, "rawtracepoint": true, "rt": true,
+	"profile": true, "p": true, "interval": true, "i": true,
+	"software": true, "s": true, "hardware": true, "h": true,
+	"watchpoint": true, "w": true, "asyncwatchpoint": true, "aw": true,
+	"kfunc": true, "f": true, "kretfunc": true, "fr": true,
+	"fentry": true, "fexit": true, "iter": true, "it": true,
+}
+
+// topLevelDeclarations start the top level blocks which are not probes.
+var topLevelDeclarations = []string{"struct", "union", "enum", "typedef", "config", "macro", "fn", "import"}
+
+// ProgramCheckError is a syntax error found in a bpftrace program before running it.
+type ProgramCheckError struct {
+	Line    int
+	Message string
+}
+
+func (e *ProgramCheckError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// CheckProgram does a quick syntactic check of a bpftrace program: its braces, parentheses and brackets
+// are balanced, its probes have known types, and it only uses $container_pid when tracing a pod.
+// This is not a parser, programs passing the check may still be rejected by bpftrace.
+func CheckProgram(program string, podTarget bool) error {
+	code, err := stripCommentsAndStrings(program)
+	if err != nil {
+		return err
+	}
+
+	if !podTarget {
+		if i := strings.Index(code, "$container_pid"); i >= 0 {
+			return &ProgramCheckError{Line: lineOf(code, i), Message: "$container_pid can only be used when tracing a pod"}
+		}
+	}
+
+	closing := map[byte]byte{'}': '{', ')': '(', ']': '['}
+	type open struct {
+		char byte
+		pos  int
+	}
+	var stack []open
+	headerStart := 0
+
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch c {
+		case '{', '(', '[':
+			if c == '{' && len(stack) == 0 {
+				if err := checkHeader(code, headerStart, i); err != nil {
+					return err
+				}
+			}
+			stack = append(stack, open{char: c, pos: i})
+		case '}', ')', ']':
+			if len(stack) == 0 || stack[len(stack)-1].char != closing[c] {
+				return &ProgramCheckError{Line: lineOf(code, i), Message: fmt.Sprintf("unexpected %c", c)}
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 && c == '}' {
+				headerStart = i + 1
+			}
+		case '#':
+			// Preprocessor directives stand on their own line, at the top level.
+			if len(stack) == 0 && strings.TrimSpace(code[headerStart:i]) == "" {
+				end := strings.IndexByte(code[i:], '\n')
+				if end < 0 {
+					end = len(code) - i
+				}
+				i += end
+				headerStart = i
+			}
+		case ';':
+			// Declarations at the top level such as typedefs end with a semicolon after their block.
+			if len(stack) == 0 && strings.TrimSpace(code[headerStart:i]) == "" {
+				headerStart = i + 1
+			}
+		}
+	}
+
+	if len(stack) > 0 {
+		o := stack[len(stack)-1]
+		return &ProgramCheckError{Line: lineOf(code, o.pos), Message: fmt.Sprintf("unclosed %c", o.char)}
+	}
+	if rest := strings.TrimSpace(code[headerStart:]); rest != "" {
+		return &ProgramCheckError{Line: lineOf(code, headerStart+strings.Index(code[headerStart:], rest)), Message: fmt.Sprintf("probe %s has no action block", firstWord(rest))}
+	}
+	return nil
+}
+
+// checkHeader checks the probes in code[start:end], that is before an action block.
+func checkHeader(code string, start, end int) error {
+	header := strings.TrimSpace(code[start:end])
+	line := lineOf(code, start+strings.Index(code[start:end], header))
+	if header == "" {
+		return &ProgramCheckError{Line: lineOf(code, end), Message: "action block without probe"}
+	}
+	for _, d := range topLevelDeclarations {
+		if firstWord(header) == d {
+			return nil
+		}
+	}
+
+	// The predicate is the text between slashes after the probes, the paths of uprobes follow a colon.
+	for i := 0; i < len(header); i++ {
+		if header[i] == '/' && (i == 0 || header[i-1] == ' ' || header[i-1] == '\t' || header[i-1] == '\n') {
+			header = strings.TrimSpace(header[:i])
+			break
+		}
+	}
+
+	for _, probe := range strings.Split(header, ",") {
+		probe = strings.TrimSpace(probe)
+		if probe == "" {
+			return &ProgramCheckError{Line: line, Message: "empty probe"}
+		}
+		probeType := probe
+		if i := strings.IndexAny(probe, ":/"); i >= 0 {
+			probeType = probe[:i]
+		}
+		if !probeTypes[probeType] {
+			return &ProgramCheckError{Line: line, Message: fmt.Sprintf("unknown probe type %s in %s", probeType, probe)}
+		}
+	}
+	return nil
+}
+
+// stripCommentsAndStrings blanks the comments and the content of the string and character literals
+// of program, keeping its line breaks so that positions map to the same lines.
+func stripCommentsAndStrings(program string) (string, error) {
+	b := []byte(program)
+	blank := func(from, to int) {
+		for i := from; i < to && i < len(b); i++ {
+			if b[i] != '\n' {
+				b[i] = ' '
+			}
+		}
+	}
+
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == '/' && i+1 < len(b) && b[i+1] == '/':
+			end := strings.IndexByte(program[i:], '\n')
+			if end < 0 {
+				end = len(b) - i
+			}
+			blank(i, i+end)
+			i += end
+		case b[i] == '/' && i+1 < len(b) && b[i+1] == '*':
+			end := strings.Index(program[i+2:], "*/")
+			if end < 0 {
+				return "", &ProgramCheckError{Line: lineOf(program, i), Message: "unterminated comment"}
+			}
+			blank(i, i+2+end+2)
+			i += 2 + end + 1
+		case b[i] == '"' || b[i] == '\'':
+			quote := b[i]
+			j := i + 1
+			for ; j < len(b) && b[j] != quote && b[j] != '\n'; j++ {
+				if b[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(b) || b[j] != quote {
+				return "", &ProgramCheckError{Line: lineOf(program, i), Message: "unterminated string"}
+			}
+			blank(i+1, j)
+			i = j
+		}
+	}
+	return string(b), nil
+}
+
+func lineOf(s string, pos int) int {
+	return strings.Count(s[:pos], "\n") + 1
+}
+
+func firstWord(s string) string {
+	if fields := strings.Fields(s); len(fields) > 0 {
+		return fields[0]
+	}
+	return s
+}
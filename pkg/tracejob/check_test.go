@@ -0,0 +1,85 @@
+package tracejob
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckProgram(t *testing.T) {
+	tests := []struct {
+		name          string
+		program       string
+		podTarget     bool
+		expectedError string
+	}{
+		{
+			name:    "one liner",
+			program: `tracepoint:syscalls:sys_enter_* { @[probe] = count(); }`,
+		},
+		{
+			name: "program with predicates, comments, strings and a header",
+			program: `#include <linux/sched.h>
+// Count the opens of a command
+BEGIN { printf("tracing open() { ... }\n"); }
+kprobe:do_sys_open, kretprobe:do_sys_open /comm == "nginx"/ {
+	@opens[str(arg1)] = count(); /* a } in a comment */
+}
+uprobe:/bin/bash:readline { @[pid] = count(); }
+struct data { int x; };
+interval:s:5 { print(@opens); clear(@opens); }
+END { clear(@opens); }`,
+		},
+		{
+			name:      "container pid on a pod",
+			program:   `uprobe:/proc/$container_pid/exe:main { @ = count(); }`,
+			podTarget: true,
+		},
+		{
+			name:          "container pid on a node",
+			program:       "BEGIN {}\nuprobe:/proc/$container_pid/exe:main { @ = count(); }",
+			expectedError: "line 2: $container_pid can only be used when tracing a pod",
+		},
+		{
+			name:          "unclosed brace",
+			program:       "BEGIN {\n  printf(\"hi\");\n",
+			expectedError: "line 1: unclosed {",
+		},
+		{
+			name:          "unexpected brace",
+			program:       "BEGIN { exit(); }\n}",
+			expectedError: "line 2: unexpected }",
+		},
+		{
+			name:          "mismatched parenthesis",
+			program:       "BEGIN { printf(\"hi\"; }",
+			expectedError: "line 1: unexpected }",
+		},
+		{
+			name:          "unknown probe type",
+			program:       "BEGIN {}\n\ntracepiont:syscalls:sys_enter_open { @ = count(); }",
+			expectedError: "line 3: unknown probe type tracepiont in tracepiont:syscalls:sys_enter_open",
+		},
+		{
+			name:          "probe without action",
+			program:       "kprobe:do_sys_open",
+			expectedError: "line 1: probe kprobe:do_sys_open has no action block",
+		},
+		{
+			name:          "unterminated string",
+			program:       "BEGIN { printf(\"hi); }",
+			expectedError: "line 1: unterminated string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckProgram(tt.program, tt.podTarget)
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package tracejob
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultDryRunTimeout is the time given to a dry run to schedule, pull its image and check the program.
+const DefaultDryRunTimeout = 2 * time.Minute
+
+// dryRunPollInterval is how often the job of a dry run is checked for completion.
+var dryRunPollInterval = 2 * time.Second
+
+// DryRun runs the program of nj with bpftrace --dry-run in a short-lived trace job on the target of nj,
+// so that the errors of bpftrace are known before creating the real trace. It returns the output of
+// bpftrace, and an error holding it when bpftrace rejected the program. The dry run job is deleted once done.
+func DryRun(clientset kubernetes.Interface, nj TraceJob, timeout time.Duration) (string, error) {
+	id := uuid.NewUUID()
+	nj.ID = id
+	nj.Name = meta.ObjectNamePrefix + string(id)
+	nj.Group = ""
+	nj.Output = "stdout"
+	nj.DryRun = true
+	nj.Deadline = int64(timeout.Seconds())
+	nj.OwnerReferences = nil
+
+	tc := NewTraceJobClient(clientset, nj.Namespace)
+	if _, err := tc.CreateJob(nj); err != nil {
+		return "", fmt.Errorf("could not create the dry run of the trace: %v", err)
+	}
+	defer func() {
+		// The config map is owned by the job, and garbage collected along with it.
+		dp := metav1.DeletePropagationBackground
+		tc.JobClient.Delete(context.Background(), nj.Name, metav1.DeleteOptions{PropagationPolicy: &dp})
+	}()
+
+	var job *batchv1.Job
+	err := wait.PollImmediate(dryRunPollInterval, timeout, func() (bool, error) {
+		var err error
+		job, err = tc.JobClient.Get(context.Background(), nj.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return jobFinishTime(*job) != nil, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return "", fmt.Errorf("the dry run of the trace did not finish within %s", timeout)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	output, err := dryRunOutput(clientset, nj)
+	if err != nil {
+		return "", err
+	}
+	if jobStatus(*job) != TraceJobCompleted {
+		return output, fmt.Errorf("bpftrace rejected the program:\n%s", output)
+	}
+	return output, nil
+}
+
+// dryRunOutput returns the logs of the last pod of the dry run.
+func dryRunOutput(clientset kubernetes.Interface, nj TraceJob) (string, error) {
+	pods := clientset.CoreV1().Pods(nj.Namespace)
+	pl, err := pods.List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, nj.ID),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(pl.Items) == 0 {
+		return "", fmt.Errorf("no pod found for the dry run of the trace")
+	}
+
+	last := pl.Items[0]
+	for _, p := range pl.Items[1:] {
+		if last.CreationTimestamp.Before(&p.CreationTimestamp) {
+			last = p
+		}
+	}
+	logs, err := pods.GetLogs(last.Name, &apiv1.PodLogOptions{Container: nj.Name}).DoRaw(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("could not get the output of the dry run: %v", err)
+	}
+	return strings.TrimSpace(string(logs)), nil
+}
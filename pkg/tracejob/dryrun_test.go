@@ -0,0 +1,79 @@
+package tracejob
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// finishingJobs makes the jobs created with clientset finish right away, with a pod, as if
+// the cluster had run them.
+func finishingJobs(t *testing.T, clientset *fake.Clientset, condition batchv1.JobConditionType) {
+	clientset.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: apiv1.ConditionTrue}}
+		if condition == batchv1.JobComplete {
+			job.Status.Succeeded = 1
+		} else {
+			job.Status.Failed = 1
+		}
+		pod := &apiv1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name + "-abcde",
+			Namespace: job.Namespace,
+			Labels:    map[string]string{meta.TraceIDLabelKey: job.Labels[meta.TraceIDLabelKey]},
+		}}
+		require.NoError(t, clientset.Tracker().Add(pod))
+		return false, nil, nil
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	dryRunPollInterval = time.Millisecond
+	tj := TraceJob{Name: "kubectl-trace-1", ID: "1", Namespace: testNamespace, Tracer: "bpftrace", Program: "BEGIN { exit(); }"}
+
+	for _, condition := range []batchv1.JobConditionType{batchv1.JobComplete, batchv1.JobFailed} {
+		t.Run(string(condition), func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			finishingJobs(t, clientset, condition)
+			var created *batchv1.Job
+			clientset.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				created = action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+				return false, nil, nil
+			})
+
+			output, err := DryRun(clientset, tj, time.Second)
+			if condition == batchv1.JobComplete {
+				require.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, "bpftrace rejected the program:\nfake logs")
+			}
+			assert.Equal(t, "fake logs", output)
+
+			require.NotNil(t, created)
+			assert.NotEqual(t, tj.Name, created.Name)
+			assert.Contains(t, created.Spec.Template.Spec.Containers[0].Command, "--dry-run=true")
+
+			jobs, err := clientset.BatchV1().Jobs(testNamespace).List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+			assert.Empty(t, jobs.Items)
+		})
+	}
+}
+
+func TestDryRunTimeout(t *testing.T) {
+	dryRunPollInterval = time.Millisecond
+	tj := TraceJob{Name: "kubectl-trace-1", ID: "1", Namespace: testNamespace, Tracer: "bpftrace", Program: "BEGIN { exit(); }"}
+
+	_, err := DryRun(fake.NewSimpleClientset(), tj, 10*time.Millisecond)
+	assert.EqualError(t, err, "the dry run of the trace did not finish within 10ms")
+}
@@ -0,0 +1,95 @@
+package tracejob
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GarbageCollect deletes the trace jobs which finished more than retention ago,
+// and the trace configurations older than retention which are left without a job.
+// With dryRun, what would be deleted is only reported.
+func (t *TraceJobClient) GarbageCollect(retention time.Duration, dryRun bool) error {
+	jl, err := t.findJobsWithFilter(TraceJobFilter{})
+	if err != nil {
+		return err
+	}
+	cl, err := t.findConfigMapsWithFilter(TraceJobFilter{})
+	if err != nil {
+		return err
+	}
+
+	suffix := ""
+	if dryRun {
+		suffix = " (dry run)"
+	}
+	cutoff := time.Now().Add(-retention)
+	nothingDeleted := true
+
+	jobs := map[string]bool{}
+	dp := metav1.DeletePropagationBackground
+	for _, j := range jl {
+		finished := jobFinishTime(j)
+		if finished == nil || !finished.Time.Before(cutoff) {
+			jobs[j.Name] = true
+			continue
+		}
+		if !dryRun {
+			err := t.JobClient.Delete(context.Background(), j.Name, metav1.DeleteOptions{
+				PropagationPolicy: &dp,
+			})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+		fmt.Fprintf(t.outStream, "trace job %s deleted%s\n", j.Name, suffix)
+		nothingDeleted = false
+	}
+
+	for _, c := range cl {
+		// Configurations owned by their job are deleted along with it by the cluster.
+		if jobs[c.Name] || ownedByJob(c) || !c.CreationTimestamp.Time.Before(cutoff) {
+			continue
+		}
+		if !dryRun {
+			err := t.ConfigClient.Delete(context.Background(), c.Name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+		fmt.Fprintf(t.outStream, "trace configuration %s deleted%s\n", c.Name, suffix)
+		nothingDeleted = false
+	}
+
+	if nothingDeleted {
+		fmt.Fprintf(t.outStream, "no trace older than %s to be deleted\n", retention)
+	}
+	return nil
+}
+
+// jobFinishTime returns when j completed or failed, like the TTL controller does, or nil if it has not finished.
+func jobFinishTime(j batchv1.Job) *metav1.Time {
+	for _, c := range j.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == apiv1.ConditionTrue {
+			if c.LastTransitionTime.IsZero() {
+				return &j.CreationTimestamp
+			}
+			return &c.LastTransitionTime
+		}
+	}
+	return nil
+}
+
+func ownedByJob(c apiv1.ConfigMap) bool {
+	for _, o := range c.OwnerReferences {
+		if o.Kind == "Job" && o.APIVersion == batchv1.SchemeGroupVersion.String() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package tracejob
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGarbageCollect(t *testing.T) {
+	old := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+	recent := metav1.NewTime(time.Now().Add(-time.Minute))
+
+	tc := NewTraceJobClient(fake.NewSimpleClientset(), testNamespace)
+	for _, tj := range []TraceJob{
+		{Name: "kubectl-trace-completed", ID: "completed"},
+		{Name: "kubectl-trace-failed", ID: "failed"},
+		{Name: "kubectl-trace-recent", ID: "recent"},
+		{Name: "kubectl-trace-running", ID: "running"},
+		{Name: "kubectl-trace-orphan", ID: "orphan"},
+		{Name: "kubectl-trace-new-orphan", ID: "new-orphan"},
+	} {
+		_, err := tc.CreateJob(tj)
+		require.NoError(t, err)
+	}
+
+	finish := func(name string, condition batchv1.JobConditionType, at metav1.Time) {
+		job, err := tc.JobClient.Get(context.Background(), name, metav1.GetOptions{})
+		require.NoError(t, err)
+		job.CreationTimestamp = old
+		job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: apiv1.ConditionTrue, LastTransitionTime: at}}
+		_, err = tc.JobClient.Update(context.Background(), job, metav1.UpdateOptions{})
+		require.NoError(t, err)
+	}
+	finish("kubectl-trace-completed", batchv1.JobComplete, old)
+	finish("kubectl-trace-failed", batchv1.JobFailed, old)
+	finish("kubectl-trace-recent", batchv1.JobComplete, recent)
+
+	// The job of a trace created before configurations were owned by jobs
+	// may have been deleted without its configuration.
+	for name, created := range map[string]metav1.Time{"kubectl-trace-orphan": old, "kubectl-trace-new-orphan": recent} {
+		require.NoError(t, tc.JobClient.Delete(context.Background(), name, metav1.DeleteOptions{}))
+		cm, err := tc.ConfigClient.Get(context.Background(), name, metav1.GetOptions{})
+		require.NoError(t, err)
+		cm.CreationTimestamp = created
+		cm.OwnerReferences = nil
+		_, err = tc.ConfigClient.Update(context.Background(), cm, metav1.UpdateOptions{})
+		require.NoError(t, err)
+	}
+
+	var out bytes.Buffer
+	tc.WithOutStream(&out)
+	require.NoError(t, tc.GarbageCollect(time.Hour, true))
+	assert.Contains(t, out.String(), "trace job kubectl-trace-completed deleted (dry run)\n")
+	jl, err := tc.JobClient.List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, jl.Items, 4)
+
+	out.Reset()
+	require.NoError(t, tc.GarbageCollect(time.Hour, false))
+	assert.Equal(t, "trace job kubectl-trace-completed deleted\n"+
+		"trace job kubectl-trace-failed deleted\n"+
+		"trace configuration kubectl-trace-orphan deleted\n", out.String())
+
+	jl, err = tc.JobClient.List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	var jobs []string
+	for _, j := range jl.Items {
+		jobs = append(jobs, j.Name)
+	}
+	assert.ElementsMatch(t, []string{"kubectl-trace-recent", "kubectl-trace-running"}, jobs)
+
+	out.Reset()
+	require.NoError(t, tc.GarbageCollect(time.Hour, false))
+	assert.Equal(t, "no trace older than 1h0m0s to be deleted\n", out.String())
+}
@@ -8,11 +8,15 @@ import (
 	"io/ioutil"
 	"path"
 	"strconv"
+	"strings"
+	"time"
 
 	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/upload"
 	batchv1 "k8s.io/api/batch/v1"
 	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -29,6 +33,21 @@ const (
 	OutputSizeLimit  = "1Gi"
 	GoogleAppKeyPath = "/var/secrets/google/"
 	GoogleAppKeyName = "key.json"
+	// HTTPHeadersPath is where the secret of the headers of HTTP outputs is mounted.
+	HTTPHeadersPath = "/var/secrets/http-headers/"
+
+	// DefaultCPURequest is the CPU requested by the trace containers.
+	DefaultCPURequest = "100m"
+	// DefaultMemoryRequest is the memory requested by the trace containers.
+	DefaultMemoryRequest = "100Mi"
+	// DefaultCPULimit is the CPU limit of the trace containers.
+	DefaultCPULimit = "1"
+	// DefaultMemoryLimit is the memory limit of the trace containers.
+	DefaultMemoryLimit = "1G"
+
+	// DefaultTTL is the time a finished trace job is kept before being deleted, in seconds,
+	// long enough to read its logs or to rerun it.
+	DefaultTTL int32 = 3600
 )
 
 type TraceJobClient struct {
@@ -41,6 +60,7 @@ type TraceJobClient struct {
 type TraceJob struct {
 	Name                string
 	ID                  types.UID
+	Group               types.UID
 	Namespace           string
 	ServiceAccount      string
 	Tracer              string
@@ -56,11 +76,34 @@ type TraceJob struct {
 	FetchHeaders        bool
 	Deadline            int64
 	DeadlineGracePeriod int64
-	GoogleAppSecret     string
-	StartTime           *metav1.Time
-	Status              TraceJobStatus
-	Patch               string
-	PatchType           string
+	// WaitForProcess is how long the trace waits for a process matching ProcessSelector to appear, when not zero.
+	WaitForProcess time.Duration
+	// TTL is the time the trace job is kept once finished, in seconds. DefaultTTL is used when nil.
+	TTL *int32
+	// Resources of the trace containers, the missing requests and limits default to DefaultResourceRequests and DefaultResourceLimits.
+	Resources apiv1.ResourceRequirements
+	// SecurityProfile tells which privileges the trace container is given, SecurityProfilePrivileged when empty.
+	SecurityProfile SecurityProfile
+	GoogleAppSecret string
+	StartTime       *metav1.Time
+	Status          TraceJobStatus
+	// Patch is the content of a YAML or JSON patch applied to the job with the PatchType strategy.
+	Patch     string
+	PatchType string
+	// DryRun makes bpftrace stop right after attaching its probes, to check the program on the target.
+	DryRun bool
+	// AWSCredentialsSecret is a secret holding the AWS_* variables used for S3 outputs, set in the environment of the trace container.
+	AWSCredentialsSecret string
+	// HTTPHeadersSecret is a secret whose keys are the names of headers added to the requests of HTTP outputs, and values their values.
+	HTTPHeadersSecret string
+	// HTTPUploadFormat is how HTTP outputs are posted, upload.HTTPUploadTar when empty or upload.HTTPUploadMultipart.
+	HTTPUploadFormat string
+	// Format is the format of the output of bpftrace, events.JSONFormat to send its events to EventsSink, text when empty.
+	Format string
+	// EventsSink is where the events of bpftrace are sent in the JSON format, stdout when empty.
+	EventsSink string
+	// OwnerReferences are set on the job and config map, eg to the TraceJob custom resource they were created for.
+	OwnerReferences []metav1.OwnerReference
 }
 
 func NewTraceJobClient(clientset kubernetes.Interface, namespace string) *TraceJobClient {
@@ -79,8 +122,9 @@ func (t *TraceJobClient) WithOutStream(o io.Writer) {
 }
 
 type TraceJobFilter struct {
-	Name *string
-	ID   *types.UID
+	Name  *string
+	ID    *types.UID
+	Group *types.UID
 }
 
 func (nf TraceJobFilter) selectorOptions() metav1.ListOptions {
@@ -98,7 +142,13 @@ func (nf TraceJobFilter) selectorOptions() metav1.ListOptions {
 		}
 	}
 
-	if nf.Name == nil && nf.ID == nil {
+	if nf.Group != nil {
+		selectorOptions = metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", meta.TraceGroupLabelKey, *nf.Group),
+		}
+	}
+
+	if nf.Name == nil && nf.ID == nil && nf.Group == nil {
 		selectorOptions = metav1.ListOptions{
 			LabelSelector: fmt.Sprintf("%s", meta.TraceIDLabelKey),
 		}
@@ -141,6 +191,18 @@ func (t *TraceJobClient) GetJob(nf TraceJobFilter) ([]TraceJob, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	// The programs are in the config maps, named after their jobs.
+	programs := map[string]apiv1.ConfigMap{}
+	if t.ConfigClient != nil && len(jl) > 0 {
+		cml, err := t.findConfigMapsWithFilter(nf)
+		if err != nil {
+			return nil, err
+		}
+		for _, cm := range cml {
+			programs[cm.Name] = cm
+		}
+	}
 	tjobs := []TraceJob{}
 
 	for _, j := range jl {
@@ -153,6 +215,10 @@ func (t *TraceJobClient) GetJob(nf TraceJobFilter) ([]TraceJob, error) {
 		if !ok {
 			id = ""
 		}
+		group, ok := labels[meta.TraceGroupLabelKey]
+		if !ok {
+			group = ""
+		}
 		hostname, err := jobHostname(j)
 		if err != nil {
 			hostname = ""
@@ -160,6 +226,7 @@ func (t *TraceJobClient) GetJob(nf TraceJobFilter) ([]TraceJob, error) {
 		tj := TraceJob{
 			Name:      name,
 			ID:        types.UID(id),
+			Group:     types.UID(group),
 			Namespace: j.Namespace,
 			Target: TraceJobTarget{
 				Node: hostname,
@@ -167,6 +234,13 @@ func (t *TraceJobClient) GetJob(nf TraceJobFilter) ([]TraceJob, error) {
 			StartTime: j.Status.StartTime,
 			Status:    jobStatus(j),
 		}
+		// Jobs created before the spec was persisted only tell what their command line does.
+		if err := decodeTraceSpec(j, &tj); err != nil {
+			decodeTraceCommand(j, &tj)
+		}
+		if cm, ok := programs[j.Name]; ok {
+			tj.Program = cm.Data["program.bt"]
+		}
 		tjobs = append(tjobs, tj)
 	}
 
@@ -200,8 +274,9 @@ func (t *TraceJobClient) DeleteJobs(nf TraceJobFilter) error {
 	}
 
 	for _, c := range cl {
+		// Configurations owned by their job may already be deleted along with it by the cluster.
 		err := t.ConfigClient.Delete(context.Background(), c.Name, metav1.DeleteOptions{})
-		if err != nil {
+		if err != nil && !apierrors.IsNotFound(err) {
 			return err
 		}
 		fmt.Fprintf(t.outStream, "trace configuration %s deleted\n", c.Name)
@@ -214,22 +289,75 @@ func (t *TraceJobClient) DeleteJobs(nf TraceJobFilter) error {
 	return nil
 }
 
-func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
+// Manifests returns the job and config map of the trace job as CreateJob submits them, once patched.
+func (nj *TraceJob) Manifests() (*batchv1.Job, *apiv1.ConfigMap, error) {
 	job, cm := nj.Job(), nj.ConfigMap()
 
 	// Optionally patch the job before creating it
 	if nj.PatchType != "" && nj.Patch != "" {
-		newJob, err := patchJobFile(job, nj.PatchType, nj.Patch)
+		newJob, err := patchJob(job, nj.PatchType, []byte(nj.Patch))
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		job = newJob
 	}
+	return job, cm, nil
+}
 
-	if _, err := t.ConfigClient.Create(context.Background(), cm, metav1.CreateOptions{}); err != nil {
+func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
+	job, cm, err := nj.Manifests()
+	if err != nil {
 		return nil, err
 	}
-	return t.JobClient.Create(context.Background(), job, metav1.CreateOptions{})
+
+	job, err = t.JobClient.Create(context.Background(), job, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// The config map is owned by its job, so that they are garbage collected together. The job waits
+	// for it to be mounted, and is deleted when it cannot be created so that no trace is left running.
+	if err := t.createConfigMap(cm, job); err != nil {
+		dp := metav1.DeletePropagationBackground
+		derr := t.JobClient.Delete(context.Background(), job.Name, metav1.DeleteOptions{PropagationPolicy: &dp})
+		if derr != nil && !apierrors.IsNotFound(derr) {
+			return nil, fmt.Errorf("could not create trace configuration %s: %v, and could not delete trace job %s: %v", cm.Name, err, job.Name, derr)
+		}
+		return nil, fmt.Errorf("could not create trace configuration %s: %v", cm.Name, err)
+	}
+	return job, nil
+}
+
+// createConfigMap creates cm owned by job, or updates it when it is left over from a previous attempt
+// at creating the same trace job.
+func (t *TraceJobClient) createConfigMap(cm *apiv1.ConfigMap, job *batchv1.Job) error {
+	cm.OwnerReferences = append(cm.OwnerReferences, metav1.OwnerReference{
+		APIVersion: batchv1.SchemeGroupVersion.String(),
+		Kind:       "Job",
+		Name:       job.Name,
+		UID:        job.UID,
+	})
+	_, err := t.ConfigClient.Create(context.Background(), cm, metav1.CreateOptions{})
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	existing, err := t.ConfigClient.Get(context.Background(), cm.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	existing.Labels = cm.Labels
+	existing.Data = cm.Data
+	existing.OwnerReferences = cm.OwnerReferences
+	_, err = t.ConfigClient.Update(context.Background(), existing, metav1.UpdateOptions{})
+	return err
+}
+
+func (nj *TraceJob) ttl() int32 {
+	if nj.TTL == nil {
+		return DefaultTTL
+	}
+	return *nj.TTL
 }
 
 func (nj *TraceJob) Job() *batchv1.Job {
@@ -247,6 +375,14 @@ func (nj *TraceJob) Job() *batchv1.Job {
 		"--output=" + nj.Output,
 	}
 
+	if nj.Target.Container != "" {
+		traceCmd = append(traceCmd, "--container-name="+nj.Target.Container)
+	}
+
+	if nj.WaitForProcess > 0 {
+		traceCmd = append(traceCmd, "--wait-for-process="+nj.WaitForProcess.String())
+	}
+
 	if nj.Tracer == "bpftrace" {
 		traceCmd = append(traceCmd, "--program=/programs/program.bt")
 	} else {
@@ -257,14 +393,29 @@ func (nj *TraceJob) Job() *batchv1.Job {
 		traceCmd = append(traceCmd, "--args="+arg)
 	}
 
+	if nj.DryRun {
+		traceCmd = append(traceCmd, "--dry-run=true")
+	}
+
+	if nj.Format != "" {
+		traceCmd = append(traceCmd, "--format="+nj.Format)
+	}
+
+	if nj.EventsSink != "" {
+		traceCmd = append(traceCmd, "--events-sink="+nj.EventsSink)
+	}
+
 	commonMeta := *nj.Meta()
 	cm := nj.ConfigMap()
 
+	jobMeta := *commonMeta.DeepCopy()
+	jobMeta.OwnerReferences = nj.OwnerReferences
+
 	job := &batchv1.Job{
-		ObjectMeta: commonMeta,
+		ObjectMeta: jobMeta,
 		Spec: batchv1.JobSpec{
 			ActiveDeadlineSeconds:   int64Ptr(nj.Deadline + nj.DeadlineGracePeriod),
-			TTLSecondsAfterFinished: int32Ptr(5),
+			TTLSecondsAfterFinished: int32Ptr(nj.ttl()),
 			Parallelism:             int32Ptr(1),
 			Completions:             int32Ptr(1),
 			BackoffLimit:            int32Ptr(1),
@@ -311,21 +462,12 @@ func (nj *TraceJob) Job() *batchv1.Job {
 					},
 					Containers: []apiv1.Container{
 						apiv1.Container{
-							Name:    nj.Name,
-							Image:   nj.ImageNameTag,
-							Command: traceCmd,
-							TTY:     true,
-							Stdin:   true,
-							Resources: apiv1.ResourceRequirements{
-								Requests: apiv1.ResourceList{
-									apiv1.ResourceCPU:    resource.MustParse("100m"),
-									apiv1.ResourceMemory: resource.MustParse("100Mi"),
-								},
-								Limits: apiv1.ResourceList{
-									apiv1.ResourceCPU:    resource.MustParse("1"),
-									apiv1.ResourceMemory: resource.MustParse("1G"),
-								},
-							},
+							Name:      nj.Name,
+							Image:     nj.ImageNameTag,
+							Command:   traceCmd,
+							TTY:       true,
+							Stdin:     true,
+							Resources: nj.resources(),
 							VolumeMounts: []apiv1.VolumeMount{
 								apiv1.VolumeMount{
 									Name:      "program",
@@ -379,12 +521,7 @@ func (nj *TraceJob) Job() *batchv1.Job {
 							},
 						},
 					},
-					Tolerations: []apiv1.Toleration{
-						apiv1.Toleration{
-							Effect:   apiv1.TaintEffectNoSchedule,
-							Operator: apiv1.TolerationOpExists,
-						},
-					},
+					Tolerations: traceTolerations(),
 				},
 			},
 		},
@@ -394,18 +531,9 @@ func (nj *TraceJob) Job() *batchv1.Job {
 		// If we are downloading headers, add the initContainer and set up mounts
 		job.Spec.Template.Spec.InitContainers = []apiv1.Container{
 			apiv1.Container{
-				Name:  "kubectl-trace-init",
-				Image: nj.InitImageNameTag,
-				Resources: apiv1.ResourceRequirements{
-					Requests: apiv1.ResourceList{
-						apiv1.ResourceCPU:    resource.MustParse("100m"),
-						apiv1.ResourceMemory: resource.MustParse("100Mi"),
-					},
-					Limits: apiv1.ResourceList{
-						apiv1.ResourceCPU:    resource.MustParse("1"),
-						apiv1.ResourceMemory: resource.MustParse("1G"),
-					},
-				},
+				Name:      "kubectl-trace-init",
+				Image:     nj.InitImageNameTag,
+				Resources: nj.resources(),
 				VolumeMounts: []apiv1.VolumeMount{
 					apiv1.VolumeMount{
 						Name:      "lsb-release",
@@ -557,12 +685,63 @@ func (nj *TraceJob) Job() *batchv1.Job {
 
 	}
 
+	if nj.AWSCredentialsSecret != "" {
+		job.Spec.Template.Spec.Containers[0].EnvFrom = append(job.Spec.Template.Spec.Containers[0].EnvFrom,
+			apiv1.EnvFromSource{
+				SecretRef: &apiv1.SecretEnvSource{
+					LocalObjectReference: apiv1.LocalObjectReference{
+						Name: nj.AWSCredentialsSecret,
+					},
+				},
+			})
+	}
+
+	if nj.HTTPHeadersSecret != "" {
+		job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes,
+			apiv1.Volume{
+				Name: "http-headers-secret",
+				VolumeSource: apiv1.VolumeSource{
+					Secret: &apiv1.SecretVolumeSource{
+						SecretName: nj.HTTPHeadersSecret,
+					},
+				},
+			})
+
+		job.Spec.Template.Spec.Containers[0].VolumeMounts = append(job.Spec.Template.Spec.Containers[0].VolumeMounts,
+			apiv1.VolumeMount{
+				Name:      "http-headers-secret",
+				MountPath: HTTPHeadersPath,
+				ReadOnly:  true,
+			})
+
+		job.Spec.Template.Spec.Containers[0].Env = append(job.Spec.Template.Spec.Containers[0].Env,
+			apiv1.EnvVar{
+				Name:  upload.HTTPHeadersDirEnvVar,
+				Value: HTTPHeadersPath,
+			})
+	}
+
+	if nj.HTTPUploadFormat != "" {
+		job.Spec.Template.Spec.Containers[0].Env = append(job.Spec.Template.Spec.Containers[0].Env,
+			apiv1.EnvVar{
+				Name:  upload.HTTPUploadFormatEnvVar,
+				Value: nj.HTTPUploadFormat,
+			})
+	}
+
+	if nj.SecurityProfile == SecurityProfileRestrictedBPF {
+		nj.restrictJob(job)
+	}
+
 	return job
 }
 
 func (nj *TraceJob) ConfigMap() *apiv1.ConfigMap {
+	cmMeta := *nj.Meta()
+	cmMeta.OwnerReferences = nj.OwnerReferences
+
 	return &apiv1.ConfigMap{
-		ObjectMeta: *nj.Meta(),
+		ObjectMeta: cmMeta,
 		Data: map[string]string{
 			"program.bt": nj.Program,
 		},
@@ -570,7 +749,7 @@ func (nj *TraceJob) ConfigMap() *apiv1.ConfigMap {
 }
 
 func (nj *TraceJob) Meta() *metav1.ObjectMeta {
-	return &metav1.ObjectMeta{
+	objectMeta := &metav1.ObjectMeta{
 		Name:      nj.Name,
 		Namespace: nj.Namespace,
 		Labels: map[string]string{
@@ -582,6 +761,102 @@ func (nj *TraceJob) Meta() *metav1.ObjectMeta {
 			meta.TraceIDLabelKey: string(nj.ID),
 		},
 	}
+
+	if nj.Group != "" {
+		objectMeta.Labels[meta.TraceGroupLabelKey] = string(nj.Group)
+		objectMeta.Annotations[meta.TraceGroupLabelKey] = string(nj.Group)
+	}
+
+	// The spec only holds strings, numbers, booleans and quantities, it always marshals.
+	spec, _ := json.Marshal(nj.spec())
+	objectMeta.Annotations[meta.TraceSpecAnnotationKey] = string(spec)
+
+	return objectMeta
+}
+
+// DefaultResourceRequests are the resources requested by the trace containers.
+func DefaultResourceRequests() apiv1.ResourceList {
+	return apiv1.ResourceList{
+		apiv1.ResourceCPU:    resource.MustParse(DefaultCPURequest),
+		apiv1.ResourceMemory: resource.MustParse(DefaultMemoryRequest),
+	}
+}
+
+// DefaultResourceLimits are the resource limits of the trace containers.
+func DefaultResourceLimits() apiv1.ResourceList {
+	return apiv1.ResourceList{
+		apiv1.ResourceCPU:    resource.MustParse(DefaultCPULimit),
+		apiv1.ResourceMemory: resource.MustParse(DefaultMemoryLimit),
+	}
+}
+
+// ResourceRequirements parses the resources of the trace containers,
+// the defaults being used for the empty quantities.
+func ResourceRequirements(cpuRequest, cpuLimit, memoryRequest, memoryLimit string) (apiv1.ResourceRequirements, error) {
+	r := apiv1.ResourceRequirements{
+		Requests: apiv1.ResourceList{},
+		Limits:   apiv1.ResourceList{},
+	}
+	for _, q := range []struct {
+		list  apiv1.ResourceList
+		name  apiv1.ResourceName
+		value string
+		what  string
+	}{
+		{r.Requests, apiv1.ResourceCPU, cpuRequest, "cpu request"},
+		{r.Limits, apiv1.ResourceCPU, cpuLimit, "cpu limit"},
+		{r.Requests, apiv1.ResourceMemory, memoryRequest, "memory request"},
+		{r.Limits, apiv1.ResourceMemory, memoryLimit, "memory limit"},
+	} {
+		if q.value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(q.value)
+		if err != nil {
+			return r, fmt.Errorf("invalid %s %q: %v", q.what, q.value, err)
+		}
+		q.list[q.name] = quantity
+	}
+
+	return CompleteResourceRequirements(r)
+}
+
+// CompleteResourceRequirements completes r with the default requests and limits,
+// checking that no request is greater than its limit.
+func CompleteResourceRequirements(r apiv1.ResourceRequirements) (apiv1.ResourceRequirements, error) {
+	r = withDefaultResources(r)
+	for name, request := range r.Requests {
+		if limit, ok := r.Limits[name]; ok && request.Cmp(limit) > 0 {
+			return r, fmt.Errorf("the %s request %s is greater than its limit %s", name, request.String(), limit.String())
+		}
+	}
+	return r, nil
+}
+
+// withDefaultResources completes r with the default requests and limits.
+func withDefaultResources(r apiv1.ResourceRequirements) apiv1.ResourceRequirements {
+	requests, limits := DefaultResourceRequests(), DefaultResourceLimits()
+	for name, quantity := range r.Requests {
+		requests[name] = quantity
+	}
+	for name, quantity := range r.Limits {
+		limits[name] = quantity
+	}
+	return apiv1.ResourceRequirements{Requests: requests, Limits: limits}
+}
+
+func (nj *TraceJob) resources() apiv1.ResourceRequirements {
+	return withDefaultResources(nj.Resources)
+}
+
+// traceTolerations lets trace jobs be scheduled on nodes regardless of their NoSchedule taints.
+func traceTolerations() []apiv1.Toleration {
+	return []apiv1.Toleration{
+		apiv1.Toleration{
+			Effect:   apiv1.TaintEffectNoSchedule,
+			Operator: apiv1.TolerationOpExists,
+		},
+	}
 }
 
 func int32Ptr(i int32) *int32                            { return &i }
@@ -630,6 +905,159 @@ func jobHostname(j batchv1.Job) (string, error) {
 	return "", fmt.Errorf("hostname not found for job")
 }
 
+// traceJobSpec is what a trace job does. It is persisted as JSON in the annotations of the
+// trace job objects, except for the program that is already in the config map.
+type traceJobSpec struct {
+	ServiceAccount       string                      `json:"serviceAccount,omitempty"`
+	Tracer               string                      `json:"tracer,omitempty"`
+	Target               TraceJobTarget              `json:"target"`
+	ProcessSelector      string                      `json:"processSelector,omitempty"`
+	WaitForProcess       time.Duration               `json:"waitForProcess,omitempty"`
+	Output               string                      `json:"output,omitempty"`
+	ProgramArgs          []string                    `json:"programArgs,omitempty"`
+	ImageNameTag         string                      `json:"imageNameTag,omitempty"`
+	InitImageNameTag     string                      `json:"initImageNameTag,omitempty"`
+	FetchHeaders         bool                        `json:"fetchHeaders,omitempty"`
+	Deadline             int64                       `json:"deadline,omitempty"`
+	DeadlineGracePeriod  int64                       `json:"deadlineGracePeriod,omitempty"`
+	TTL                  *int32                      `json:"ttl,omitempty"`
+	Resources            *apiv1.ResourceRequirements `json:"resources,omitempty"`
+	SecurityProfile      SecurityProfile             `json:"securityProfile,omitempty"`
+	GoogleAppSecret      string                      `json:"googleAppSecret,omitempty"`
+	AWSCredentialsSecret string                      `json:"awsCredentialsSecret,omitempty"`
+	HTTPHeadersSecret    string                      `json:"httpHeadersSecret,omitempty"`
+	HTTPUploadFormat     string                      `json:"httpUploadFormat,omitempty"`
+	Format               string                      `json:"format,omitempty"`
+	EventsSink           string                      `json:"eventsSink,omitempty"`
+	Patch                string                      `json:"patch,omitempty"`
+	PatchType            string                      `json:"patchType,omitempty"`
+}
+
+func (nj *TraceJob) spec() traceJobSpec {
+	spec := traceJobSpec{
+		ServiceAccount:       nj.ServiceAccount,
+		Tracer:               nj.Tracer,
+		Target:               nj.Target,
+		ProcessSelector:      nj.ProcessSelector,
+		WaitForProcess:       nj.WaitForProcess,
+		Output:               nj.Output,
+		ProgramArgs:          nj.ProgramArgs,
+		ImageNameTag:         nj.ImageNameTag,
+		InitImageNameTag:     nj.InitImageNameTag,
+		FetchHeaders:         nj.FetchHeaders,
+		Deadline:             nj.Deadline,
+		DeadlineGracePeriod:  nj.DeadlineGracePeriod,
+		TTL:                  nj.TTL,
+		SecurityProfile:      nj.SecurityProfile,
+		GoogleAppSecret:      nj.GoogleAppSecret,
+		AWSCredentialsSecret: nj.AWSCredentialsSecret,
+		HTTPHeadersSecret:    nj.HTTPHeadersSecret,
+		HTTPUploadFormat:     nj.HTTPUploadFormat,
+		Format:               nj.Format,
+		EventsSink:           nj.EventsSink,
+		Patch:                nj.Patch,
+		PatchType:            nj.PatchType,
+	}
+	if len(nj.Resources.Requests) > 0 || len(nj.Resources.Limits) > 0 {
+		spec.Resources = &nj.Resources
+	}
+	return spec
+}
+
+// decodeTraceSpec recovers the settings of a trace job from the spec persisted in the annotations of its job.
+func decodeTraceSpec(j batchv1.Job, tj *TraceJob) error {
+	annotation, ok := j.GetAnnotations()[meta.TraceSpecAnnotationKey]
+	if !ok {
+		return fmt.Errorf("annotation %s not found for job", meta.TraceSpecAnnotationKey)
+	}
+
+	var spec traceJobSpec
+	if err := json.Unmarshal([]byte(annotation), &spec); err != nil {
+		return fmt.Errorf("could not decode the spec of the job: %v", err)
+	}
+
+	tj.ServiceAccount = spec.ServiceAccount
+	tj.Tracer = spec.Tracer
+	tj.Target = spec.Target
+	tj.ProcessSelector = spec.ProcessSelector
+	tj.WaitForProcess = spec.WaitForProcess
+	tj.Output = spec.Output
+	tj.ProgramArgs = spec.ProgramArgs
+	tj.ImageNameTag = spec.ImageNameTag
+	tj.InitImageNameTag = spec.InitImageNameTag
+	tj.FetchHeaders = spec.FetchHeaders
+	tj.Deadline = spec.Deadline
+	tj.DeadlineGracePeriod = spec.DeadlineGracePeriod
+	tj.TTL = spec.TTL
+	tj.SecurityProfile = spec.SecurityProfile
+	if spec.Resources != nil {
+		tj.Resources = *spec.Resources
+	}
+	tj.GoogleAppSecret = spec.GoogleAppSecret
+	tj.AWSCredentialsSecret = spec.AWSCredentialsSecret
+	tj.HTTPHeadersSecret = spec.HTTPHeadersSecret
+	tj.HTTPUploadFormat = spec.HTTPUploadFormat
+	tj.Format = spec.Format
+	tj.EventsSink = spec.EventsSink
+	tj.Patch = spec.Patch
+	tj.PatchType = spec.PatchType
+	return nil
+}
+
+// decodeTraceCommand recovers the settings of a trace job from the command of its trace container.
+func decodeTraceCommand(j batchv1.Job, tj *TraceJob) {
+	containers := j.Spec.Template.Spec.Containers
+	if len(containers) == 0 {
+		return
+	}
+	c := containers[0]
+	tj.ImageNameTag = c.Image
+	tj.ServiceAccount = j.Spec.Template.Spec.ServiceAccountName
+
+	// The command is: /bin/timeout --preserve-status --signal INT DEADLINE /bin/trace-runner FLAGS...
+	cmd := c.Command
+	if len(cmd) < 6 || cmd[5] != "/bin/trace-runner" {
+		return
+	}
+	if deadline, err := strconv.ParseInt(cmd[4], 10, 64); err == nil {
+		tj.Deadline = deadline
+		if ads := j.Spec.ActiveDeadlineSeconds; ads != nil {
+			tj.DeadlineGracePeriod = *ads - deadline
+		}
+	}
+
+	for _, arg := range cmd[6:] {
+		flag, value, ok := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !ok {
+			continue
+		}
+		switch flag {
+		case "tracer":
+			tj.Tracer = value
+		case "pod-uid":
+			tj.Target.PodUID = value
+		case "container-id":
+			tj.Target.ContainerID = value
+		case "container-name":
+			tj.Target.Container = value
+		case "process-selector":
+			tj.ProcessSelector = value
+		case "wait-for-process":
+			tj.WaitForProcess, _ = time.ParseDuration(value)
+		case "output":
+			tj.Output = value
+		case "args":
+			tj.ProgramArgs = append(tj.ProgramArgs, value)
+		case "dry-run":
+			tj.DryRun = value == "true"
+		case "format":
+			tj.Format = value
+		case "events-sink":
+			tj.EventsSink = value
+		}
+	}
+}
+
 // TraceJobStatus is a label for the running status of a trace job at the current time.
 type TraceJobStatus string
 
@@ -658,20 +1086,78 @@ func jobStatus(j batchv1.Job) TraceJobStatus {
 	return TraceJobUnknown
 }
 
+// TraceGroup summarizes the trace jobs sharing a group.
+type TraceGroup struct {
+	ID        types.UID
+	Namespace string
+	Traces    int
+	Running   int
+	Completed int
+	Failed    int
+	StartTime *metav1.Time
+}
+
+// GroupTraceJobs aggregates trace jobs by group, in order of appearance.
+// Trace jobs which are not part of a group are left out.
+func GroupTraceJobs(tjs []TraceJob) []TraceGroup {
+	groups := []TraceGroup{}
+	index := map[string]int{}
+
+	for _, tj := range tjs {
+		if tj.Group == "" {
+			continue
+		}
+
+		key := tj.Namespace + "/" + string(tj.Group)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, TraceGroup{
+				ID:        tj.Group,
+				Namespace: tj.Namespace,
+			})
+		}
+
+		g := &groups[i]
+		g.Traces++
+		switch tj.Status {
+		case TraceJobRunning:
+			g.Running++
+		case TraceJobCompleted:
+			g.Completed++
+		case TraceJobFailed:
+			g.Failed++
+		}
+		if tj.StartTime != nil && (g.StartTime == nil || tj.StartTime.Before(g.StartTime)) {
+			g.StartTime = tj.StartTime
+		}
+	}
+
+	return groups
+}
+
+// Status aggregates the status of the trace jobs of the group: the group is running as long
+// as one of its trace jobs is, and only completed once all of them are.
+func (g TraceGroup) Status() TraceJobStatus {
+	switch {
+	case g.Running > 0:
+		return TraceJobRunning
+	case g.Failed > 0:
+		return TraceJobFailed
+	case g.Completed == g.Traces:
+		return TraceJobCompleted
+	default:
+		return TraceJobUnknown
+	}
+}
+
 var patchTypes = map[string]types.PatchType{
 	"json":      types.JSONPatchType,
 	"merge":     types.MergePatchType,
 	"strategic": types.StrategicMergePatchType,
 }
 
-func patchJobFile(j *batchv1.Job, patchType, patchPath string) (*batchv1.Job, error) {
-	patchYAML, err := ioutil.ReadFile(patchPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read patch yaml path %v: %s", patchPath, err)
-	}
-	return patchJob(j, patchType, patchYAML)
-}
-
 func patchJob(j *batchv1.Job, patchType string, patchBytes []byte) (*batchv1.Job, error) {
 	var err error
 	patchJSON := patchBytes
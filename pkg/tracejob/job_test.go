@@ -2,13 +2,25 @@ package tracejob
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
 	"testing"
+	"time"
 
+	"github.com/iovisor/kubectl-trace/pkg/meta"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 const (
@@ -69,3 +81,363 @@ func (j *jobSuite) TestCreateJobWithGoogleAppSecret() {
 	assert.Len(j.T(), joblist.Items[0].Spec.Template.Spec.Containers[0].Env, 1)
 	assert.Equal(j.T(), joblist.Items[0].Spec.Template.Spec.Containers[0].Env[0].Name, "GOOGLE_APPLICATION_CREDENTIALS")
 }
+
+func (j *jobSuite) TestCreateJobWithAWSCredentialsSecret() {
+	id := types.UID("test-create-with-aws-credentials-secret")
+	tj := TraceJob{
+		Name:                 "test-create-with-aws-credentials-secret",
+		ID:                   id,
+		Namespace:            testNamespace,
+		Output:               "s3://traces/api",
+		AWSCredentialsSecret: "test-aws-secret",
+	}
+
+	job, err := j.client.CreateJob(tj)
+	assert.Nil(j.T(), err)
+
+	envFrom := job.Spec.Template.Spec.Containers[0].EnvFrom
+	assert.Len(j.T(), envFrom, 1)
+	assert.Equal(j.T(), "test-aws-secret", envFrom[0].SecretRef.Name)
+
+	jobs, err := j.client.GetJob(TraceJobFilter{ID: &id})
+	assert.Nil(j.T(), err)
+	assert.Len(j.T(), jobs, 1)
+	assert.Equal(j.T(), "test-aws-secret", jobs[0].AWSCredentialsSecret)
+}
+
+func (j *jobSuite) TestCreateJobWithHTTPHeadersSecret() {
+	id := types.UID("test-create-with-http-headers-secret")
+	tj := TraceJob{
+		Name:              "test-create-with-http-headers-secret",
+		ID:                id,
+		Namespace:         testNamespace,
+		Output:            "https://collector.internal/upload",
+		HTTPHeadersSecret: "test-http-headers",
+		HTTPUploadFormat:  "multipart",
+	}
+
+	job, err := j.client.CreateJob(tj)
+	assert.Nil(j.T(), err)
+
+	container := job.Spec.Template.Spec.Containers[0]
+	assert.Contains(j.T(), container.VolumeMounts, apiv1.VolumeMount{Name: "http-headers-secret", MountPath: HTTPHeadersPath, ReadOnly: true})
+	assert.Equal(j.T(), []apiv1.EnvVar{
+		{Name: "KUBECTL_TRACE_HTTP_HEADERS_DIR", Value: HTTPHeadersPath},
+		{Name: "KUBECTL_TRACE_HTTP_UPLOAD_FORMAT", Value: "multipart"},
+	}, container.Env)
+
+	jobs, err := j.client.GetJob(TraceJobFilter{ID: &id})
+	assert.Nil(j.T(), err)
+	assert.Len(j.T(), jobs, 1)
+	assert.Equal(j.T(), "test-http-headers", jobs[0].HTTPHeadersSecret)
+	assert.Equal(j.T(), "multipart", jobs[0].HTTPUploadFormat)
+}
+
+func (j *jobSuite) TestCreateJobOwnsConfigMap() {
+	testJobName := "test-create-owned-config"
+	ttl := int32(3600)
+	_, err := j.client.CreateJob(TraceJob{Name: testJobName, TTL: &ttl})
+	assert.Nil(j.T(), err)
+
+	job, err := j.client.JobClient.Get(context.TODO(), testJobName, metav1.GetOptions{})
+	assert.Nil(j.T(), err)
+	assert.Equal(j.T(), ttl, *job.Spec.TTLSecondsAfterFinished)
+
+	cm, err := j.client.ConfigClient.Get(context.TODO(), testJobName, metav1.GetOptions{})
+	assert.Nil(j.T(), err)
+	assert.Len(j.T(), cm.OwnerReferences, 1)
+	assert.Equal(j.T(), "Job", cm.OwnerReferences[0].Kind)
+	assert.Equal(j.T(), testJobName, cm.OwnerReferences[0].Name)
+}
+
+func (j *jobSuite) TestCreateJobDefaultTTL() {
+	job, err := j.client.CreateJob(TraceJob{Name: "test-create-default-ttl"})
+	assert.Nil(j.T(), err)
+	assert.Equal(j.T(), DefaultTTL, *job.Spec.TTLSecondsAfterFinished)
+}
+
+func (j *jobSuite) TestCreateJobWithResources() {
+	resources, err := ResourceRequirements("", "2", "512Mi", "")
+	assert.Nil(j.T(), err)
+
+	job, err := j.client.CreateJob(TraceJob{Name: "test-create-with-resources", FetchHeaders: true, Resources: resources})
+	assert.Nil(j.T(), err)
+
+	for _, c := range append(job.Spec.Template.Spec.InitContainers, job.Spec.Template.Spec.Containers...) {
+		assert.Equal(j.T(), "100m", c.Resources.Requests.Cpu().String(), c.Name)
+		assert.Equal(j.T(), "2", c.Resources.Limits.Cpu().String(), c.Name)
+		assert.Equal(j.T(), "512Mi", c.Resources.Requests.Memory().String(), c.Name)
+		assert.Equal(j.T(), DefaultMemoryLimit, c.Resources.Limits.Memory().String(), c.Name)
+	}
+}
+
+func (j *jobSuite) TestGetJobByGroup() {
+	group := types.UID("test-group")
+	for _, tj := range []TraceJob{
+		{Name: "test-grouped-1", ID: "1", Group: group},
+		{Name: "test-grouped-2", ID: "2", Group: group},
+		{Name: "test-ungrouped", ID: "3"},
+	} {
+		_, err := j.client.CreateJob(tj)
+		assert.Nil(j.T(), err)
+	}
+
+	jobs, err := j.client.GetJob(TraceJobFilter{Group: &group})
+	assert.Nil(j.T(), err)
+	assert.Len(j.T(), jobs, 2)
+	for _, tj := range jobs {
+		assert.Equal(j.T(), group, tj.Group)
+	}
+}
+
+func (j *jobSuite) TestGetJobDecodesTrace() {
+	id := types.UID("test-decode")
+	_, err := j.client.CreateJob(TraceJob{
+		Name:                "test-decode",
+		ID:                  id,
+		Namespace:           testNamespace,
+		Tracer:              "bpftrace",
+		ProcessSelector:     "exe=ruby",
+		WaitForProcess:      time.Minute,
+		Output:              "stdout",
+		Format:              "json",
+		EventsSink:          "otlp+http://collector:4318",
+		Program:             "kprobe:do_sys_open { @[comm] = count(); }",
+		ProgramArgs:         []string{"1", "2"},
+		ServiceAccount:      "tracer",
+		ImageNameTag:        "runner:latest",
+		InitImageNameTag:    "init:latest",
+		FetchHeaders:        true,
+		GoogleAppSecret:     "gcs-key",
+		Deadline:            600,
+		DeadlineGracePeriod: 30,
+		TTL:                 int32Ptr(60),
+		SecurityProfile:     SecurityProfileRestrictedBPF,
+		Patch:               string(patchMerge),
+		PatchType:           "merge",
+		Resources: apiv1.ResourceRequirements{
+			Requests: apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse("256Mi")},
+		},
+		Target: TraceJobTarget{
+			Node:        "node-a",
+			PodUID:      "pod-uid",
+			ContainerID: "container-id",
+			Pod:         "api-1",
+			Container:   "app",
+			Namespace:   "apps",
+		},
+	})
+	assert.Nil(j.T(), err)
+
+	jobs, err := j.client.GetJob(TraceJobFilter{ID: &id})
+	assert.Nil(j.T(), err)
+	assert.Len(j.T(), jobs, 1)
+
+	tj := jobs[0]
+	assert.Equal(j.T(), "bpftrace", tj.Tracer)
+	assert.Equal(j.T(), "exe=ruby", tj.ProcessSelector)
+	assert.Equal(j.T(), time.Minute, tj.WaitForProcess)
+	assert.Equal(j.T(), "stdout", tj.Output)
+	assert.Equal(j.T(), "json", tj.Format)
+	assert.Equal(j.T(), "otlp+http://collector:4318", tj.EventsSink)
+	assert.Equal(j.T(), "kprobe:do_sys_open { @[comm] = count(); }", tj.Program)
+	assert.Equal(j.T(), []string{"1", "2"}, tj.ProgramArgs)
+	assert.Equal(j.T(), "tracer", tj.ServiceAccount)
+	assert.Equal(j.T(), "runner:latest", tj.ImageNameTag)
+	assert.Equal(j.T(), "init:latest", tj.InitImageNameTag)
+	assert.True(j.T(), tj.FetchHeaders)
+	assert.Equal(j.T(), "gcs-key", tj.GoogleAppSecret)
+	assert.Equal(j.T(), int64(600), tj.Deadline)
+	assert.Equal(j.T(), int64(30), tj.DeadlineGracePeriod)
+	assert.Equal(j.T(), int32Ptr(60), tj.TTL)
+	assert.Equal(j.T(), SecurityProfileRestrictedBPF, tj.SecurityProfile)
+	assert.Equal(j.T(), string(patchMerge), tj.Patch)
+	assert.Equal(j.T(), "merge", tj.PatchType)
+	assert.Equal(j.T(), "256Mi", tj.Resources.Requests.Memory().String())
+	assert.Equal(j.T(), TraceJobTarget{
+		Node:        "node-a",
+		PodUID:      "pod-uid",
+		ContainerID: "container-id",
+		Pod:         "api-1",
+		Container:   "app",
+		Namespace:   "apps",
+	}, tj.Target)
+
+	obj := tj.Object()
+	assert.Equal(j.T(), "pod/api-1", obj.Spec.Resource)
+	assert.Equal(j.T(), "app", obj.Spec.Container)
+	assert.Equal(j.T(), "apps", obj.Spec.TargetNamespace)
+	assert.Equal(j.T(), time.Minute, obj.Spec.WaitForProcess.Duration)
+	assert.Equal(j.T(), "256Mi", obj.Spec.Resources.Requests.Memory().String())
+	assert.Equal(j.T(), "json", obj.Spec.Format)
+	assert.Equal(j.T(), "otlp+http://collector:4318", obj.Spec.EventsSink)
+	assert.Equal(j.T(), "node-a", obj.Status.Node)
+	assert.Equal(j.T(), id, obj.Status.TraceID)
+}
+
+func (j *jobSuite) TestGetJobDecodesTraceCommand() {
+	id := types.UID("test-decode-command")
+	job, err := j.client.CreateJob(TraceJob{
+		Name:                "test-decode-command",
+		ID:                  id,
+		Tracer:              "bpftrace",
+		ProcessSelector:     "pid=1",
+		WaitForProcess:      30 * time.Second,
+		Output:              "stdout",
+		Format:              "json",
+		EventsSink:          "file:///tmp/events.jsonl",
+		Deadline:            600,
+		DeadlineGracePeriod: 30,
+		Target:              TraceJobTarget{PodUID: "pod-uid", ContainerID: "container-id", Container: "app"},
+	})
+	assert.Nil(j.T(), err)
+	assert.Contains(j.T(), job.Spec.Template.Spec.Containers[0].Command, "--container-name=app")
+	assert.Contains(j.T(), job.Spec.Template.Spec.Containers[0].Command, "--format=json")
+	assert.Contains(j.T(), job.Spec.Template.Spec.Containers[0].Command, "--events-sink=file:///tmp/events.jsonl")
+
+	// Jobs created before the spec was persisted have no spec annotation.
+	delete(job.Annotations, meta.TraceSpecAnnotationKey)
+	_, err = j.client.JobClient.Update(context.TODO(), job, metav1.UpdateOptions{})
+	assert.Nil(j.T(), err)
+
+	jobs, err := j.client.GetJob(TraceJobFilter{ID: &id})
+	assert.Nil(j.T(), err)
+	assert.Len(j.T(), jobs, 1)
+	assert.Equal(j.T(), "bpftrace", jobs[0].Tracer)
+	assert.Equal(j.T(), "pid=1", jobs[0].ProcessSelector)
+	assert.Equal(j.T(), 30*time.Second, jobs[0].WaitForProcess)
+	assert.Equal(j.T(), "stdout", jobs[0].Output)
+	assert.Equal(j.T(), "json", jobs[0].Format)
+	assert.Equal(j.T(), "file:///tmp/events.jsonl", jobs[0].EventsSink)
+	assert.Equal(j.T(), int64(600), jobs[0].Deadline)
+	assert.Equal(j.T(), int64(30), jobs[0].DeadlineGracePeriod)
+	assert.Equal(j.T(), "pod-uid", jobs[0].Target.PodUID)
+	assert.Equal(j.T(), "container-id", jobs[0].Target.ContainerID)
+	assert.Equal(j.T(), "app", jobs[0].Target.Container)
+}
+
+func TestCreateJobConfigMapFailure(t *testing.T) {
+	tests := map[string]struct {
+		verb     string
+		leftover bool
+	}{
+		"create fails":             {verb: "create"},
+		"update of leftover fails": {verb: "update", leftover: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			tc := NewTraceJobClient(clientset, testNamespace)
+			if tt.leftover {
+				_, err := tc.ConfigClient.Create(context.TODO(), &apiv1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test-cm-failure"}}, metav1.CreateOptions{})
+				require.NoError(t, err)
+			}
+			clientset.PrependReactor(tt.verb, "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, apierrors.NewInternalError(fmt.Errorf("etcd unavailable"))
+			})
+
+			_, err := tc.CreateJob(TraceJob{Name: "test-cm-failure"})
+			assert.EqualError(t, err, "could not create trace configuration test-cm-failure: Internal error occurred: etcd unavailable")
+
+			jobs, err := tc.JobClient.List(context.TODO(), metav1.ListOptions{})
+			require.NoError(t, err)
+			assert.Empty(t, jobs.Items, "the job of the trace is left running")
+		})
+	}
+}
+
+func TestCreateJobOwnsLeftoverConfigMap(t *testing.T) {
+	tc := NewTraceJobClient(fake.NewSimpleClientset(), testNamespace)
+	_, err := tc.ConfigClient.Create(context.TODO(), &apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-leftover"},
+		Data:       map[string]string{"program.bt": "old"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	_, err = tc.CreateJob(TraceJob{Name: "test-leftover", Program: "new"})
+	require.NoError(t, err)
+
+	cm, err := tc.ConfigClient.Get(context.TODO(), "test-leftover", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "new", cm.Data["program.bt"])
+	require.Len(t, cm.OwnerReferences, 1)
+	assert.Equal(t, "Job", cm.OwnerReferences[0].Kind)
+}
+
+func TestDeleteJobsConfigMapAlreadyDeleted(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	tc := NewTraceJobClient(clientset, testNamespace)
+	tc.WithOutStream(ioutil.Discard)
+	group := types.UID("test-group")
+	for _, tj := range []TraceJob{
+		{Name: "test-delete-1", ID: "1", Group: group},
+		{Name: "test-delete-2", ID: "2", Group: group},
+	} {
+		_, err := tc.CreateJob(tj)
+		require.NoError(t, err)
+	}
+	// The garbage collector deletes the configurations owned by the jobs deleted in the foreground.
+	clientset.PrependReactor("delete", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		name := action.(k8stesting.DeleteAction).GetName()
+		return true, nil, apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+	})
+
+	require.NoError(t, tc.DeleteJobs(TraceJobFilter{Group: &group}))
+	jobs, err := tc.JobClient.List(context.TODO(), metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, jobs.Items)
+}
+
+func TestGroupTraceJobs(t *testing.T) {
+	earlier := metav1.NewTime(time.Now().Add(-time.Hour))
+	later := metav1.NewTime(time.Now())
+
+	tjs := []TraceJob{
+		{ID: "1", Group: "a", Namespace: testNamespace, Status: TraceJobRunning, StartTime: &later},
+		{ID: "2", Group: "a", Namespace: testNamespace, Status: TraceJobCompleted, StartTime: &earlier},
+		{ID: "3", Namespace: testNamespace, Status: TraceJobRunning},
+		{ID: "4", Group: "b", Namespace: testNamespace, Status: TraceJobCompleted},
+		{ID: "5", Group: "b", Namespace: testNamespace, Status: TraceJobFailed},
+		{ID: "6", Group: "c", Namespace: testNamespace, Status: TraceJobCompleted},
+	}
+
+	groups := GroupTraceJobs(tjs)
+	assert.Len(t, groups, 3)
+
+	assert.Equal(t, TraceGroup{ID: "a", Namespace: testNamespace, Traces: 2, Running: 1, Completed: 1, StartTime: &earlier}, groups[0])
+	assert.Equal(t, TraceJobRunning, groups[0].Status())
+	assert.Equal(t, TraceJobFailed, groups[1].Status())
+	assert.Equal(t, TraceJobCompleted, groups[2].Status())
+}
+
+func TestResourceRequirements(t *testing.T) {
+	tests := []struct {
+		name          string
+		cpuRequest    string
+		cpuLimit      string
+		memoryRequest string
+		memoryLimit   string
+		expected      string
+		expectedErr   string
+	}{
+		{name: "defaults", expected: "100m/1 100Mi/1G"},
+		{name: "overridden", cpuRequest: "10m", cpuLimit: "500m", memoryRequest: "1Gi", memoryLimit: "4Gi", expected: "10m/500m 1Gi/4Gi"},
+		{name: "invalid quantity", memoryLimit: "lots", expectedErr: `invalid memory limit "lots"`},
+		{name: "request greater than limit", memoryRequest: "2G", expectedErr: "the memory request 2G is greater than its limit 1G"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ResourceRequirements(tt.cpuRequest, tt.cpuLimit, tt.memoryRequest, tt.memoryLimit)
+			if tt.expectedErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+				return
+			}
+			assert.Nil(t, err)
+			actual := r.Requests.Cpu().String() + "/" + r.Limits.Cpu().String() + " " + r.Requests.Memory().String() + "/" + r.Limits.Memory().String()
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package tracejob
+
+import (
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/apis/trace/v1alpha1"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Object represents the trace job as a TraceJob resource, to be printed like any other Kubernetes object.
+func (nj *TraceJob) Object() *v1alpha1.TraceJob {
+	obj := &v1alpha1.TraceJob{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       v1alpha1.Kind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nj.Name,
+			Namespace: nj.Namespace,
+			UID:       nj.ID,
+		},
+		Spec: v1alpha1.TraceJobSpec{
+			Resource:             nj.Target.Resource(),
+			Container:            nj.Target.Container,
+			TargetNamespace:      nj.Target.Namespace,
+			Tracer:               nj.Tracer,
+			ProcessSelector:      nj.ProcessSelector,
+			WaitForProcess:       waitForProcess(nj.WaitForProcess),
+			Output:               nj.Output,
+			Program:              nj.Program,
+			ProgramArgs:          nj.ProgramArgs,
+			ServiceAccount:       nj.ServiceAccount,
+			ImageNameTag:         nj.ImageNameTag,
+			InitImageNameTag:     nj.InitImageNameTag,
+			FetchHeaders:         nj.FetchHeaders,
+			Deadline:             nj.Deadline,
+			DeadlineGracePeriod:  nj.DeadlineGracePeriod,
+			TTL:                  nj.TTL,
+			SecurityProfile:      string(nj.SecurityProfile),
+			GoogleAppSecret:      nj.GoogleAppSecret,
+			AWSCredentialsSecret: nj.AWSCredentialsSecret,
+			HTTPHeadersSecret:    nj.HTTPHeadersSecret,
+			HTTPUploadFormat:     nj.HTTPUploadFormat,
+			Format:               nj.Format,
+			EventsSink:           nj.EventsSink,
+		},
+		Status: v1alpha1.TraceJobStatus{
+			Phase:     v1alpha1.TraceJobPhase(nj.Status),
+			TraceID:   nj.ID,
+			JobName:   nj.Name,
+			Node:      nj.Target.Node,
+			StartTime: nj.StartTime,
+		},
+	}
+
+	if len(nj.Resources.Requests) > 0 || len(nj.Resources.Limits) > 0 {
+		obj.Spec.Resources = nj.Resources.DeepCopy()
+	}
+
+	if nj.Group != "" {
+		obj.Labels = map[string]string{meta.TraceGroupLabelKey: string(nj.Group)}
+	}
+
+	if obj.Status.Phase == "" {
+		obj.Status.Phase = v1alpha1.TraceJobUnknown
+	}
+
+	return obj
+}
+
+func waitForProcess(d time.Duration) *metav1.Duration {
+	if d == 0 {
+		return nil
+	}
+	return &metav1.Duration{Duration: d}
+}
+
+// ObjectList represents trace jobs as a list of TraceJob resources.
+func ObjectList(tjs []TraceJob) *v1alpha1.TraceJobList {
+	list := &v1alpha1.TraceJobList{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       v1alpha1.Kind + "List",
+		},
+		Items: make([]v1alpha1.TraceJob, 0, len(tjs)),
+	}
+	for i := range tjs {
+		list.Items = append(list.Items, *tjs[i].Object())
+	}
+	return list
+}
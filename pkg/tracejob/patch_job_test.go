@@ -75,3 +75,18 @@ func getJob() *batchv1.Job {
 		},
 	}
 }
+
+func TestManifestsPatched(t *testing.T) {
+	nj := TraceJob{Name: "kubectl-trace-1", ID: "1", Tracer: "bpftrace", Program: "BEGIN {}", Patch: string(patchMerge), PatchType: "merge"}
+
+	job, cm, err := nj.Manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *job.Spec.BackoffLimit != 123 || !job.Spec.Template.Spec.HostPID || job.Spec.Completions != nil {
+		t.Errorf("job not patched: %+v", job.Spec)
+	}
+	if cm.Data["program.bt"] != "BEGIN {}" {
+		t.Errorf("unexpected config map data: %v", cm.Data)
+	}
+}
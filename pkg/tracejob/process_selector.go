@@ -2,67 +2,303 @@ package tracejob
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 )
 
+// Operator is the relation between a label of a process and the values of a requirement.
+type Operator string
+
+// These are the operators of a process selector, as in label queries.
+const (
+	// Equals is label=value.
+	Equals Operator = "="
+	// NotEquals is label!=value.
+	NotEquals Operator = "!="
+	// Matches is label=~regexp, the regular expression being unanchored.
+	Matches Operator = "=~"
+	// In is label in (value1,value2).
+	In Operator = "in"
+	// NotIn is label notin (value1,value2).
+	NotIn Operator = "notin"
+	// Exists is label, the process has a non empty value for it.
+	Exists Operator = "exists"
+	// DoesNotExist is !label, the process has no value for it.
+	DoesNotExist Operator = "!"
+)
+
+// processLabel tells how the values of a label of processes are compared.
+type processLabel struct {
+	// substring labels match the values they contain, the others the values they are equal to.
+	substring bool
+	// numeric labels only have numbers as values.
+	numeric bool
+	// multiValued labels have many values per process, one per line, and match when any of them does.
+	multiValued bool
+}
+
+// processLabels are the labels a process selector can use, besides pid.
+var processLabels = map[string]processLabel{
+	"exe":     {substring: true},
+	"comm":    {substring: true},
+	"cmdline": {substring: true},
+	"cgroup":  {substring: true},
+	"ppid":    {numeric: true},
+	"uid":     {numeric: true},
+	"user":    {},
+	"env":     {multiValued: true},
+	"port":    {numeric: true, multiValued: true},
+}
+
+// ProcessLabels are the labels a process selector can use, besides pid.
+func ProcessLabels() []string {
+	labels := []string{}
+	for l := range processLabels {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+var setTermRegexp = regexp.MustCompile(`^([A-Za-z_]+)\s+(in|notin)\s*\((.*)\)$`)
+
+// Requirement is a term of a process selector.
+type Requirement struct {
+	Label    string
+	Operator Operator
+	Values   []string
+
+	regexp *regexp.Regexp
+}
+
+// Matches tells whether value, the value of the label for a process, satisfies the requirement.
+// The values of exe, comm, cmdline and cgroup match when they are contained in value.
+// The values of env and port are lines, and the requirement is satisfied when one of them matches.
+func (r Requirement) Matches(value string) bool {
+	values := []string{}
+	if processLabels[r.Label].multiValued {
+		for _, v := range strings.Split(value, "\n") {
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+	} else if value != "" {
+		values = append(values, value)
+	}
+
+	switch r.Operator {
+	case Equals, In:
+		return r.matchesAny(values)
+	case NotEquals, NotIn:
+		return !r.matchesAny(values)
+	case Matches:
+		for _, v := range values {
+			if r.regexp.MatchString(v) {
+				return true
+			}
+		}
+		return false
+	case Exists:
+		return len(values) > 0
+	case DoesNotExist:
+		return len(values) == 0
+	}
+	return false
+}
+
+func (r Requirement) matchesAny(values []string) bool {
+	substring := processLabels[r.Label].substring
+	for _, value := range values {
+		for _, v := range r.Values {
+			if (substring && strings.Contains(value, v)) || value == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r Requirement) String() string {
+	switch r.Operator {
+	case In, NotIn:
+		return fmt.Sprintf("%s %s (%s)", r.Label, r.Operator, strings.Join(r.Values, ","))
+	case Exists:
+		return r.Label
+	case DoesNotExist:
+		return "!" + r.Label
+	}
+	return r.Label + string(r.Operator) + r.Values[0]
+}
+
 // ProcessSelector represents a selector-like label query to select the target process
 // within the container namespace.
 type ProcessSelector struct {
-	// label -> value, values cannot contain spaces.
-	// Assumes equality match, will be changed when more operators added.
-	terms map[string]string
+	// pid is the value of the pid term, which is always an equality.
+	pid          string
+	requirements []Requirement
 }
 
 // NewProcessSelector will construct a selector by parsing the query.
+// Its terms are separated by commas, and are one of label=value, label!=value, label=~regexp,
+// label in (value1,value2), label notin (value1,value2), label and !label.
 func NewProcessSelector(query string) (*ProcessSelector, error) {
-	s := &ProcessSelector{
-		terms: map[string]string{},
-	}
+	s := &ProcessSelector{}
 
 	query = strings.TrimSpace(query)
 	if len(query) == 0 {
 		return s, nil
 	}
 
-	terms := strings.Split(query, ",")
-	for _, t := range terms {
-		seg := strings.Split(t, "=")
-		if len(seg) != 2 {
-			return nil, fmt.Errorf("invalid term in selector at %s", t)
+	for _, t := range splitTerms(query) {
+		t = strings.TrimSpace(t)
+		r, err := parseRequirement(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid term in selector at %s: %v", t, err)
 		}
-
-		label, value := strings.TrimSpace(seg[0]), strings.TrimSpace(seg[1])
-		s.terms[label] = value
+		if r.Label == "pid" {
+			if s.pid != "" {
+				return nil, fmt.Errorf("invalid term in selector at %s: pid can only be given once", t)
+			}
+			s.pid = r.Values[0]
+			continue
+		}
+		s.requirements = append(s.requirements, r)
 	}
 
 	return s, nil
 }
 
-func (s *ProcessSelector) String() string {
-	elems := []string{}
-	for k, v := range s.terms {
-		elems = append(elems, fmt.Sprintf("%s=%s", k, v))
+// splitTerms splits query at the commas which are not within parentheses, brackets or braces,
+// so that sets and regular expressions may contain commas.
+func splitTerms(query string) []string {
+	terms := []string{}
+	depth, start := 0, 0
+	for i, c := range query {
+		switch c {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, query[start:i])
+				start = i + 1
+			}
+		}
 	}
-	return strings.Join(elems, ",")
+	return append(terms, query[start:])
 }
 
-func (s *ProcessSelector) Pid() (string, bool) {
-	return s.get("pid")
+func parseRequirement(term string) (Requirement, error) {
+	if term == "" {
+		return Requirement{}, fmt.Errorf("empty term")
+	}
+
+	var r Requirement
+	if m := setTermRegexp.FindStringSubmatch(term); m != nil {
+		r = Requirement{Label: m[1], Operator: Operator(m[2])}
+		for _, v := range strings.Split(m[3], ",") {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				return r, fmt.Errorf("empty value in set")
+			}
+			r.Values = append(r.Values, v)
+		}
+	} else if i := strings.Index(term, "="); i >= 0 {
+		label, value := term[:i], term[i+1:]
+		r.Operator = Equals
+		switch {
+		case strings.HasSuffix(label, "!"):
+			label, r.Operator = strings.TrimSuffix(label, "!"), NotEquals
+		case strings.HasPrefix(value, "~"):
+			value, r.Operator = strings.TrimPrefix(value, "~"), Matches
+		}
+		r.Label, value = strings.TrimSpace(label), strings.TrimSpace(value)
+		if value == "" {
+			return r, fmt.Errorf("empty value")
+		}
+		if r.Operator != Matches && strings.ContainsAny(value, " \t") {
+			return r, fmt.Errorf("values cannot contain spaces")
+		}
+		r.Values = []string{value}
+	} else if strings.HasPrefix(term, "!") {
+		r = Requirement{Label: strings.TrimSpace(strings.TrimPrefix(term, "!")), Operator: DoesNotExist}
+	} else {
+		r = Requirement{Label: term, Operator: Exists}
+	}
+
+	if r.Label == "pid" {
+		if r.Operator != Equals {
+			return r, fmt.Errorf("pid only supports the = operator")
+		}
+		if !validPid(r.Values[0]) {
+			return r, fmt.Errorf("pid must be a number, last or all")
+		}
+		return r, nil
+	}
+	label, ok := processLabels[r.Label]
+	if !ok {
+		return r, fmt.Errorf("unknown label %q, must be one of pid, %s", r.Label, strings.Join(ProcessLabels(), ", "))
+	}
+	if label.numeric && r.Operator != Matches {
+		for _, v := range r.Values {
+			if !isNumber(v) {
+				return r, fmt.Errorf("%s must be a number", r.Label)
+			}
+		}
+	}
+	if r.Operator == Matches {
+		re, err := regexp.Compile(r.Values[0])
+		if err != nil {
+			return r, fmt.Errorf("invalid regular expression: %v", err)
+		}
+		r.regexp = re
+	}
+	return r, nil
+}
+
+func validPid(pid string) bool {
+	return pid == "last" || pid == "all" || isNumber(pid)
+}
+
+func isNumber(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
 }
 
-func (s *ProcessSelector) Exe() (string, bool) {
-	return s.get("exe")
+func (s *ProcessSelector) String() string {
+	elems := []string{}
+	if s.pid != "" {
+		elems = append(elems, "pid="+s.pid)
+	}
+	for _, r := range s.requirements {
+		elems = append(elems, r.String())
+	}
+	return strings.Join(elems, ",")
 }
 
-func (s *ProcessSelector) Comm() (string, bool) {
-	return s.get("comm")
+func (s *ProcessSelector) Pid() (string, bool) {
+	return s.pid, s.pid != ""
 }
 
-func (s *ProcessSelector) Cmdline() (string, bool) {
-	return s.get("cmdline")
+// Requirements returns the terms of the selector filtering processes by their labels, that is all but pid.
+func (s *ProcessSelector) Requirements() []Requirement {
+	return s.requirements
 }
 
-func (s *ProcessSelector) get(label string) (string, bool) {
-	value, ok := s.terms[label]
-	return value, ok
+// ValidateSelectorForTracer checks that selector selects the process tracer needs, as the rbspy and fake
+// tracers trace processes rather than the whole container or node, and need a pid.
+func ValidateSelectorForTracer(tracer string, selector *ProcessSelector) error {
+	switch tracer {
+	case "rbspy", "fake":
+		if _, ok := selector.Pid(); !ok {
+			return fmt.Errorf("a pid process selector must be specified for tracer %s", tracer)
+		}
+	}
+	return nil
 }
@@ -4,18 +4,35 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewSelector(t *testing.T) {
-	expected := &ProcessSelector{
-		terms: map[string]string{
-			"pid":  "last",
-			"comm": "foobar",
-		},
-	}
+	parsed, err := NewProcessSelector("comm=foobar, pid=last")
+	require.NoError(t, err)
+
+	pid, ok := parsed.Pid()
+	assert.True(t, ok)
+	assert.Equal(t, "last", pid)
+	assert.Equal(t, []Requirement{{Label: "comm", Operator: Equals, Values: []string{"foobar"}}}, parsed.Requirements())
+	assert.Equal(t, "pid=last,comm=foobar", parsed.String())
+}
+
+func TestNewSelectorOperators(t *testing.T) {
+	parsed, err := NewProcessSelector("pid=last, exe!=/bin/sh, cmdline=~worker-[0-9]{1,2}, comm in (unicorn, puma), comm notin (ruby), exe, !cmdline")
+	require.NoError(t, err)
 
-	parsed, _ := NewProcessSelector("comm=foobar, pid=last")
-	assert.Equal(t, expected, parsed)
+	reqs := parsed.Requirements()
+	require.Len(t, reqs, 6)
+	assert.Equal(t, NotEquals, reqs[0].Operator)
+	assert.Equal(t, Matches, reqs[1].Operator)
+	assert.Equal(t, []string{"worker-[0-9]{1,2}"}, reqs[1].Values)
+	assert.Equal(t, In, reqs[2].Operator)
+	assert.Equal(t, []string{"unicorn", "puma"}, reqs[2].Values)
+	assert.Equal(t, NotIn, reqs[3].Operator)
+	assert.Equal(t, Exists, reqs[4].Operator)
+	assert.Equal(t, DoesNotExist, reqs[5].Operator)
+	assert.Equal(t, "pid=last,exe!=/bin/sh,cmdline=~worker-[0-9]{1,2},comm in (unicorn,puma),comm notin (ruby),exe,!cmdline", parsed.String())
 }
 
 func TestNewSelectorError(t *testing.T) {
@@ -23,4 +40,78 @@ func TestNewSelectorError(t *testing.T) {
 	assert.NotNil(t, err)
 	_, err = NewProcessSelector("pid=last,, comm=foobar")
 	assert.NotNil(t, err)
+
+	tests := map[string]string{
+		"group=root":          `invalid term in selector at group=root: unknown label "group", must be one of pid, cgroup, cmdline, comm, env, exe, port, ppid, uid, user`,
+		"pid!=1":              "invalid term in selector at pid!=1: pid only supports the = operator",
+		"pid=first":           "invalid term in selector at pid=first: pid must be a number, last or all",
+		"pid=1,pid=2":         "invalid term in selector at pid=2: pid can only be given once",
+		"comm=~(":             "invalid term in selector at comm=~(: invalid regular expression: error parsing regexp: missing closing ): `(`",
+		"comm in (a,)":        "invalid term in selector at comm in (a,): empty value in set",
+		"exe=":                "invalid term in selector at exe=: empty value",
+		"cmdline=ruby app":    "invalid term in selector at cmdline=ruby app: values cannot contain spaces",
+		"comm in (a), !group": `invalid term in selector at !group: unknown label "group", must be one of pid, cgroup, cmdline, comm, env, exe, port, ppid, uid, user`,
+		"port in (80,http)":   "invalid term in selector at port in (80,http): port must be a number",
+		"uid=root":            "invalid term in selector at uid=root: uid must be a number",
+	}
+	for query, expected := range tests {
+		_, err := NewProcessSelector(query)
+		assert.EqualError(t, err, expected, query)
+	}
+}
+
+func TestRequirementMatches(t *testing.T) {
+	tests := []struct {
+		query    string
+		value    string
+		expected bool
+	}{
+		{"exe=ruby", "/usr/bin/ruby2.7", true},
+		{"exe=python", "/usr/bin/ruby2.7", false},
+		{"exe!=ruby", "/usr/bin/ruby2.7", false},
+		{"exe!=python", "/usr/bin/ruby2.7", true},
+		{"cmdline=~^unicorn worker\\[[0-9]+\\]", "unicorn worker[3] -c config.rb", true},
+		{"cmdline=~^unicorn worker\\[[0-9]+\\]", "unicorn master -c config.rb", false},
+		{"comm in (puma,unicorn)", "unicorn", true},
+		{"comm in (puma,unicorn)", "ruby", false},
+		{"comm notin (puma,unicorn)", "ruby", true},
+		{"comm notin (puma,unicorn)", "puma", false},
+		{"exe", "/usr/bin/ruby", true},
+		{"exe", "", false},
+		{"!exe", "", true},
+		{"!exe", "/usr/bin/ruby", false},
+		{"uid=1000", "1000", true},
+		{"uid=1", "1000", false},
+		{"ppid=1", "1", true},
+		{"user in (app,www-data)", "app", true},
+		{"cgroup=kubepods", "0::/kubepods/burstable/pod1/abc", true},
+		{"env=RAILS_ENV=production", "HOME=/app\nRAILS_ENV=production", true},
+		{"env=RAILS_ENV=production", "HOME=/app\nRAILS_ENV=staging", false},
+		{"env!=RAILS_ENV=production", "HOME=/app\nRAILS_ENV=staging", true},
+		{"env=~^RAILS_ENV=", "HOME=/app\nRAILS_ENV=staging", true},
+		{"port=8080", "80\n8080", true},
+		{"port=80", "8080", false},
+		{"port", "", false},
+		{"!port", "", true},
+	}
+	for _, tt := range tests {
+		s, err := NewProcessSelector(tt.query)
+		require.NoError(t, err, tt.query)
+		assert.Equal(t, tt.expected, s.Requirements()[0].Matches(tt.value), "%s on %s", tt.query, tt.value)
+	}
+}
+
+func TestValidateSelectorForTracer(t *testing.T) {
+	withPid, err := NewProcessSelector("pid=last,comm=ruby")
+	require.NoError(t, err)
+	withoutPid, err := NewProcessSelector("comm=ruby")
+	require.NoError(t, err)
+
+	for _, tracer := range []string{"bpftrace", "bcc"} {
+		assert.NoError(t, ValidateSelectorForTracer(tracer, withoutPid), tracer)
+	}
+	for _, tracer := range []string{"rbspy", "fake"} {
+		assert.NoError(t, ValidateSelectorForTracer(tracer, withPid), tracer)
+		assert.EqualError(t, ValidateSelectorForTracer(tracer, withoutPid), "a pid process selector must be specified for tracer "+tracer)
+	}
 }
@@ -0,0 +1,98 @@
+package tracejob
+
+import (
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// SecurityProfile tells which privileges the trace container is given.
+type SecurityProfile string
+
+const (
+	// SecurityProfilePrivileged runs the trace container fully privileged, in the host PID namespace.
+	SecurityProfilePrivileged SecurityProfile = "privileged"
+	// SecurityProfileRestrictedBPF only gives the trace container the capabilities its tracer needs,
+	// under the runtime default seccomp and AppArmor profiles, and only shares the host PID namespace
+	// when a process has to be found.
+	SecurityProfileRestrictedBPF SecurityProfile = "restricted-bpf"
+)
+
+// SecurityProfiles are the supported security profiles.
+var SecurityProfiles = []SecurityProfile{SecurityProfilePrivileged, SecurityProfileRestrictedBPF}
+
+// ParseSecurityProfile parses the name of a security profile, the empty name being the privileged profile.
+func ParseSecurityProfile(s string) (SecurityProfile, error) {
+	if s == "" {
+		return SecurityProfilePrivileged, nil
+	}
+	for _, p := range SecurityProfiles {
+		if SecurityProfile(s) == p {
+			return p, nil
+		}
+	}
+
+	names := make([]string, 0, len(SecurityProfiles))
+	for _, p := range SecurityProfiles {
+		names = append(names, string(p))
+	}
+	return "", fmt.Errorf("unknown security profile %s, must be one of %s", s, strings.Join(names, ", "))
+}
+
+// needsHostPID tells whether the trace runner has to look for a process in the host /proc:
+// to trace a container, to apply a process selector, or for the tracers attaching to a pid.
+func (nj *TraceJob) needsHostPID() bool {
+	switch nj.Tracer {
+	case "bpftrace", "bcc", "":
+		return nj.Target.PodUID != "" || nj.ProcessSelector != ""
+	default:
+		return true
+	}
+}
+
+// capabilities returns the capabilities the tracer of nj needs.
+func (nj *TraceJob) capabilities() []apiv1.Capability {
+	var caps []apiv1.Capability
+	switch nj.Tracer {
+	case "bpftrace", "bcc", "":
+		// Loading programs, attaching them to perf events and locking the memory of their maps.
+		caps = []apiv1.Capability{"BPF", "PERFMON", "SYS_RESOURCE"}
+		if nj.needsHostPID() {
+			caps = append(caps, "SYS_PTRACE")
+		}
+	default:
+		// The other tracers read the memory of the traced process.
+		caps = []apiv1.Capability{"SYS_PTRACE"}
+	}
+	return caps
+}
+
+// restrictJob replaces the privileges of the trace container of job by the ones its tracer needs.
+func (nj *TraceJob) restrictJob(job *batchv1.Job) {
+	spec := &job.Spec.Template.Spec
+	spec.HostPID = nj.needsHostPID()
+	spec.SecurityContext = &apiv1.PodSecurityContext{
+		SeccompProfile: &apiv1.SeccompProfile{Type: apiv1.SeccompProfileTypeRuntimeDefault},
+	}
+
+	c := &spec.Containers[0]
+	c.SecurityContext = &apiv1.SecurityContext{
+		Privileged:               boolPtr(false),
+		AllowPrivilegeEscalation: boolPtr(false),
+		Capabilities: &apiv1.Capabilities{
+			Drop: []apiv1.Capability{"ALL"},
+			Add:  nj.capabilities(),
+		},
+	}
+
+	annotations := map[string]string{}
+	for k, v := range job.Spec.Template.Annotations {
+		annotations[k] = v
+	}
+	for _, c := range append(spec.InitContainers, spec.Containers...) {
+		annotations[apiv1.AppArmorBetaContainerAnnotationKeyPrefix+c.Name] = apiv1.AppArmorBetaProfileRuntimeDefault
+	}
+	job.Spec.Template.Annotations = annotations
+}
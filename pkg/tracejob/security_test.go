@@ -0,0 +1,90 @@
+package tracejob
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestParseSecurityProfile(t *testing.T) {
+	p, err := ParseSecurityProfile("")
+	require.NoError(t, err)
+	assert.Equal(t, SecurityProfilePrivileged, p)
+
+	p, err = ParseSecurityProfile("restricted-bpf")
+	require.NoError(t, err)
+	assert.Equal(t, SecurityProfileRestrictedBPF, p)
+
+	_, err = ParseSecurityProfile("unconfined")
+	assert.EqualError(t, err, "unknown security profile unconfined, must be one of privileged, restricted-bpf")
+}
+
+func TestJobPrivileged(t *testing.T) {
+	job := (&TraceJob{Name: "kubectl-trace-1", Tracer: "bpftrace"}).Job()
+
+	spec := job.Spec.Template.Spec
+	assert.True(t, spec.HostPID)
+	assert.True(t, *spec.Containers[0].SecurityContext.Privileged)
+	assert.Nil(t, spec.SecurityContext)
+}
+
+func TestJobRestrictedBPF(t *testing.T) {
+	podTarget := TraceJobTarget{Node: "node-a", PodUID: "pod-uid", ContainerID: "container-id"}
+
+	tests := []struct {
+		name            string
+		tj              TraceJob
+		expectedHostPID bool
+		expectedCaps    []apiv1.Capability
+	}{
+		{
+			name:         "bpftrace on a node",
+			tj:           TraceJob{Tracer: "bpftrace", Target: TraceJobTarget{Node: "node-a"}},
+			expectedCaps: []apiv1.Capability{"BPF", "PERFMON", "SYS_RESOURCE"},
+		},
+		{
+			name:            "bpftrace on a pod",
+			tj:              TraceJob{Tracer: "bpftrace", Target: podTarget},
+			expectedHostPID: true,
+			expectedCaps:    []apiv1.Capability{"BPF", "PERFMON", "SYS_RESOURCE", "SYS_PTRACE"},
+		},
+		{
+			name:            "bcc with a process selector",
+			tj:              TraceJob{Tracer: "bcc", ProcessSelector: "exe=ruby", Target: TraceJobTarget{Node: "node-a"}},
+			expectedHostPID: true,
+			expectedCaps:    []apiv1.Capability{"BPF", "PERFMON", "SYS_RESOURCE", "SYS_PTRACE"},
+		},
+		{
+			name:            "rbspy",
+			tj:              TraceJob{Tracer: "rbspy", ProcessSelector: "pid=1", Target: podTarget},
+			expectedHostPID: true,
+			expectedCaps:    []apiv1.Capability{"SYS_PTRACE"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.tj.Name = "kubectl-trace-1"
+			tt.tj.FetchHeaders = true
+			tt.tj.SecurityProfile = SecurityProfileRestrictedBPF
+			job := tt.tj.Job()
+
+			spec := job.Spec.Template.Spec
+			assert.Equal(t, tt.expectedHostPID, spec.HostPID)
+			assert.Equal(t, apiv1.SeccompProfileTypeRuntimeDefault, spec.SecurityContext.SeccompProfile.Type)
+
+			sc := spec.Containers[0].SecurityContext
+			assert.False(t, *sc.Privileged)
+			assert.False(t, *sc.AllowPrivilegeEscalation)
+			assert.Equal(t, []apiv1.Capability{"ALL"}, sc.Capabilities.Drop)
+			assert.Equal(t, tt.expectedCaps, sc.Capabilities.Add)
+
+			annotations := job.Spec.Template.Annotations
+			assert.Equal(t, "runtime/default", annotations["container.apparmor.security.beta.kubernetes.io/kubectl-trace-1"])
+			assert.Equal(t, "runtime/default", annotations["container.apparmor.security.beta.kubernetes.io/kubectl-trace-init"])
+			assert.NotContains(t, job.Annotations, "container.apparmor.security.beta.kubernetes.io/kubectl-trace-1")
+		})
+	}
+}
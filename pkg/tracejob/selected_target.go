@@ -6,7 +6,7 @@ We have two ways of specifying the thing we actually want to trace:
 
 - From a literal target resource ( run.go 's o.resourceArg, taken from arg[0])
   - resourceArg is overloaded, it can be either the node, or the pod which we would like to trace
-    - In the future, it may be other types, eg, deployment/NAME, or statefulset/NAME, etc.
+    - It may also be a workload resolved to its pods, eg, deployment/NAME, or statefulset/NAME, etc.
   - additionally, o.container is specified further with arg[1], and may be required for cases where resourceArg is not a Node.
 
 Complicating this even further, we also permit for the target to be given by a Selector string
@@ -20,7 +20,8 @@ If the pod / container are specified with positional arguments, then the selecto
 include a selector for the pod or container, but is permitted to have a process selector.
 
 It is also valid to have no positional arguments at all, and rely entirely on the
-selector to specify the pod / container to target.
+selector to specify the pod / container to target. The pods are then found with a
+label selector (run.go 's -l), see ResolveTraceJobTargetsBySelector.
 
 1. Resolve the Target
   - Look at any positional arguments (from CLI)
@@ -42,7 +43,10 @@ package tracejob
 import (
 	"context"
 	"fmt"
+	"math/rand"
+	"sort"
 	"strings"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 
@@ -52,6 +56,7 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	resourcehelper "k8s.io/kubectl/pkg/util/resource"
 )
 
 /*
@@ -59,9 +64,85 @@ This struct will be used when creating the TraceJob
 */
 
 type TraceJobTarget struct {
-	Node        string // Used for tracejob NodeSelector
-	PodUID      string // passed as argument to trace-runner
-	ContainerID string // passed as argument to trace-runner
+	Node        string `json:"node,omitempty"`        // Used for tracejob NodeSelector
+	PodUID      string `json:"podUID,omitempty"`      // passed as argument to trace-runner
+	ContainerID string `json:"containerID,omitempty"` // passed as argument to trace-runner
+	Pod         string `json:"pod,omitempty"`         // Name of the traced pod, empty when tracing a node
+	Container   string `json:"container,omitempty"`   // Name of the traced container, empty when tracing a node
+	Namespace   string `json:"namespace,omitempty"`   // Namespace of the traced pod, empty when tracing a node
+}
+
+// Resource is the TYPE/NAME of what the target traces, as accepted by ResolveTraceJobTarget.
+func (t TraceJobTarget) Resource() string {
+	switch {
+	case t.Pod != "":
+		return "pod/" + t.Pod
+	case t.Node != "":
+		return "node/" + t.Node
+	}
+	return ""
+}
+
+// SelectionPolicy decides which of the pods backing a workload become trace targets.
+// Pods are always considered ordered by name, so that the same pods get picked between runs.
+type SelectionPolicy string
+
+const (
+	// SelectFirst targets the first pod found on an allocatable node.
+	SelectFirst SelectionPolicy = "first"
+	// SelectRandom targets a pod found on an allocatable node at random.
+	SelectRandom SelectionPolicy = "random"
+	// SelectAll targets every pod found on an allocatable node, one trace job per pod.
+	SelectAll SelectionPolicy = "all"
+	// SelectOnePerNode targets the first pod found on each allocatable node.
+	SelectOnePerNode SelectionPolicy = "one-per-node"
+)
+
+// TargetSelection holds the knobs used to pick concrete targets out of a resource.
+type TargetSelection struct {
+	Policy SelectionPolicy
+	// MaxTargets caps the number of targets picked, 0 meaning the default of the policy:
+	// a single target for first and random, no limit for all and one-per-node.
+	MaxTargets int
+	// Requests are the resources the trace job will request, checked against the
+	// resources left on the node of each target. The missing ones default to DefaultResourceRequests,
+	// as they do for the trace job.
+	Requests v1.ResourceList
+	// NotStarted allows targeting containers which have not started yet, and have no ID, for trace jobs
+	// waiting for a process to appear in them.
+	NotStarted bool
+}
+
+// requests are the resources a trace job needs on its node.
+func (s TargetSelection) requests() v1.ResourceList {
+	return withDefaultResources(v1.ResourceRequirements{Requests: s.Requests}).Requests
+}
+
+// FansOut tells whether the selection may pick more than one target.
+func (s TargetSelection) FansOut() bool {
+	return s.limit() != 1
+}
+
+func (s TargetSelection) limit() int {
+	if s.MaxTargets > 0 {
+		return s.MaxTargets
+	}
+	switch s.Policy {
+	case SelectAll, SelectOnePerNode:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// ParseSelectionPolicy validates a selection policy coming from the command line.
+func ParseSelectionPolicy(policy string) (SelectionPolicy, error) {
+	switch p := SelectionPolicy(policy); p {
+	case SelectFirst, SelectRandom, SelectAll, SelectOnePerNode:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown pod selection policy %s", policy)
+	}
 }
 
 /*
@@ -74,13 +155,30 @@ ResolveTraceJobTarget will:
     - if the pod has multiple containers, a container name is required, otherwise the only container will be used
 
 clientset       - a kubernetes clientset, used for resolving the target resource
-resource        - a string, indicating the kubernetes resource to be traced. Currently supported: node, pod
+resource        - a string, indicating the kubernetes resource to be traced. Currently supported: node, pod,
+                  deploy, sts, ds, rs, job and cronjob (along with their long names)
 container       - (optional) the container to trace, required only if needed to disambiguate
 targetNamespace - (optional) the target namespace of a given resource, required if the resource is namespaced
 
 */
 
 func ResolveTraceJobTarget(clientset kubernetes.Interface, resource, container, targetNamespace string) (*TraceJobTarget, error) {
+	targets, err := ResolveTraceJobTargets(clientset, resource, container, targetNamespace, TargetSelection{Policy: SelectFirst})
+	if err != nil {
+		return nil, err
+	}
+	return &targets[0], nil
+}
+
+/*
+ResolveTraceJobTargets works like ResolveTraceJobTarget, but resources backed by
+more than one pod (eg, deploy/NAME) are resolved according to the selection policy,
+so that a trace job can be created for each of the selected pods.
+
+The returned slice always contains at least one target when err is nil.
+*/
+
+func ResolveTraceJobTargets(clientset kubernetes.Interface, resource, container, targetNamespace string, selection TargetSelection) ([]TraceJobTarget, error) {
 
 	target := TraceJobTarget{}
 
@@ -101,25 +199,19 @@ func ResolveTraceJobTarget(clientset kubernetes.Interface, resource, container,
 
 	switch resourceType {
 	case "node":
-		nodeClient := clientset.CoreV1().Nodes()
-		allocatable, err := NodeIsAllocatable(clientset, resourceID)
+		err := NodeIsAllocatable(clientset, resourceID, selection.requests())
 		if err != nil {
 			return nil, err
 		}
-		if !allocatable {
-			return nil, errors.NewErrorUnallocatable(fmt.Sprintf("Node %s is not allocatable", resourceID))
-		}
-		node, err := nodeClient.Get(context.TODO(), resourceID, metav1.GetOptions{})
+		node, err := clientset.CoreV1().Nodes().Get(context.TODO(), resourceID, metav1.GetOptions{})
 		if err != nil {
 			return nil, errors.NewErrorInvalid(fmt.Sprintf("Failed to locate a node for %s %v", resourceID, err))
 		}
 
-		labels := node.GetLabels()
-		val, ok := labels["kubernetes.io/hostname"]
-		if !ok {
-			return nil, errors.NewErrorInvalid("label kubernetes.io/hostname not found in node")
+		err = resolveNodeToTarget(node, &target)
+		if err != nil {
+			return nil, err
 		}
-		target.Node = val
 
 	case "pod":
 		podClient := clientset.CoreV1().Pods(targetNamespace)
@@ -128,110 +220,382 @@ func ResolveTraceJobTarget(clientset kubernetes.Interface, resource, container,
 			return nil, errors.NewErrorInvalid(fmt.Sprintf("Could not locate pod %s, err: %v", resourceID, err))
 		}
 
-		allocatable, err := NodeIsAllocatable(clientset, pod.Spec.NodeName)
+		err = NodeIsAllocatable(clientset, pod.Spec.NodeName, selection.requests())
 		if err != nil {
+			if errors.IsUnallocatableTargetError(err) {
+				return nil, errors.NewErrorFailedCheck(errors.FailedCheck(err), fmt.Sprintf("Pod %s is not scheduled on an allocatable node: %v", resourceID, err))
+			}
 			return nil, err
 		}
-		if !allocatable {
-			return nil, errors.NewErrorUnallocatable(fmt.Sprintf("Pod %s is not scheduled on an allocatable node", resourceID))
-		}
 
-		err = resolvePodToTarget(podClient, resourceID, container, targetNamespace, &target)
+		err = resolvePodToTarget(podClient, resourceID, container, targetNamespace, selection.NotStarted, &target)
 		if err != nil {
 			return nil, err
 		}
 
-	case "deploy", "deployment":
-		deployClient := clientset.AppsV1().Deployments(targetNamespace)
-		deployment, err := deployClient.Get(context.TODO(), resourceID, metav1.GetOptions{})
+	case "deploy", "deployment", "sts", "statefulset", "ds", "daemonset", "rs", "replicaset", "job", "cj", "cronjob":
+		podClient := clientset.CoreV1().Pods(targetNamespace)
+		pods, kind, err := podsForWorkload(clientset, resourceType, resourceID, targetNamespace)
 		if err != nil {
 			return nil, err
 		}
-		labelMap, err := metav1.LabelSelectorAsMap(deployment.Spec.Selector)
+
+		return selectPodTargets(clientset, podClient, pods, container, targetNamespace, selection, fmt.Sprintf("for %s %s", kind, resourceID))
+
+	default:
+		return nil, errors.NewErrorInvalid(fmt.Sprintf("Unsupported resource type %s for %s\n", resourceType, resourceID))
+	}
+
+	return []TraceJobTarget{target}, nil
+}
+
+// podsForWorkload lists the pods managed by a workload controller, returning them along with the kind of the workload.
+func podsForWorkload(clientset kubernetes.Interface, resourceType, resourceID, targetNamespace string) ([]v1.Pod, string, error) {
+	var kind string
+	var selectors []*metav1.LabelSelector
+
+	switch resourceType {
+	case "deploy", "deployment":
+		kind = "deployment"
+		deployment, err := clientset.AppsV1().Deployments(targetNamespace).Get(context.TODO(), resourceID, metav1.GetOptions{})
 		if err != nil {
-			return nil, err
+			return nil, kind, err
 		}
-		podClient := clientset.CoreV1().Pods(targetNamespace)
-		pods, err := podClient.List(context.TODO(), metav1.ListOptions{LabelSelector: labels.SelectorFromSet(labelMap).String()})
+		selectors = append(selectors, deployment.Spec.Selector)
+
+	case "sts", "statefulset":
+		kind = "statefulset"
+		statefulSet, err := clientset.AppsV1().StatefulSets(targetNamespace).Get(context.TODO(), resourceID, metav1.GetOptions{})
 		if err != nil {
-			return nil, err
+			return nil, kind, err
 		}
+		selectors = append(selectors, statefulSet.Spec.Selector)
 
-		var selectedPod *v1.Pod
-		for _, pod := range pods.Items {
-			allocatable, err := NodeIsAllocatable(clientset, pod.Spec.NodeName)
-			if err != nil {
-				continue
-			}
+	case "ds", "daemonset":
+		kind = "daemonset"
+		daemonSet, err := clientset.AppsV1().DaemonSets(targetNamespace).Get(context.TODO(), resourceID, metav1.GetOptions{})
+		if err != nil {
+			return nil, kind, err
+		}
+		selectors = append(selectors, daemonSet.Spec.Selector)
 
-			if allocatable {
-				selectedPod = &pod
-				break
-			}
+	case "rs", "replicaset":
+		kind = "replicaset"
+		replicaSet, err := clientset.AppsV1().ReplicaSets(targetNamespace).Get(context.TODO(), resourceID, metav1.GetOptions{})
+		if err != nil {
+			return nil, kind, err
 		}
+		selectors = append(selectors, replicaSet.Spec.Selector)
 
-		if selectedPod == nil {
-			return nil, errors.NewErrorUnallocatable(fmt.Sprintf("No pods for deployment %s were on allocatable nodes", resourceID))
+	case "job":
+		kind = "job"
+		job, err := clientset.BatchV1().Jobs(targetNamespace).Get(context.TODO(), resourceID, metav1.GetOptions{})
+		if err != nil {
+			return nil, kind, err
 		}
+		selectors = append(selectors, job.Spec.Selector)
 
-		err = resolvePodToTarget(podClient, selectedPod.Name, container, targetNamespace, &target)
+	case "cj", "cronjob":
+		// A cronjob has no pods of its own, only the ones of the jobs it is currently running.
+		kind = "cronjob"
+		cronJob, err := clientset.BatchV1().CronJobs(targetNamespace).Get(context.TODO(), resourceID, metav1.GetOptions{})
 		if err != nil {
-			return nil, err
+			return nil, kind, err
+		}
+		if len(cronJob.Status.Active) == 0 {
+			return nil, kind, errors.NewErrorInvalid(fmt.Sprintf("cronjob %s has no active jobs to trace", resourceID))
+		}
+		for _, ref := range cronJob.Status.Active {
+			job, err := clientset.BatchV1().Jobs(targetNamespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, kind, err
+			}
+			selectors = append(selectors, job.Spec.Selector)
 		}
 
 	default:
-		return nil, errors.NewErrorInvalid(fmt.Sprintf("Unsupported resource type %s for %s\n", resourceType, resourceID))
+		return nil, kind, errors.NewErrorInvalid(fmt.Sprintf("Unsupported resource type %s for %s\n", resourceType, resourceID))
+	}
+
+	podClient := clientset.CoreV1().Pods(targetNamespace)
+	pods := []v1.Pod{}
+	for _, labelSelector := range selectors {
+		selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+		if err != nil {
+			return nil, kind, err
+		}
+		podList, err := podClient.List(context.TODO(), metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, kind, err
+		}
+		pods = append(pods, podList.Items...)
 	}
 
-	return &target, nil
+	return pods, kind, nil
 }
 
-func NodeIsAllocatable(clientset kubernetes.Interface, hostname string) (bool, error) {
-	// if the job is neither Successful nor Failed, here we need to check to make sure that it is at least
-	// schedulable on the node. To do that
-	//
-	// 	 retrieve a list of all pods currently scheduled on the node
-	//	 check the number of pods available on the node
-	//   make sure that there are "enough" pods available
-	//   	 - if not, mark as "Unschedulable"
-	//   account for Unschedulable elsewhere in the operator logic?
+/*
+ResolveTraceJobTargetsBySelector resolves the pods matching a label selector to targets,
+according to the selection policy.
 
-	allPods, err := allPodsForNode(clientset, hostname)
+clientset       - a kubernetes clientset, used for listing the pods
+selector        - a label selector, eg: app=checkout,tier!=canary
+container       - (optional) the container to trace, required only if needed to disambiguate
+targetNamespace - the namespace of the pods
+*/
+
+func ResolveTraceJobTargetsBySelector(clientset kubernetes.Interface, selector, container, targetNamespace string, selection TargetSelection) ([]TraceJobTarget, error) {
+	parsed, err := labels.Parse(selector)
 	if err != nil {
-		return false, fmt.Errorf("could not retrieve pods %v", err)
+		return nil, errors.NewErrorInvalid(fmt.Sprintf("Invalid selector %s: %v", selector, err))
 	}
 
-	var nonTerminalPods []*v1.Pod
-	for _, pod := range allPods.Items {
-		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+	podClient := clientset.CoreV1().Pods(targetNamespace)
+	pods, err := podClient.List(context.TODO(), metav1.ListOptions{LabelSelector: parsed.String()})
+	if err != nil {
+		return nil, err
+	}
+	if len(pods.Items) == 0 {
+		return nil, errors.NewErrorInvalid(fmt.Sprintf("No pods found matching selector %s", selector))
+	}
+
+	return selectPodTargets(clientset, podClient, pods.Items, container, targetNamespace, selection, fmt.Sprintf("matching selector %s", selector))
+}
+
+/*
+ResolveNodeTargetsBySelector resolves every allocatable node matching a label selector
+to a target, so that the same trace can run on a whole node pool.
+
+clientset  - a kubernetes clientset, used for listing the nodes
+selector   - a label selector, eg: pool=batch
+selection  - only MaxTargets is used, capping the number of nodes picked, 0 meaning no limit
+*/
+
+func ResolveNodeTargetsBySelector(clientset kubernetes.Interface, selector string, selection TargetSelection) ([]TraceJobTarget, error) {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, errors.NewErrorInvalid(fmt.Sprintf("Invalid selector %s: %v", selector, err))
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{LabelSelector: parsed.String()})
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes.Items) == 0 {
+		return nil, errors.NewErrorInvalid(fmt.Sprintf("No nodes found matching selector %s", selector))
+	}
+
+	sort.Slice(nodes.Items, func(i, j int) bool {
+		return nodes.Items[i].Name < nodes.Items[j].Name
+	})
+
+	targets := []TraceJobTarget{}
+	var lastErr error
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+
+		err := NodeIsAllocatable(clientset, node.Name, selection.requests())
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		target := TraceJobTarget{}
+		if err := resolveNodeToTarget(node, &target); err != nil {
+			continue
+		}
+		targets = append(targets, target)
+
+		if selection.MaxTargets > 0 && len(targets) >= selection.MaxTargets {
+			break
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, unallocatableTargetsError(fmt.Sprintf("No nodes matching selector %s were allocatable", selector), lastErr)
+	}
+	return targets, nil
+}
+
+// randomSource is used to shuffle pods for SelectRandom.
+var randomSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// selectPodTargets resolves the pods scheduled on allocatable nodes to targets, following the selection policy.
+// The description of the pods is used to explain why no pod could be selected.
+func selectPodTargets(clientset kubernetes.Interface, podClient corev1.PodInterface, pods []v1.Pod, container, targetNamespace string, selection TargetSelection, description string) ([]TraceJobTarget, error) {
+	candidates := append([]v1.Pod{}, pods...)
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Name < candidates[j].Name
+	})
+	if selection.Policy == SelectRandom {
+		randomSource.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+	}
+
+	limit := selection.limit()
+	targets := []TraceJobTarget{}
+	nodes := map[string]bool{}
+	var lastErr error
+
+	for _, pod := range candidates {
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		if selection.Policy == SelectOnePerNode && nodes[pod.Spec.NodeName] {
+			continue
+		}
+
+		err := NodeIsAllocatable(clientset, pod.Spec.NodeName, selection.requests())
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		target := TraceJobTarget{}
+		err = resolvePodToTarget(podClient, pod.Name, container, targetNamespace, selection.NotStarted, &target)
+		if err != nil {
+			// When fanning out, a pod that can't be resolved is skipped rather than failing the whole set.
+			if limit == 1 {
+				return nil, err
+			}
 			continue
 		}
+		targets = append(targets, target)
+		nodes[pod.Spec.NodeName] = true
 
-		nonTerminalPods = append(nonTerminalPods, &pod)
+		if limit > 0 && len(targets) >= limit {
+			break
+		}
 	}
 
-	fmt.Printf("Got %d pods, %d non-terminal pods", len(allPods.Items), len(nonTerminalPods))
+	if len(targets) == 0 {
+		return nil, unallocatableTargetsError(fmt.Sprintf("No pods %s were on allocatable nodes", description), lastErr)
+	}
+	return targets, nil
+}
 
+// unallocatableTargetsError explains why no target could be selected, given the last node check that failed.
+func unallocatableTargetsError(message string, lastErr error) error {
+	if !errors.IsUnallocatableTargetError(lastErr) {
+		return errors.NewErrorUnallocatable(message)
+	}
+	return errors.NewErrorFailedCheck(errors.FailedCheck(lastErr), fmt.Sprintf("%s, last failure: %v", message, lastErr))
+}
+
+/*
+NodeIsAllocatable checks that a trace job requesting the given resources can be scheduled on a node,
+returning a TargetSelectionError naming the check that failed otherwise. The node must:
+
+- be ready
+- not be cordoned or otherwise marked unschedulable, as it is being drained or maintained
+- not have NoExecute taints the trace job doesn't tolerate
+- have room for one more pod
+- have enough CPU and memory left, once the requests of the pods already running there are accounted for
+*/
+func NodeIsAllocatable(clientset kubernetes.Interface, hostname string, requests v1.ResourceList) error {
 	nodeClient := clientset.CoreV1().Nodes()
 	node, err := nodeClient.Get(context.TODO(), hostname, metav1.GetOptions{})
 
 	if err != nil {
-		return false, fmt.Errorf("could not get node object %v", err)
+		return fmt.Errorf("could not get node object %v", err)
+	}
+
+	if !nodeIsReady(node) {
+		return errors.NewErrorFailedCheck(errors.CheckNotReady, fmt.Sprintf("node %s is not ready", hostname))
+	}
+
+	// The trace job tolerates the unschedulable taint, but a cordoned node is about to go away.
+	if node.Spec.Unschedulable {
+		return errors.NewErrorFailedCheck(errors.CheckCordoned, fmt.Sprintf("node %s is cordoned", hostname))
+	}
+
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == v1.TaintEffectNoExecute && !tolerated(taint) {
+			return errors.NewErrorFailedCheck(errors.CheckNoExecuteTaint, fmt.Sprintf("node %s has the NoExecute taint %s", hostname, taint.ToString()))
+		}
+	}
+
+	allPods, err := allPodsForNode(clientset, hostname)
+	if err != nil {
+		return fmt.Errorf("could not retrieve pods %v", err)
+	}
+
+	var nonTerminalPods []*v1.Pod
+	for i := range allPods.Items {
+		pod := &allPods.Items[i]
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+
+		nonTerminalPods = append(nonTerminalPods, pod)
 	}
 
 	maxPods, ok := node.Status.Allocatable.Pods().AsInt64()
 	if !ok {
 		err = fmt.Errorf("quantity was not an integer: %s", node.Status.Allocatable.Pods().String())
-		return false, fmt.Errorf("could not parse the number of allocatable pods %v", err)
+		return fmt.Errorf("could not parse the number of allocatable pods %v", err)
 	}
 
 	if len(nonTerminalPods) >= int(maxPods) {
-		return false, nil
+		return errors.NewErrorFailedCheck(errors.CheckTooManyPods, fmt.Sprintf("node %s already runs the %d pods it can allocate", hostname, maxPods))
+	}
+
+	requested := v1.ResourceList{}
+	for _, pod := range nonTerminalPods {
+		podRequests, _ := resourcehelper.PodRequestsAndLimits(pod)
+		for name, quantity := range podRequests {
+			total := requested[name]
+			total.Add(quantity)
+			requested[name] = total
+		}
+	}
+
+	checks := []struct {
+		resource v1.ResourceName
+		check    string
+	}{
+		{v1.ResourceCPU, errors.CheckInsufficientCPU},
+		{v1.ResourceMemory, errors.CheckInsufficientMemory},
+	}
+	for _, c := range checks {
+		needed, ok := requests[c.resource]
+		if !ok {
+			continue
+		}
+		allocatable, ok := node.Status.Allocatable[c.resource]
+		if !ok {
+			continue
+		}
+
+		free := allocatable.DeepCopy()
+		free.Sub(requested[c.resource])
+		if free.Cmp(needed) < 0 {
+			return errors.NewErrorFailedCheck(c.check, fmt.Sprintf("node %s has %s of %s left, the trace requests %s", hostname, free.String(), c.resource, needed.String()))
+		}
 	}
 
-	// FIXME check resources, check for cordoned before giving the all-clear
+	return nil
+}
 
-	return true, nil
+func nodeIsReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	// Nodes without a Ready condition have not been reported on yet, assume they are fine.
+	return true
+}
+
+// tolerated tells whether the trace job tolerates a taint.
+func tolerated(taint v1.Taint) bool {
+	for _, toleration := range traceTolerations() {
+		if toleration.ToleratesTaint(&taint) {
+			return true
+		}
+	}
+	return false
 }
 
 func allPodsForNode(clientset kubernetes.Interface, nodeName string) (*v1.PodList, error) {
@@ -254,7 +618,16 @@ func allPodsForNode(clientset kubernetes.Interface, nodeName string) (*v1.PodLis
 	return podList, nil
 }
 
-func resolvePodToTarget(podClient corev1.PodInterface, resourceID, container, targetNamespace string, target *TraceJobTarget) error {
+func resolveNodeToTarget(node *v1.Node, target *TraceJobTarget) error {
+	val, ok := node.GetLabels()["kubernetes.io/hostname"]
+	if !ok {
+		return errors.NewErrorInvalid("label kubernetes.io/hostname not found in node")
+	}
+	target.Node = val
+	return nil
+}
+
+func resolvePodToTarget(podClient corev1.PodInterface, resourceID, container, targetNamespace string, notStarted bool, target *TraceJobTarget) error {
 	pod, err := podClient.Get(context.TODO(), resourceID, metav1.GetOptions{})
 
 	if err != nil {
@@ -280,10 +653,24 @@ func resolvePodToTarget(podClient corev1.PodInterface, resourceID, container, ta
 			containerID := strings.TrimPrefix(s.ContainerID, "docker://")
 			containerID = strings.TrimPrefix(containerID, "containerd://")
 			target.ContainerID = containerID
+			target.Pod = pod.Name
+			target.Container = targetContainer
+			target.Namespace = pod.Namespace
 			break
 		}
 	}
 
+	if target.ContainerID == "" && notStarted {
+		// The container is found by its name once it starts.
+		for _, c := range pod.Spec.Containers {
+			if c.Name == targetContainer {
+				target.Pod = pod.Name
+				target.Container = targetContainer
+				target.Namespace = pod.Namespace
+				return nil
+			}
+		}
+	}
 	if target.ContainerID == "" {
 		return fmt.Errorf("no containers found for the provided pod %s and container %s combination", pod.Name, targetContainer)
 	}
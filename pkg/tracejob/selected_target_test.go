@@ -0,0 +1,366 @@
+package tracejob
+
+import (
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testNode(name string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"kubernetes.io/hostname": name},
+		},
+		Status: v1.NodeStatus{
+			Allocatable: v1.ResourceList{
+				v1.ResourcePods: resource.MustParse("110"),
+			},
+		},
+	}
+}
+
+func testPoolNode(name, pool string) *v1.Node {
+	node := testNode(name)
+	node.Labels["pool"] = pool
+	return node
+}
+
+func testPod(name, node string, labels map[string]string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+			UID:       types.UID(name + "-uid"),
+			Labels:    labels,
+		},
+		Spec: v1.PodSpec{
+			NodeName:   node,
+			Containers: []v1.Container{{Name: "app"}},
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+			ContainerStatuses: []v1.ContainerStatus{
+				{Name: "app", ContainerID: "containerd://" + name + "-container"},
+			},
+		},
+	}
+}
+
+func testDeployment(name string, labels map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+		},
+	}
+}
+
+func testClientset(extra ...runtime.Object) *fake.Clientset {
+	labels := map[string]string{"app": "api"}
+	objects := append(extra,
+		testNode("node-a"),
+		testNode("node-b"),
+		testDeployment("api", labels),
+		testPod("api-1", "node-a", labels),
+		testPod("api-2", "node-b", labels),
+		testPod("api-3", "", labels),
+		testPod("other", "node-a", map[string]string{"app": "other"}),
+	)
+	return fake.NewSimpleClientset(objects...)
+}
+
+func TestResolveTraceJobTargetsDeploymentFirst(t *testing.T) {
+	targets, err := ResolveTraceJobTargets(testClientset(), "deploy/api", "", testNamespace, TargetSelection{Policy: SelectFirst})
+	assert.Nil(t, err)
+	assert.Len(t, targets, 1)
+	assert.Equal(t, "api-1-uid", targets[0].PodUID)
+	assert.Equal(t, "api-1-container", targets[0].ContainerID)
+}
+
+func TestResolveTraceJobTargetsNotStarted(t *testing.T) {
+	pod := testPod("worker-1", "node-a", nil)
+	pod.Status.ContainerStatuses[0].ContainerID = ""
+	clientset := testClientset(pod)
+
+	_, err := ResolveTraceJobTargets(clientset, "pod/worker-1", "", testNamespace, TargetSelection{Policy: SelectFirst})
+	assert.EqualError(t, err, "no containers found for the provided pod worker-1 and container app combination")
+
+	targets, err := ResolveTraceJobTargets(clientset, "pod/worker-1", "", testNamespace, TargetSelection{Policy: SelectFirst, NotStarted: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []TraceJobTarget{{Node: "node-a", PodUID: "worker-1-uid", Pod: "worker-1", Container: "app", Namespace: testNamespace}}, targets)
+}
+
+func TestResolveTraceJobTargetsDeploymentAll(t *testing.T) {
+	targets, err := ResolveTraceJobTargets(testClientset(), "deploy/api", "", testNamespace, TargetSelection{Policy: SelectAll})
+	assert.Nil(t, err)
+
+	expected := []TraceJobTarget{
+		{Node: "node-a", PodUID: "api-1-uid", ContainerID: "api-1-container", Pod: "api-1", Container: "app", Namespace: testNamespace},
+		{Node: "node-b", PodUID: "api-2-uid", ContainerID: "api-2-container", Pod: "api-2", Container: "app", Namespace: testNamespace},
+	}
+	assert.Equal(t, expected, targets)
+}
+
+func TestResolveTraceJobTargetsStatefulSet(t *testing.T) {
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: testNamespace},
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "app", Operator: metav1.LabelSelectorOpIn, Values: []string{"db"}},
+				},
+			},
+		},
+	}
+	clientset := testClientset(sts, testPod("db-0", "node-b", map[string]string{"app": "db"}))
+
+	targets, err := ResolveTraceJobTargets(clientset, "sts/db", "", testNamespace, TargetSelection{Policy: SelectAll})
+	assert.Nil(t, err)
+	assert.Equal(t, []TraceJobTarget{{Node: "node-b", PodUID: "db-0-uid", ContainerID: "db-0-container", Pod: "db-0", Container: "app", Namespace: testNamespace}}, targets)
+}
+
+func TestResolveTraceJobTargetsCronJob(t *testing.T) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "report-1234", Namespace: testNamespace},
+		Spec: batchv1.JobSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"job-name": "report-1234"}},
+		},
+	}
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: testNamespace},
+		Status: batchv1.CronJobStatus{
+			Active: []v1.ObjectReference{{Kind: "Job", Name: "report-1234", Namespace: testNamespace}},
+		},
+	}
+	clientset := testClientset(job, cronJob, testPod("report-1234-abcde", "node-a", map[string]string{"job-name": "report-1234"}))
+
+	targets, err := ResolveTraceJobTargets(clientset, "cronjob/report", "", testNamespace, TargetSelection{Policy: SelectFirst})
+	assert.Nil(t, err)
+	assert.Equal(t, []TraceJobTarget{{Node: "node-a", PodUID: "report-1234-abcde-uid", ContainerID: "report-1234-abcde-container", Pod: "report-1234-abcde", Container: "app", Namespace: testNamespace}}, targets)
+}
+
+func TestResolveTraceJobTargetsCronJobWithoutActiveJobs(t *testing.T) {
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: testNamespace},
+	}
+
+	_, err := ResolveTraceJobTargets(testClientset(cronJob), "cj/report", "", testNamespace, TargetSelection{Policy: SelectFirst})
+	assert.True(t, errors.IsInvalidTargetError(err))
+}
+
+func TestResolveTraceJobTargetsUnsupported(t *testing.T) {
+	_, err := ResolveTraceJobTargets(testClientset(), "svc/api", "", testNamespace, TargetSelection{Policy: SelectFirst})
+	assert.True(t, errors.IsInvalidTargetError(err))
+}
+
+func TestResolveTraceJobTargetsNode(t *testing.T) {
+	targets, err := ResolveTraceJobTargets(testClientset(), "node/node-b", "", testNamespace, TargetSelection{Policy: SelectAll})
+	assert.Nil(t, err)
+	assert.Equal(t, []TraceJobTarget{{Node: "node-b"}}, targets)
+}
+
+func TestParseSelectionPolicy(t *testing.T) {
+	policy, err := ParseSelectionPolicy("all")
+	assert.Nil(t, err)
+	assert.Equal(t, SelectAll, policy)
+
+	_, err = ParseSelectionPolicy("most")
+	assert.NotNil(t, err)
+}
+
+func TestResolveTraceJobTargetsBySelector(t *testing.T) {
+	clientset := testClientset(testPod("api-0", "node-a", map[string]string{"app": "api"}))
+
+	tests := []struct {
+		name      string
+		selection TargetSelection
+		want      []string
+	}{
+		{
+			name:      "first",
+			selection: TargetSelection{Policy: SelectFirst},
+			want:      []string{"api-0-uid"},
+		},
+		{
+			name:      "first with max targets",
+			selection: TargetSelection{Policy: SelectFirst, MaxTargets: 2},
+			want:      []string{"api-0-uid", "api-1-uid"},
+		},
+		{
+			name:      "all",
+			selection: TargetSelection{Policy: SelectAll},
+			want:      []string{"api-0-uid", "api-1-uid", "api-2-uid"},
+		},
+		{
+			name:      "one per node",
+			selection: TargetSelection{Policy: SelectOnePerNode},
+			want:      []string{"api-0-uid", "api-2-uid"},
+		},
+		{
+			name:      "one per node with max targets",
+			selection: TargetSelection{Policy: SelectOnePerNode, MaxTargets: 1},
+			want:      []string{"api-0-uid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := ResolveTraceJobTargetsBySelector(clientset, "app=api", "", testNamespace, tt.selection)
+			assert.Nil(t, err)
+
+			got := []string{}
+			for _, target := range targets {
+				got = append(got, target.PodUID)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResolveTraceJobTargetsBySelectorRandom(t *testing.T) {
+	targets, err := ResolveTraceJobTargetsBySelector(testClientset(), "app=api", "", testNamespace, TargetSelection{Policy: SelectRandom, MaxTargets: 5})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"api-1-uid", "api-2-uid"}, []string{targets[0].PodUID, targets[1].PodUID})
+}
+
+func TestResolveTraceJobTargetsBySelectorNoMatch(t *testing.T) {
+	_, err := ResolveTraceJobTargetsBySelector(testClientset(), "app=missing", "", testNamespace, TargetSelection{Policy: SelectAll})
+	assert.True(t, errors.IsInvalidTargetError(err))
+
+	_, err = ResolveTraceJobTargetsBySelector(testClientset(), "app in (", "", testNamespace, TargetSelection{Policy: SelectAll})
+	assert.True(t, errors.IsInvalidTargetError(err))
+}
+
+func TestTargetSelectionFansOut(t *testing.T) {
+	assert.False(t, TargetSelection{Policy: SelectFirst}.FansOut())
+	assert.False(t, TargetSelection{Policy: SelectRandom}.FansOut())
+	assert.False(t, TargetSelection{Policy: SelectAll, MaxTargets: 1}.FansOut())
+	assert.True(t, TargetSelection{Policy: SelectFirst, MaxTargets: 2}.FansOut())
+	assert.True(t, TargetSelection{Policy: SelectOnePerNode}.FansOut())
+}
+
+func TestResolveNodeTargetsBySelector(t *testing.T) {
+	clientset := testClientset(testPoolNode("batch-2", "batch"), testPoolNode("batch-1", "batch"), testPoolNode("web-1", "web"))
+
+	targets, err := ResolveNodeTargetsBySelector(clientset, "pool=batch", TargetSelection{})
+	assert.Nil(t, err)
+	assert.Equal(t, []TraceJobTarget{{Node: "batch-1"}, {Node: "batch-2"}}, targets)
+
+	targets, err = ResolveNodeTargetsBySelector(clientset, "pool=batch", TargetSelection{MaxTargets: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []TraceJobTarget{{Node: "batch-1"}}, targets)
+
+	_, err = ResolveNodeTargetsBySelector(clientset, "pool=gpu", TargetSelection{})
+	assert.True(t, errors.IsInvalidTargetError(err))
+}
+
+func TestNodeIsAllocatable(t *testing.T) {
+	busyPod := testPod("busy", "node-a", nil)
+	busyPod.Spec.Containers[0].Resources.Requests = v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("1900m"),
+		v1.ResourceMemory: resource.MustParse("1Gi"),
+	}
+
+	tests := []struct {
+		name  string
+		node  func(*v1.Node)
+		check string
+	}{
+		{
+			name: "allocatable",
+			node: func(n *v1.Node) {},
+		},
+		{
+			name: "not ready",
+			node: func(n *v1.Node) {
+				n.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+			},
+			check: errors.CheckNotReady,
+		},
+		{
+			name: "cordoned",
+			node: func(n *v1.Node) {
+				n.Spec.Unschedulable = true
+				n.Spec.Taints = []v1.Taint{{Key: v1.TaintNodeUnschedulable, Effect: v1.TaintEffectNoSchedule}}
+			},
+			check: errors.CheckCordoned,
+		},
+		{
+			name: "no schedule taints are tolerated",
+			node: func(n *v1.Node) {
+				n.Spec.Taints = []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}
+			},
+		},
+		{
+			name: "no execute taint",
+			node: func(n *v1.Node) {
+				n.Spec.Taints = []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoExecute}}
+			},
+			check: errors.CheckNoExecuteTaint,
+		},
+		{
+			name: "too many pods",
+			node: func(n *v1.Node) {
+				n.Status.Allocatable[v1.ResourcePods] = resource.MustParse("1")
+			},
+			check: errors.CheckTooManyPods,
+		},
+		{
+			name: "insufficient cpu",
+			node: func(n *v1.Node) {
+				n.Status.Allocatable[v1.ResourceCPU] = resource.MustParse("1950m")
+			},
+			check: errors.CheckInsufficientCPU,
+		},
+		{
+			name: "insufficient memory",
+			node: func(n *v1.Node) {
+				n.Status.Allocatable[v1.ResourceCPU] = resource.MustParse("4")
+				n.Status.Allocatable[v1.ResourceMemory] = resource.MustParse("1050Mi")
+			},
+			check: errors.CheckInsufficientMemory,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := testNode("node-a")
+			tt.node(node)
+			clientset := fake.NewSimpleClientset(node, busyPod)
+
+			err := NodeIsAllocatable(clientset, "node-a", DefaultResourceRequests())
+			if tt.check == "" {
+				assert.Nil(t, err)
+				return
+			}
+			assert.True(t, errors.IsUnallocatableTargetError(err))
+			assert.Equal(t, tt.check, errors.FailedCheck(err))
+		})
+	}
+}
+
+func TestResolveTraceJobTargetsExplainsUnallocatable(t *testing.T) {
+	node := testNode("node-a")
+	node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse}}
+	clientset := fake.NewSimpleClientset(node, testPod("api-1", "node-a", map[string]string{"app": "api"}))
+
+	_, err := ResolveTraceJobTargets(clientset, "pod/api-1", "", testNamespace, TargetSelection{Policy: SelectFirst})
+	assert.Equal(t, errors.CheckNotReady, errors.FailedCheck(err))
+
+	_, err = ResolveTraceJobTargetsBySelector(clientset, "app=api", "", testNamespace, TargetSelection{Policy: SelectAll})
+	assert.Equal(t, errors.CheckNotReady, errors.FailedCheck(err))
+}
+
+func TestTraceJobTargetResource(t *testing.T) {
+	assert.Equal(t, "pod/api-1", TraceJobTarget{Node: "node-a", Pod: "api-1"}.Resource())
+	assert.Equal(t, "node/node-a", TraceJobTarget{Node: "node-a"}.Resource())
+	assert.Equal(t, "", TraceJobTarget{}.Resource())
+}
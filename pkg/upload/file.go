@@ -0,0 +1,46 @@
+package upload
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+func init() {
+	Register("file", func(Options) (Uploader, error) {
+		return &FileUploader{}, nil
+	})
+}
+
+// FileUploader handles copying metadata output to a directory of the trace container,
+// such as a persistent volume mounted with a patch of the trace job.
+type FileUploader struct{}
+
+// Put copies the file at filePath to the path of u, a file:///path URL.
+func (f *FileUploader) Put(u *url.URL, filePath, contentType string) error {
+	if u.Host != "" && u.Host != "localhost" {
+		return &PermanentError{fmt.Errorf("file output urls must have an absolute path, eg file:///data/traces")}
+	}
+
+	src, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest := filepath.FromSlash(u.Path)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	dst, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -2,18 +2,25 @@ package upload
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
-	"path"
-	"path/filepath"
 	"strings"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
+func init() {
+	Register("gs", func(Options) (Uploader, error) {
+		return NewGcsUploader(GcsUploaderOptions{})
+	})
+}
+
 // GcsUploader handles uploading metadata output to google cloud storage.
 type GcsUploader struct {
 	client *storage.Client
@@ -50,56 +57,31 @@ func NewGcsUploader(opts GcsUploaderOptions) (*GcsUploader, error) {
 	}, nil
 }
 
-// Upload everything at metaDir to bucketURL.
-func (g *GcsUploader) Upload(metaDir, bucketURL string) error {
-	gsurl, err := url.Parse(bucketURL)
-	if err != nil {
-		return err
+// Put uploads the file at filePath to the object at u, a gs://bucket/path URL.
+func (g *GcsUploader) Put(u *url.URL, filePath, contentType string) error {
+	if len(u.Host) == 0 {
+		return &PermanentError{fmt.Errorf("no bucket specified in output url")}
 	}
 
-	if len(gsurl.Host) == 0 {
-		return fmt.Errorf("no bucket specified in output url")
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
 	}
-
-	bucket := g.client.Bucket(gsurl.Host)
+	defer file.Close()
 
 	// GCS handles an object path of /foo/bar by displaying a directory named "/"
 	// in the root of the bucket. This is not what we want.
-	outDir := strings.TrimPrefix(gsurl.Path, "/")
-
-	err = filepath.Walk(metaDir, func(filePath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		file, err := os.Open(filePath)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-
-		relPath, err := filepath.Rel(metaDir, filePath)
-		if err != nil {
-			return err
-		}
-
-		writer := bucket.Object(path.Join(outDir, relPath)).NewWriter(context.Background())
-		_, err = io.Copy(writer, file)
-		if err != nil {
-			return err
-		}
-
-		err = writer.Close()
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
+	writer := g.client.Bucket(u.Host).Object(strings.TrimPrefix(u.Path, "/")).NewWriter(context.Background())
+	writer.ContentType = contentType
+	if _, err := io.Copy(writer, file); err != nil {
+		writer.Close()
+		return err
+	}
 
+	err = writer.Close()
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code/100 == 4 && apiErr.Code != http.StatusTooManyRequests && apiErr.Code != http.StatusRequestTimeout {
+		return &PermanentError{err}
+	}
 	return err
 }
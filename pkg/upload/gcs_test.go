@@ -23,7 +23,7 @@ func TestUpload(t *testing.T) {
 	})
 	assert.Nil(t, err)
 
-	err = g.Upload("./testdata/gcs_upload_test", "gs://upload-test-bucket/_output/traces")
+	_, err = UploadWith(g, "./testdata/gcs_upload_test", "gs://upload-test-bucket/_output/traces")
 	assert.Nil(t, err)
 
 	objects, _, err := s.ListObjects("upload-test-bucket", "_output/traces", "", false)
@@ -0,0 +1,284 @@
+package upload
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iovisor/kubectl-trace/pkg/downloader"
+)
+
+const (
+	// HTTPUploadTar posts the output directory as a single tarball.
+	HTTPUploadTar = "tar"
+	// HTTPUploadMultipart posts each file of the output directory as a multipart form.
+	HTTPUploadMultipart = "multipart"
+
+	// HTTPUploadFormatEnvVar is the environment variable setting the format of HTTP uploads, HTTPUploadTar when empty.
+	HTTPUploadFormatEnvVar = "KUBECTL_TRACE_HTTP_UPLOAD_FORMAT"
+	// HTTPHeadersDirEnvVar is the environment variable giving the directory of the headers of HTTP uploads,
+	// each file being a header named after the file.
+	HTTPHeadersDirEnvVar = "KUBECTL_TRACE_HTTP_HEADERS_DIR"
+
+	// maxLoggedResponse is the size of the response bodies written to the output of the uploader.
+	maxLoggedResponse = 64 * 1024
+)
+
+func init() {
+	factory := func(opts Options) (Uploader, error) {
+		return NewHTTPUploader(HTTPUploaderOptions{Out: opts.Out})
+	}
+	Register("http", factory)
+	Register("https", factory)
+}
+
+// HTTPUploader handles posting metadata output to a webhook.
+type HTTPUploader struct {
+	client  *http.Client
+	format  string
+	headers http.Header
+	out     io.Writer
+}
+
+// HTTPUploaderOptions are used to customize HTTPUploader instance.
+type HTTPUploaderOptions struct {
+	// Format is HTTPUploadTar or HTTPUploadMultipart, read from $KUBECTL_TRACE_HTTP_UPLOAD_FORMAT when empty.
+	Format string
+
+	// Headers are added to the requests.
+	Headers http.Header
+
+	// HeadersDir holds files named after headers, whose content is the value of the header.
+	// It is read from $KUBECTL_TRACE_HTTP_HEADERS_DIR when empty, eg for a mounted secret.
+	HeadersDir string
+
+	// Client sends the requests, http.DefaultClient when nil.
+	Client *http.Client
+
+	// Out is where the responses of the webhook are written, os.Stdout when nil.
+	Out io.Writer
+}
+
+// NewHTTPUploader constructs a HTTPUploader.
+func NewHTTPUploader(opts HTTPUploaderOptions) (*HTTPUploader, error) {
+	if opts.Format == "" {
+		opts.Format = os.Getenv(HTTPUploadFormatEnvVar)
+	}
+	switch opts.Format {
+	case "":
+		opts.Format = HTTPUploadTar
+	case HTTPUploadTar, HTTPUploadMultipart:
+	default:
+		return nil, fmt.Errorf("unknown HTTP upload format %s, must be %s or %s", opts.Format, HTTPUploadTar, HTTPUploadMultipart)
+	}
+	if opts.HeadersDir == "" {
+		opts.HeadersDir = os.Getenv(HTTPHeadersDirEnvVar)
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Out == nil {
+		opts.Out = os.Stdout
+	}
+
+	headers := http.Header{}
+	for name, values := range opts.Headers {
+		headers[textproto.CanonicalMIMEHeaderKey(name)] = values
+	}
+	if opts.HeadersDir != "" {
+		if err := readHeaders(opts.HeadersDir, headers); err != nil {
+			return nil, err
+		}
+	}
+
+	return &HTTPUploader{
+		client:  opts.Client,
+		format:  opts.Format,
+		headers: headers,
+		out:     opts.Out,
+	}, nil
+}
+
+// readHeaders adds the headers in the files of dir to headers. The hidden files, such as the
+// ..data links of the secrets mounted by kubernetes, are skipped.
+func readHeaders(dir string, headers http.Header) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("could not read the HTTP headers: %v", err)
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		value, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return fmt.Errorf("could not read the HTTP headers: %v", err)
+		}
+		headers.Set(f.Name(), strings.TrimSpace(string(value)))
+	}
+	return nil
+}
+
+// Put posts the file at filePath to u as a multipart form, in its file field.
+func (h *HTTPUploader) Put(u *url.URL, filePath, contentType string) error {
+	return h.putForm(u, filePath, filepath.Base(filePath), contentType)
+}
+
+// UploadDir posts everything at metaDir to destination, either as a tarball or as a multipart form per file.
+func (h *HTTPUploader) UploadDir(metaDir string, destination *url.URL) (Manifest, error) {
+	if h.format == HTTPUploadTar {
+		return h.uploadTar(metaDir, destination)
+	}
+
+	manifest := Manifest{}
+	err := filepath.Walk(metaDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(metaDir, filePath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		contentType, err := DetectContentType(filePath)
+		if err != nil {
+			return err
+		}
+
+		if err := retry(func() error { return h.putForm(destination, filePath, relPath, contentType) }); err != nil {
+			return fmt.Errorf("could not upload %s to %s: %w", relPath, destination.String(), err)
+		}
+
+		manifest = append(manifest, Object{
+			Path:        relPath,
+			URL:         destination.String(),
+			Size:        info.Size(),
+			ContentType: contentType,
+		})
+		return nil
+	})
+
+	return manifest, err
+}
+
+// uploadTar posts the tarball of metaDir, which is written to a temporary file first so that it can be retried.
+func (h *HTTPUploader) uploadTar(metaDir string, destination *url.URL) (Manifest, error) {
+	tarball, err := ioutil.TempFile("", "kubectl-trace-*.tar")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tarball.Name())
+	defer tarball.Close()
+
+	if err := downloader.TarDirectory(tarball, metaDir); err != nil {
+		return nil, fmt.Errorf("could not archive %s: %v", metaDir, err)
+	}
+	info, err := tarball.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	err = retry(func() error {
+		if _, err := tarball.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return h.post(destination, "application/x-tar", info.Size(), ioutil.NopCloser(tarball))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not upload %s to %s: %w", filepath.Base(metaDir)+".tar", destination.String(), err)
+	}
+
+	return Manifest{{
+		Path:        filepath.Base(metaDir) + ".tar",
+		URL:         destination.String(),
+		Size:        info.Size(),
+		ContentType: "application/x-tar",
+	}}, nil
+}
+
+// putForm posts the file at filePath to u as a multipart form, streaming the file into the body of the request.
+func (h *HTTPUploader) putForm(u *url.URL, filePath, name, contentType string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	body, w := io.Pipe()
+	form := multipart.NewWriter(w)
+	go func() {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, strings.ReplaceAll(name, `"`, `\"`)))
+		header.Set("Content-Type", contentType)
+		part, err := form.CreatePart(header)
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		w.CloseWithError(err)
+	}()
+
+	return h.post(u, form.FormDataContentType(), -1, body)
+}
+
+// post sends body to u, and writes the response to the output of the uploader.
+// The client errors but throttling and timeouts are permanent.
+func (h *HTTPUploader) post(u *url.URL, contentType string, size int64, body io.ReadCloser) error {
+	req, err := http.NewRequest(http.MethodPost, u.String(), body)
+	if err != nil {
+		return &PermanentError{err}
+	}
+	for name, values := range h.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", contentType)
+	if size >= 0 {
+		req.ContentLength = size
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxLoggedResponse))
+	if err != nil {
+		return err
+	}
+	respBody = bytes.TrimSpace(respBody)
+
+	if resp.StatusCode/100 != 2 {
+		err := fmt.Errorf("POST %s failed: %s", u.String(), resp.Status)
+		if len(respBody) > 0 {
+			err = fmt.Errorf("POST %s failed: %s: %s", u.String(), resp.Status, respBody)
+		}
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusRequestTimeout {
+			return &PermanentError{err}
+		}
+		return err
+	}
+
+	if len(respBody) > 0 {
+		fmt.Fprintf(h.out, "Response from %s: %s\n", u.String(), respBody)
+	} else {
+		fmt.Fprintf(h.out, "Response from %s: %s\n", u.String(), resp.Status)
+	}
+	return nil
+}
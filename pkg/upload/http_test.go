@@ -0,0 +1,160 @@
+package upload
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWebhook records what it receives, failing the first requests with failStatus.
+type fakeWebhook struct {
+	mu         sync.Mutex
+	failures   int
+	failStatus int
+	requests   int
+	headers    []http.Header
+	tarFiles   []string
+	formFiles  map[string]string
+}
+
+func (f *fakeWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+	if f.requests <= f.failures {
+		w.WriteHeader(f.failStatus)
+		fmt.Fprint(w, "try again later")
+		return
+	}
+	f.headers = append(f.headers, r.Header)
+
+	if r.Header.Get("Content-Type") == "application/x-tar" {
+		tr := tar.NewReader(r.Body)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.tarFiles = append(f.tarFiles, h.Name)
+		}
+		fmt.Fprintln(w, `{"id": "trace-1"}`)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	data, _ := ioutil.ReadAll(file)
+	f.formFiles[header.Filename] = header.Header.Get("Content-Type") + " " + string(data)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func TestHTTPUploadTar(t *testing.T) {
+	withFastBackoff(t)
+	fake := &fakeWebhook{failures: 1, failStatus: http.StatusServiceUnavailable}
+	s := httptest.NewServer(fake)
+	defer s.Close()
+
+	headersDir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(headersDir, "Authorization"), []byte("Bearer token\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(headersDir, "..data"), []byte("skipped"), 0600))
+
+	out := &bytes.Buffer{}
+	u, err := NewHTTPUploader(HTTPUploaderOptions{
+		HeadersDir: headersDir,
+		Headers:    http.Header{"x-trace-id": {"1234"}},
+		Out:        out,
+	})
+	require.NoError(t, err)
+
+	manifest, err := UploadWith(u, "./testdata/gcs_upload_test", s.URL+"/upload")
+	require.NoError(t, err)
+
+	sort.Strings(fake.tarFiles)
+	assert.Equal(t, []string{"gcs_upload_test/metadata.json", "gcs_upload_test/options.json"}, fake.tarFiles)
+	assert.Equal(t, 2, fake.requests)
+	require.Len(t, fake.headers, 1)
+	assert.Equal(t, "Bearer token", fake.headers[0].Get("Authorization"))
+	assert.Equal(t, "1234", fake.headers[0].Get("X-Trace-Id"))
+	assert.Empty(t, fake.headers[0].Get("..data"))
+
+	require.Len(t, manifest, 1)
+	assert.Equal(t, "gcs_upload_test.tar", manifest[0].Path)
+	assert.Equal(t, s.URL+"/upload", manifest[0].URL)
+	assert.Equal(t, "application/x-tar", manifest[0].ContentType)
+	assert.Equal(t, fmt.Sprintf("Response from %s/upload: {\"id\": \"trace-1\"}\n", s.URL), out.String())
+}
+
+func TestUploadHTTPOut(t *testing.T) {
+	fake := &fakeWebhook{}
+	s := httptest.NewServer(fake)
+	defer s.Close()
+
+	// The uploader of the registry writes the responses where the runner writes its messages.
+	out := &bytes.Buffer{}
+	_, err := Upload("./testdata/gcs_upload_test", s.URL+"/upload", Options{Out: out})
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("Response from %s/upload: {\"id\": \"trace-1\"}\n", s.URL), out.String())
+}
+
+func TestHTTPUploadMultipart(t *testing.T) {
+	fake := &fakeWebhook{formFiles: map[string]string{}}
+	s := httptest.NewServer(fake)
+	defer s.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "flamegraph.svg"), []byte("<svg></svg>"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "meta.json"), []byte("{}"), 0644))
+
+	out := &bytes.Buffer{}
+	u, err := NewHTTPUploader(HTTPUploaderOptions{Format: HTTPUploadMultipart, Out: out})
+	require.NoError(t, err)
+
+	manifest, err := UploadWith(u, dir, s.URL)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"flamegraph.svg": "image/svg+xml <svg></svg>",
+		"meta.json":      "application/json {}",
+	}, fake.formFiles)
+	assert.Len(t, manifest, 2)
+	assert.Equal(t, fmt.Sprintf("Response from %s: 201 Created\nResponse from %s: 201 Created\n", s.URL, s.URL), out.String())
+}
+
+func TestHTTPUploadErrors(t *testing.T) {
+	withFastBackoff(t)
+	fake := &fakeWebhook{failures: 10, failStatus: http.StatusUnauthorized}
+	s := httptest.NewServer(fake)
+	defer s.Close()
+
+	u, err := NewHTTPUploader(HTTPUploaderOptions{Out: ioutil.Discard})
+	require.NoError(t, err)
+	_, err = UploadWith(u, "./testdata/gcs_upload_test", s.URL)
+	assert.EqualError(t, err, fmt.Sprintf("could not upload gcs_upload_test.tar to %s: POST %s failed: 401 Unauthorized: try again later", s.URL, s.URL))
+	assert.Equal(t, 1, fake.requests)
+
+	fake.requests, fake.failStatus = 0, http.StatusBadGateway
+	_, err = UploadWith(u, "./testdata/gcs_upload_test", s.URL)
+	assert.EqualError(t, err, fmt.Sprintf("could not upload gcs_upload_test.tar to %s: POST %s failed: 502 Bad Gateway: try again later, after 3 attempts", s.URL, s.URL))
+	assert.Equal(t, 3, fake.requests)
+
+	_, err = NewHTTPUploader(HTTPUploaderOptions{Format: "zip"})
+	assert.EqualError(t, err, "unknown HTTP upload format zip, must be tar or multipart")
+}
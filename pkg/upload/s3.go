@@ -0,0 +1,392 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultS3Region is the region used when neither the options nor the environment give one.
+	DefaultS3Region = "us-east-1"
+
+	// DefaultS3PartSize is the size of the parts of multipart uploads, files up to this size are put at once.
+	DefaultS3PartSize = 8 * 1024 * 1024
+
+	// MinS3PartSize is the smallest part S3 accepts in a multipart upload, but for the last one.
+	MinS3PartSize = 5 * 1024 * 1024
+
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func init() {
+	Register("s3", func(Options) (Uploader, error) {
+		return NewS3Uploader(S3UploaderOptions{})
+	})
+}
+
+// S3Uploader handles uploading metadata output to Amazon S3, or to a storage exposing the S3 API such as MinIO.
+type S3Uploader struct {
+	client          *http.Client
+	endpoint        *url.URL
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	partSize        int64
+	now             func() time.Time
+}
+
+// S3UploaderOptions are used to customize S3Uploader instance.
+// The fields left empty are read from the environment variables of the AWS CLI:
+// AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL, AWS_REGION or AWS_DEFAULT_REGION,
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type S3UploaderOptions struct {
+	// Endpoint for S3 server if it needs to be overridden, eg http://minio.storage:9000.
+	// Buckets are addressed in the path of the requests to custom endpoints, and in the host name on AWS.
+	Endpoint string
+
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// PartSize is the size of the parts of multipart uploads, DefaultS3PartSize when zero.
+	PartSize int64
+
+	// Client sends the requests, http.DefaultClient when nil.
+	Client *http.Client
+}
+
+// NewS3Uploader constructs a S3Uploader.
+func NewS3Uploader(opts S3UploaderOptions) (*S3Uploader, error) {
+	if opts.Endpoint == "" {
+		opts.Endpoint = firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL")
+	}
+	if opts.Region == "" {
+		opts.Region = firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	}
+	if opts.Region == "" {
+		opts.Region = DefaultS3Region
+	}
+	if opts.AccessKeyID == "" && opts.SecretAccessKey == "" {
+		opts.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		opts.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		opts.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if opts.AccessKeyID == "" || opts.SecretAccessKey == "" {
+		return nil, fmt.Errorf("no S3 credentials, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	if opts.PartSize == 0 {
+		opts.PartSize = DefaultS3PartSize
+	}
+	if opts.PartSize < 0 {
+		return nil, fmt.Errorf("the part size of S3 uploads cannot be negative")
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	var endpoint *url.URL
+	if opts.Endpoint != "" {
+		var err error
+		endpoint, err = url.Parse(opts.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint %s: %v", opts.Endpoint, err)
+		}
+		if endpoint.Scheme != "http" && endpoint.Scheme != "https" || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid S3 endpoint %s, must be a http or https URL", opts.Endpoint)
+		}
+	}
+
+	return &S3Uploader{
+		client:          opts.Client,
+		endpoint:        endpoint,
+		region:          opts.Region,
+		accessKeyID:     opts.AccessKeyID,
+		secretAccessKey: opts.SecretAccessKey,
+		sessionToken:    opts.SessionToken,
+		partSize:        opts.PartSize,
+		now:             time.Now,
+	}, nil
+}
+
+// Put uploads the file at filePath to the object at u, a s3://bucket/key URL.
+// Files larger than the part size are sent with multipart uploads.
+func (s *S3Uploader) Put(u *url.URL, filePath, contentType string) error {
+	if len(u.Host) == 0 {
+		return &PermanentError{fmt.Errorf("no bucket specified in output url")}
+	}
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > s.partSize {
+		return s.multipartUpload(bucket, key, contentType, file)
+	}
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	_, err = s.do(http.MethodPut, bucket, key, nil, contentType, data)
+	return err
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+// multipartUpload sends r to key in parts of the part size, and aborts the upload when one fails
+// so that the bucket is not charged for its parts.
+func (s *S3Uploader) multipartUpload(bucket, key, contentType string, r io.Reader) error {
+	resp, err := s.do(http.MethodPost, bucket, key, url.Values{"uploads": {""}}, contentType, nil)
+	if err != nil {
+		return err
+	}
+	var initiated initiateMultipartUploadResult
+	if err := xml.Unmarshal(resp.body, &initiated); err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("invalid response to the creation of the multipart upload of %s", key)
+	}
+
+	parts, err := s.uploadParts(bucket, key, initiated.UploadID, r)
+	if err == nil {
+		var body []byte
+		body, err = xml.Marshal(completeMultipartUpload{Parts: parts})
+		if err == nil {
+			_, err = s.do(http.MethodPost, bucket, key, url.Values{"uploadId": {initiated.UploadID}}, "", body)
+		}
+	}
+	if err != nil {
+		s.do(http.MethodDelete, bucket, key, url.Values{"uploadId": {initiated.UploadID}}, "", nil)
+		return err
+	}
+	return nil
+}
+
+func (s *S3Uploader) uploadParts(bucket, key, uploadID string, r io.Reader) ([]completedPart, error) {
+	parts := []completedPart{}
+	buf := make([]byte, s.partSize)
+	for number := 1; ; number++ {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+
+		query := url.Values{"partNumber": {fmt.Sprint(number)}, "uploadId": {uploadID}}
+		resp, perr := s.do(http.MethodPut, bucket, key, query, "", buf[:n])
+		if perr != nil {
+			return nil, perr
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.header.Get("ETag")})
+
+		if err == io.ErrUnexpectedEOF {
+			return parts, nil
+		}
+	}
+}
+
+type s3Response struct {
+	header http.Header
+	body   []byte
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sends a signed request on key of bucket, and turns the error responses of S3 into errors.
+// The client errors but throttling and timeouts are permanent.
+func (s *S3Uploader) do(method, bucket, key string, query url.Values, contentType string, body []byte) (*s3Response, error) {
+	req, err := http.NewRequest(method, s.objectURL(bucket, key, query), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		var e s3Error
+		err := fmt.Errorf("%s s3://%s/%s failed: %s", method, bucket, key, resp.Status)
+		if xml.Unmarshal(respBody, &e) == nil && e.Code != "" {
+			err = fmt.Errorf("%s s3://%s/%s failed: %s: %s", method, bucket, key, e.Code, e.Message)
+		}
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusRequestTimeout {
+			return nil, &PermanentError{err}
+		}
+		return nil, err
+	}
+	return &s3Response{header: resp.Header, body: respBody}, nil
+}
+
+// objectURL addresses the bucket in the path for custom endpoints, and in the host name on AWS
+// unless its name has dots, which do not match the wildcard certificate of S3.
+func (s *S3Uploader) objectURL(bucket, key string, query url.Values) string {
+	u := url.URL{Scheme: "https", Host: fmt.Sprintf("s3.%s.amazonaws.com", s.region)}
+	objectPath := "/" + bucket + "/" + key
+	if s.endpoint != nil {
+		u.Scheme, u.Host = s.endpoint.Scheme, s.endpoint.Host
+		objectPath = strings.TrimSuffix(s.endpoint.Path, "/") + objectPath
+	} else if !strings.Contains(bucket, ".") {
+		u.Host = bucket + "." + u.Host
+		objectPath = "/" + key
+	}
+	u.Path = objectPath
+	u.RawPath = s3PathEscape(objectPath)
+	u.RawQuery = canonicalQuery(query)
+	return u.String()
+}
+
+// sign adds the headers of the version 4 signature of AWS to req, signing its host and all its other headers.
+func (s *S3Uploader) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	scope := strings.Join([]string{date, s.region, "s3", "aws4_request"}, "/")
+	signedHeaders, canonicalHeaders := canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), date)
+	for _, k := range []string{s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, k)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKeyID, scope, signedHeaders, signature))
+}
+
+func canonicalHeaders(req *http.Request) (string, string) {
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+	return strings.Join(names, ";"), canonical.String()
+}
+
+// canonicalQuery encodes query sorted by key, with the escaping of AWS, which differs from url.Values.Encode for spaces.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	params := []string{}
+	for _, k := range keys {
+		for _, v := range query[k] {
+			params = append(params, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func s3PathEscape(p string) string {
+	return s3Escape(p, false)
+}
+
+// s3Escape percent-encodes all the bytes of s but the unreserved characters, and the slashes unless escapeSlash.
+func s3Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !escapeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
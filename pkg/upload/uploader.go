@@ -0,0 +1,219 @@
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Uploader sends files to the storage addressed by the URLs of a scheme.
+type Uploader interface {
+	// Put uploads the local file at filePath to the object at u, eg gs://bucket/path/to/object.
+	// Errors which are not worth retrying, such as denied accesses, are returned as PermanentError.
+	Put(u *url.URL, filePath, contentType string) error
+}
+
+// DirectoryUploader is implemented by the uploaders which send a directory to a single URL rather than
+// each of its files to its own object, such as webhooks. UploadWith leaves the whole upload to them.
+type DirectoryUploader interface {
+	Uploader
+
+	// UploadDir sends everything at metaDir to destination, and returns what was uploaded.
+	UploadDir(metaDir string, destination *url.URL) (Manifest, error)
+}
+
+// Options are given to the factories of the uploaders, for what does not depend on the scheme.
+type Options struct {
+	// Out is where the uploaders write what they report, such as the responses of webhooks, os.Stdout when nil.
+	Out io.Writer
+}
+
+// Factory constructs the uploader of a scheme with opts, and the credentials found in the environment of the trace.
+type Factory func(opts Options) (Uploader, error)
+
+var factories = map[string]Factory{}
+
+// Register makes the uploader of factory handle the outputs of scheme. It is meant to be called by the init
+// functions of the files defining uploaders.
+func Register(scheme string, factory Factory) {
+	factories[scheme] = factory
+}
+
+// Schemes returns the schemes of the outputs which can be uploaded.
+func Schemes() []string {
+	schemes := []string{}
+	for s := range factories {
+		schemes = append(schemes, s)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Supported tells whether output is a URL of a registered scheme.
+func Supported(output string) bool {
+	u, err := url.Parse(output)
+	if err != nil {
+		return false
+	}
+	_, ok := factories[u.Scheme]
+	return ok && strings.HasPrefix(output, u.Scheme+"://")
+}
+
+// PermanentError is an error of an upload which fails again when retried.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Backoff is how uploads are retried, the attempts of each file being the steps of the backoff.
+var Backoff = wait.Backoff{
+	Duration: 1 * time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    4,
+}
+
+// Object is a file of the trace which was uploaded.
+type Object struct {
+	// Path of the file relative to the uploaded directory.
+	Path        string `json:"path"`
+	URL         string `json:"url"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType"`
+}
+
+// Manifest lists the objects uploaded for a trace.
+type Manifest []Object
+
+// Print writes the manifest as a table to w.
+func (m Manifest) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "OBJECT\tSIZE\tCONTENT TYPE")
+	for _, o := range m {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", o.URL, o.Size, o.ContentType)
+	}
+	return tw.Flush()
+}
+
+// Upload sends everything at metaDir to destination, with the uploader registered for its scheme constructed with opts.
+func Upload(metaDir, destination string, opts Options) (Manifest, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil, err
+	}
+	factory, ok := factories[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported output %s, the supported schemes are %s", destination, strings.Join(Schemes(), ", "))
+	}
+	uploader, err := factory(opts)
+	if err != nil {
+		return nil, err
+	}
+	return UploadWith(uploader, metaDir, destination)
+}
+
+// UploadWith sends everything at metaDir to destination with uploader, keeping the paths of the files
+// below the path of destination. The failed uploads are retried following Backoff. It returns the objects
+// uploaded, even when failing on one of them.
+func UploadWith(uploader Uploader, metaDir, destination string) (Manifest, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := uploader.(DirectoryUploader); ok {
+		return d.UploadDir(metaDir, u)
+	}
+
+	manifest := Manifest{}
+	err = filepath.Walk(metaDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(metaDir, filePath)
+		if err != nil {
+			return err
+		}
+
+		contentType, err := DetectContentType(filePath)
+		if err != nil {
+			return err
+		}
+
+		object := *u
+		object.Path = path.Join(u.Path, filepath.ToSlash(relPath))
+		object.RawPath = ""
+		if err := retry(func() error { return uploader.Put(&object, filePath, contentType) }); err != nil {
+			return fmt.Errorf("could not upload %s to %s: %w", relPath, object.String(), err)
+		}
+
+		manifest = append(manifest, Object{
+			Path:        filepath.ToSlash(relPath),
+			URL:         object.String(),
+			Size:        info.Size(),
+			ContentType: contentType,
+		})
+		return nil
+	})
+
+	return manifest, err
+}
+
+func retry(put func() error) error {
+	var lastErr error
+	err := wait.ExponentialBackoff(Backoff, func() (bool, error) {
+		lastErr = put()
+		var permanent *PermanentError
+		if errors.As(lastErr, &permanent) {
+			return false, lastErr
+		}
+		return lastErr == nil, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("%v, after %d attempts", lastErr, Backoff.Steps)
+	}
+	return err
+}
+
+// DetectContentType returns the media type of a file from its extension, or else from its first bytes.
+func DetectContentType(filePath string) (string, error) {
+	if t := mime.TypeByExtension(filepath.Ext(filePath)); t != "" {
+		return t, nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
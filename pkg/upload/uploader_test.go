@@ -0,0 +1,137 @@
+package upload
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// flakyUploader fails the first puts of each object, with a permanent error for the objects of denied.
+type flakyUploader struct {
+	failures int
+	denied   string
+	puts     map[string]int
+}
+
+func (f *flakyUploader) Put(u *url.URL, filePath, contentType string) error {
+	f.puts[u.String()]++
+	if u.Path == f.denied {
+		return &PermanentError{fmt.Errorf("access denied")}
+	}
+	if f.puts[u.String()] <= f.failures {
+		return fmt.Errorf("connection reset by peer")
+	}
+	return nil
+}
+
+func withFastBackoff(t *testing.T) {
+	backoff := Backoff
+	Backoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+	t.Cleanup(func() { Backoff = backoff })
+}
+
+func TestSchemes(t *testing.T) {
+	assert.Equal(t, []string{"file", "gs", "http", "https", "s3"}, Schemes())
+
+	assert.True(t, Supported("gs://bucket/traces"))
+	assert.True(t, Supported("s3://bucket"))
+	assert.True(t, Supported("file:///data/traces"))
+	assert.False(t, Supported("stdout"))
+	assert.False(t, Supported("./trace.tar"))
+	assert.False(t, Supported("azblob://container/traces"))
+	assert.False(t, Supported("s3:bucket"))
+
+	_, err := Upload("./testdata/gcs_upload_test", "azblob://container/traces", Options{})
+	assert.EqualError(t, err, "unsupported output azblob://container/traces, the supported schemes are file, gs, http, https, s3")
+}
+
+func TestUploadWithRetries(t *testing.T) {
+	withFastBackoff(t)
+
+	u := &flakyUploader{failures: 2, puts: map[string]int{}}
+	manifest, err := UploadWith(u, "./testdata/gcs_upload_test", "gs://bucket/traces")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"gs://bucket/traces/metadata.json": 3, "gs://bucket/traces/options.json": 3}, u.puts)
+	assert.Len(t, manifest, 2)
+
+	u = &flakyUploader{failures: 3, puts: map[string]int{}}
+	manifest, err = UploadWith(u, "./testdata/gcs_upload_test", "gs://bucket/traces")
+	assert.EqualError(t, err, "could not upload metadata.json to gs://bucket/traces/metadata.json: connection reset by peer, after 3 attempts")
+	assert.Empty(t, manifest)
+
+	u = &flakyUploader{denied: "/traces/options.json", puts: map[string]int{}}
+	manifest, err = UploadWith(u, "./testdata/gcs_upload_test", "gs://bucket/traces")
+	assert.EqualError(t, err, "could not upload options.json to gs://bucket/traces/options.json: access denied")
+	assert.Equal(t, 1, u.puts["gs://bucket/traces/options.json"])
+	require.Len(t, manifest, 1)
+	assert.Equal(t, "metadata.json", manifest[0].Path)
+}
+
+func TestUploadToFile(t *testing.T) {
+	dir := t.TempDir()
+
+	manifest, err := Upload("./testdata/gcs_upload_test", "file://"+filepath.ToSlash(dir)+"/traces", Options{})
+	require.NoError(t, err)
+
+	expected, err := ioutil.ReadFile("./testdata/gcs_upload_test/options.json")
+	require.NoError(t, err)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "traces", "options.json"))
+	require.NoError(t, err)
+	assert.Equal(t, expected, data)
+
+	require.Len(t, manifest, 2)
+	assert.Equal(t, Object{
+		Path:        "options.json",
+		URL:         "file://" + filepath.ToSlash(dir) + "/traces/options.json",
+		Size:        int64(len(expected)),
+		ContentType: "application/json",
+	}, manifest[1])
+
+	_, err = Upload("./testdata/gcs_upload_test", "file://traces", Options{})
+	assert.EqualError(t, err, "could not upload metadata.json to file://traces/metadata.json: file output urls must have an absolute path, eg file:///data/traces")
+}
+
+func TestDetectContentType(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"flamegraph.svg": []byte("<svg></svg>"),
+		"trace":          []byte("Attaching 1 probe...\n"),
+		"profile":        {0x1f, 0x8b, 0x08, 0x00},
+	}
+	for name, data := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), data, 0644))
+	}
+
+	tests := map[string]string{
+		"flamegraph.svg": "image/svg+xml",
+		"trace":          "text/plain; charset=utf-8",
+		"profile":        "application/x-gzip",
+	}
+	for name, expected := range tests {
+		contentType, err := DetectContentType(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, contentType, name)
+	}
+}
+
+func TestManifestPrint(t *testing.T) {
+	m := Manifest{
+		{Path: "flamegraph.svg", URL: "s3://traces/api/flamegraph.svg", Size: 2048, ContentType: "image/svg+xml"},
+		{Path: "stdout.log", URL: "s3://traces/api/stdout.log", Size: 12, ContentType: "text/plain; charset=utf-8"},
+	}
+
+	out := &bytes.Buffer{}
+	require.NoError(t, m.Print(out))
+	assert.Equal(t, `OBJECT                          SIZE  CONTENT TYPE
+s3://traces/api/flamegraph.svg  2048  image/svg+xml
+s3://traces/api/stdout.log      12    text/plain; charset=utf-8
+`, out.String())
+}